@@ -0,0 +1,57 @@
+package alchemy
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ApprovalPolicy decide qué transmutaciones quedan retenidas hasta que un
+// supervisor las apruebe: las que consumen más de un umbral de una categoría
+// de material o cuya fórmula coincide con un patrón restringido.
+type ApprovalPolicy struct {
+	// CategoryThresholds usa como clave la categoría en minúsculas.
+	CategoryThresholds map[string]float64
+	RestrictedFormulas []*regexp.Regexp
+}
+
+// NewApprovalPolicy compila los patrones de fórmulas restringidas.
+func NewApprovalPolicy(thresholds map[string]float64, restricted []string) (ApprovalPolicy, error) {
+	policy := ApprovalPolicy{CategoryThresholds: map[string]float64{}}
+	for category, limit := range thresholds {
+		policy.CategoryThresholds[strings.ToLower(strings.TrimSpace(category))] = limit
+	}
+	for _, pattern := range restricted {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return ApprovalPolicy{}, fmt.Errorf("invalid restricted formula pattern %q: %w", pattern, err)
+		}
+		policy.RestrictedFormulas = append(policy.RestrictedFormulas, re)
+	}
+	return policy, nil
+}
+
+// categoryReasons compara el consumo total por categoría con los umbrales.
+func (p ApprovalPolicy) categoryReasons(totals map[string]float64, labels map[string]string) []string {
+	categories := make([]string, 0, len(totals))
+	for category := range totals {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+
+	reasons := []string{}
+	for _, category := range categories {
+		limit, ok := p.CategoryThresholds[category]
+		if !ok || totals[category] <= limit {
+			continue
+		}
+		reasons = append(reasons, fmt.Sprintf("%s quantity %s exceeds approval threshold %s",
+			labels[category],
+			strconv.FormatFloat(totals[category], 'f', -1, 64),
+			strconv.FormatFloat(limit, 'f', -1, 64),
+		))
+	}
+	return reasons
+}
@@ -0,0 +1,534 @@
+package alchemy
+
+import (
+	"backend-avanzada/formula"
+	"backend-avanzada/models"
+	"backend-avanzada/repository"
+	"backend-avanzada/units"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Engine reúne las reglas de dominio de las transmutaciones para que la API y
+// el worker evalúen exactamente lo mismo.
+type Engine struct {
+	materials  *repository.MaterialRepository
+	recipes    *repository.RecipeRepository
+	rules      *repository.TransmutationRuleRepository
+	formulas   *repository.FormulaRepository
+	exchange   ExchangePolicy
+	approval   ApprovalPolicy
+	maxRetries int
+}
+
+var (
+	// ErrFormulaDeprecated impide crear transmutaciones nuevas con una fórmula obsoleta del catálogo.
+	ErrFormulaDeprecated = errors.New("formula is deprecated")
+	// ErrReactantMismatch indica que la fórmula no consume el material que se
+	// reserva para la transmutación.
+	ErrReactantMismatch = errors.New("formula reactants do not include the transmutation material")
+)
+
+// DefaultMaxRetries es el número de reintentos permitido si la configuración no indica otro.
+const DefaultMaxRetries = 3
+
+func NewEngine(materials *repository.MaterialRepository, recipes *repository.RecipeRepository) *Engine {
+	return &Engine{
+		materials:  materials,
+		recipes:    recipes,
+		exchange:   ExchangePolicy{Mode: ExchangeModeFlag},
+		maxRetries: DefaultMaxRetries,
+	}
+}
+
+func (e *Engine) WithExchangePolicy(policy ExchangePolicy) {
+	if policy.Tolerance < 0 {
+		policy.Tolerance = 0
+	}
+	if policy.Mode != ExchangeModeReject {
+		policy.Mode = ExchangeModeFlag
+	}
+	e.exchange = policy
+}
+
+func (e *Engine) ExchangePolicy() ExchangePolicy {
+	return e.exchange
+}
+
+func (e *Engine) WithApprovalPolicy(policy ApprovalPolicy) {
+	e.approval = policy
+}
+
+// WithRules activa el motor de reglas de transmutaciones prohibidas.
+func (e *Engine) WithRules(rules *repository.TransmutationRuleRepository) {
+	e.rules = rules
+}
+
+// WithFormulas permite referenciar fórmulas del catálogo.
+func (e *Engine) WithFormulas(formulas *repository.FormulaRepository) {
+	e.formulas = formulas
+}
+
+func (e *Engine) WithMaxRetries(max int) {
+	if max < 0 {
+		max = 0
+	}
+	e.maxRetries = max
+}
+
+// MaxRetries es cuántas veces puede reintentarse una transmutación fallida.
+func (e *Engine) MaxRetries() int {
+	return e.maxRetries
+}
+
+// Evaluate calcula el resultado de la transmutación (receta o fórmula) y su
+// balance de intercambio equivalente sin modificar el inventario.
+func (e *Engine) Evaluate(t *models.Transmutation, at time.Time) (*models.TransmutationOutcome, error) {
+	lookup := newMaterialLookup(e.materials)
+
+	var outcome *models.TransmutationOutcome
+	if t.RecipeID != nil && len(t.Outputs) > 0 {
+		outcome = outcomeFromSnapshot(t, at)
+	} else if t.RecipeID != nil {
+		recipe, err := e.recipe(t)
+		if err != nil {
+			return nil, err
+		}
+		outcome = outcomeFromRecipe(recipe, t.Quantity, at)
+	} else {
+		parsed, err := formula.Parse(t.Formula)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkReactants(parsed, t.MaterialID, lookup); err != nil {
+			return nil, err
+		}
+		evaluation, err := parsed.Evaluate(t.Quantity)
+		if err != nil {
+			return nil, err
+		}
+		outcome = outcomeFromEvaluation(evaluation, at)
+	}
+	if err := lookup.resolve(outcome.Inputs); err != nil {
+		return nil, err
+	}
+	if err := lookup.resolve(outcome.Outputs); err != nil {
+		return nil, err
+	}
+
+	consumed, err := e.consumption(t, lookup)
+	if err != nil {
+		return nil, err
+	}
+	if lookup.repo != nil {
+		if t.RecipeID == nil {
+			valueNewProducts(consumed, outcome.Outputs)
+		}
+		if names := unvalued(consumed, outcome.Inputs, outcome.Outputs); len(names) > 0 {
+			return nil, fmt.Errorf("%w: %s", ErrUnvaluedMaterial, strings.Join(names, ", "))
+		}
+	}
+	outcome.Exchange = e.exchange.Balance(consumed, outcome.Outputs)
+	return outcome, nil
+}
+
+// CheckReactants comprueba que el material de una transmutación sin receta
+// figura entre los reactivos de su fórmula.
+func (e *Engine) CheckReactants(t *models.Transmutation) error {
+	if t.RecipeID != nil {
+		return nil
+	}
+	parsed, err := formula.Parse(t.Formula)
+	if err != nil {
+		return err
+	}
+	return checkReactants(parsed, t.MaterialID, newMaterialLookup(e.materials))
+}
+
+// checkReactants exige que materialID sea uno de los reactivos de f: es el
+// material que se reserva y se consume del inventario. Si no existe, la
+// reserva ya informará de ello.
+func checkReactants(f *formula.Formula, materialID uint, lookup *materialLookup) error {
+	if lookup.repo == nil || materialID == 0 {
+		return nil
+	}
+	m, err := lookup.findByID(materialID)
+	if err != nil || m == nil {
+		return err
+	}
+	names := make([]string, 0, len(f.Reactants))
+	for _, r := range f.Reactants {
+		if strings.EqualFold(strings.TrimSpace(r.Material), strings.TrimSpace(m.Name)) {
+			return nil
+		}
+		names = append(names, r.Material)
+	}
+	return fmt.Errorf("%w: %s is not among %s", ErrReactantMismatch, m.Name, strings.Join(names, ", "))
+}
+
+// ResolveFormula devuelve la versión pedida (0 = la vigente) de una fórmula
+// del catálogo. Una fórmula obsoleta no admite transmutaciones nuevas.
+func (e *Engine) ResolveFormula(formulaID uint, version int) (*models.Formula, *models.FormulaVersion, error) {
+	if e.formulas == nil {
+		return nil, nil, repository.ErrFormulaNotFound
+	}
+	f, v, err := e.formulas.FindVersion(formulaID, version)
+	if err != nil {
+		return nil, nil, err
+	}
+	if f.Deprecated {
+		return nil, nil, fmt.Errorf("%w: %s", ErrFormulaDeprecated, f.Name)
+	}
+	return f, v, nil
+}
+
+// ToBaseUnit expresa quantity, medida en unit, en la unidad base del material y
+// devuelve también esa unidad. Sin unit la cantidad ya está en la unidad base.
+func (e *Engine) ToBaseUnit(materialID uint, quantity float64, unit string) (float64, string, error) {
+	m, err := e.materials.FindById(int(materialID))
+	if err != nil {
+		return 0, "", err
+	}
+	if m == nil {
+		// Sin unidad se deja que la reserva informe del material inexistente.
+		if units.Normalize(unit) == "" {
+			return quantity, "", nil
+		}
+		return 0, "", repository.ErrMaterialNotFound
+	}
+	if units.Normalize(unit) == "" {
+		return quantity, m.Unit, nil
+	}
+	converted, err := units.Convert(quantity, unit, m.Unit, m.Density)
+	if err != nil {
+		return 0, "", fmt.Errorf("%s: %w", m.Name, err)
+	}
+	return converted, m.Unit, nil
+}
+
+// CheckExchange devuelve un *ExchangeError si el resultado viola el
+// intercambio equivalente y la política exige rechazarlo.
+func (e *Engine) CheckExchange(outcome *models.TransmutationOutcome) error {
+	if outcome == nil || outcome.Exchange == nil || !outcome.Exchange.Violated {
+		return nil
+	}
+	if e.exchange.Rejects() {
+		return &ExchangeError{Balance: outcome.Exchange}
+	}
+	return nil
+}
+
+// ApprovalReasons devuelve por qué la transmutación necesita aprobación de un
+// supervisor según la política configurada; vacío si puede procesarse ya.
+func (e *Engine) ApprovalReasons(t *models.Transmutation) ([]string, error) {
+	reasons := []string{}
+	if t.Formula != "" {
+		for _, re := range e.approval.RestrictedFormulas {
+			if re.MatchString(t.Formula) {
+				reasons = append(reasons, fmt.Sprintf("formula matches restricted pattern %q", re.String()))
+			}
+		}
+	}
+	if len(e.approval.CategoryThresholds) == 0 {
+		return reasons, nil
+	}
+
+	lookup := newMaterialLookup(e.materials)
+	consumed, err := e.consumption(t, lookup)
+	if err != nil {
+		return nil, err
+	}
+	totals := map[string]float64{}
+	labels := map[string]string{}
+	for _, c := range consumed {
+		if c.MaterialID == 0 || lookup.repo == nil {
+			continue
+		}
+		m, err := lookup.findByID(c.MaterialID)
+		if err != nil {
+			return nil, err
+		}
+		if m == nil || m.Category == "" {
+			continue
+		}
+		key := strings.ToLower(m.Category)
+		totals[key] += c.Quantity
+		labels[key] = m.Category
+	}
+	return append(reasons, e.approval.categoryReasons(totals, labels)...), nil
+}
+
+// MatchRules evalúa las reglas activas contra la transmutación ya evaluada y
+// el rol de quien la solicita. Devuelve una coincidencia por regla.
+func (e *Engine) MatchRules(t *models.Transmutation, outcome *models.TransmutationOutcome, role string) ([]models.RuleHit, error) {
+	if e.rules == nil {
+		return nil, nil
+	}
+	rules, err := e.rules.FindEnabled()
+	if err != nil || len(rules) == 0 {
+		return nil, err
+	}
+
+	subject := ruleSubject{
+		text:       t.Formula,
+		categories: map[string]string{},
+		role:       strings.ToLower(role),
+		quantity:   t.Quantity,
+	}
+	if subject.text == "" && t.RecipeID != nil {
+		recipe, err := e.recipe(t)
+		if err != nil {
+			return nil, err
+		}
+		subject.text = recipe.Name
+	}
+	lookup := newMaterialLookup(e.materials)
+	consumed, err := e.consumption(t, lookup)
+	if err != nil {
+		return nil, err
+	}
+	components := append([]models.TransmutationComponent{}, consumed...)
+	if outcome != nil {
+		components = append(components, outcome.Inputs...)
+		components = append(components, outcome.Outputs...)
+	}
+	for _, c := range components {
+		if c.MaterialID == 0 || lookup.repo == nil {
+			continue
+		}
+		m, err := lookup.findByID(c.MaterialID)
+		if err != nil {
+			return nil, err
+		}
+		if m != nil && m.Category != "" {
+			subject.categories[strings.ToLower(m.Category)] = m.Category
+		}
+	}
+
+	hits := []models.RuleHit{}
+	for _, rule := range rules {
+		reason, ok, err := matchRule(rule, subject)
+		if err != nil {
+			return nil, fmt.Errorf("rule %q: %w", rule.Name, err)
+		}
+		if ok {
+			hits = append(hits, models.RuleHit{RuleID: rule.ID, Rule: rule.Name, Action: rule.Action, Reason: reason})
+		}
+	}
+	return hits, nil
+}
+
+// CheckRules devuelve un *RuleError si alguna regla que coincidió bloquea la transmutación.
+func (e *Engine) CheckRules(outcome *models.TransmutationOutcome) error {
+	if outcome == nil {
+		return nil
+	}
+	blocking := []models.RuleHit{}
+	for _, hit := range outcome.Rules {
+		if hit.Action == models.RuleActionBlock {
+			blocking = append(blocking, hit)
+		}
+	}
+	if len(blocking) > 0 {
+		return &RuleError{Hits: blocking}
+	}
+	return nil
+}
+
+func (e *Engine) recipe(t *models.Transmutation) (*models.Recipe, error) {
+	if t.Recipe != nil {
+		return t.Recipe, nil
+	}
+	if e.recipes == nil {
+		return nil, repository.ErrRecipeNotFound
+	}
+	recipe, err := e.recipes.FindById(int(*t.RecipeID))
+	if err != nil {
+		return nil, err
+	}
+	if recipe == nil {
+		return nil, repository.ErrRecipeNotFound
+	}
+	t.Recipe = recipe
+	return recipe, nil
+}
+
+// consumption devuelve lo que la transmutación descuenta del inventario: lo
+// ya reservado si existe o, antes de crearla, lo que reservaría (con fórmula,
+// todos sus reactivos).
+func (e *Engine) consumption(t *models.Transmutation, lookup *materialLookup) ([]models.TransmutationComponent, error) {
+	consumed := []models.TransmutationComponent{}
+	switch {
+	case len(t.Inputs) > 0:
+		for _, in := range t.Inputs {
+			consumed = append(consumed, models.TransmutationComponent{MaterialID: in.MaterialID, Quantity: in.Quantity})
+		}
+	case t.RecipeID != nil:
+		recipe, err := e.recipe(t)
+		if err != nil {
+			return nil, err
+		}
+		for _, in := range recipe.Inputs {
+			consumed = append(consumed, models.TransmutationComponent{MaterialID: in.MaterialID, Quantity: in.Quantity * t.Quantity})
+		}
+	case strings.TrimSpace(t.Formula) != "":
+		parsed, err := formula.Parse(t.Formula)
+		if err != nil {
+			return nil, err
+		}
+		evaluation, err := parsed.Evaluate(t.Quantity)
+		if err != nil {
+			return nil, err
+		}
+		for _, in := range evaluation.Inputs {
+			consumed = append(consumed, models.TransmutationComponent{Material: in.Material, Quantity: in.Quantity})
+		}
+	default:
+		consumed = append(consumed, models.TransmutationComponent{MaterialID: t.MaterialID, Quantity: t.Quantity})
+	}
+	if err := lookup.resolve(consumed); err != nil {
+		return nil, err
+	}
+	return consumed, nil
+}
+
+func outcomeFromRecipe(recipe *models.Recipe, batches float64, at time.Time) *models.TransmutationOutcome {
+	outcome := &models.TransmutationOutcome{
+		Batches:     batches,
+		Yield:       1,
+		CompletedAt: at,
+	}
+	for _, in := range recipe.Inputs {
+		outcome.Inputs = append(outcome.Inputs, models.TransmutationComponent{
+			MaterialID: in.MaterialID,
+			Material:   materialName(in.Material, in.MaterialID),
+			Quantity:   in.Quantity * batches,
+		})
+	}
+	for _, out := range recipe.Outputs {
+		outcome.Outputs = append(outcome.Outputs, models.TransmutationComponent{
+			MaterialID: out.MaterialID,
+			Material:   materialName(out.Material, out.MaterialID),
+			Quantity:   out.Quantity * batches,
+		})
+	}
+	return outcome
+}
+
+// outcomeFromSnapshot construye el resultado de una transmutación con receta
+// a partir de lo que copió al crearse, sin volver a leer la receta.
+func outcomeFromSnapshot(t *models.Transmutation, at time.Time) *models.TransmutationOutcome {
+	outcome := &models.TransmutationOutcome{
+		Batches:     t.Quantity,
+		Yield:       1,
+		CompletedAt: at,
+	}
+	for _, in := range t.Inputs {
+		outcome.Inputs = append(outcome.Inputs, models.TransmutationComponent{
+			MaterialID: in.MaterialID,
+			Material:   materialName(nil, in.MaterialID),
+			Quantity:   in.Quantity,
+		})
+	}
+	for _, out := range t.Outputs {
+		outcome.Outputs = append(outcome.Outputs, models.TransmutationComponent{
+			MaterialID: out.MaterialID,
+			Material:   materialName(nil, out.MaterialID),
+			Quantity:   out.Quantity,
+		})
+	}
+	return outcome
+}
+
+func outcomeFromEvaluation(res *formula.Result, at time.Time) *models.TransmutationOutcome {
+	outcome := &models.TransmutationOutcome{
+		Batches:     res.Batches,
+		Yield:       res.Yield,
+		CompletedAt: at,
+	}
+	for _, in := range res.Inputs {
+		outcome.Inputs = append(outcome.Inputs, models.TransmutationComponent{Material: in.Material, Quantity: in.Quantity})
+	}
+	for _, out := range res.Outputs {
+		outcome.Outputs = append(outcome.Outputs, models.TransmutationComponent{Material: out.Material, Quantity: out.Quantity})
+	}
+	return outcome
+}
+
+func materialName(m *models.Material, id uint) string {
+	if m != nil {
+		return m.Name
+	}
+	return fmt.Sprintf("material #%d", id)
+}
+
+// materialLookup cachea las consultas de materiales durante una evaluación.
+type materialLookup struct {
+	repo   *repository.MaterialRepository
+	byID   map[uint]*models.Material
+	byName map[string]*models.Material
+}
+
+func newMaterialLookup(repo *repository.MaterialRepository) *materialLookup {
+	return &materialLookup{
+		repo:   repo,
+		byID:   map[uint]*models.Material{},
+		byName: map[string]*models.Material{},
+	}
+}
+
+// resolve completa ID, nombre y valor energético de cada componente conocido.
+// Los productos de fórmula sin material registrado se dejan sin ID ni valor.
+func (l *materialLookup) resolve(components []models.TransmutationComponent) error {
+	if l.repo == nil {
+		return nil
+	}
+	for i := range components {
+		c := &components[i]
+		var (
+			m   *models.Material
+			err error
+		)
+		if c.MaterialID != 0 {
+			m, err = l.findByID(c.MaterialID)
+		} else {
+			m, err = l.findByName(c.Material)
+		}
+		if err != nil {
+			return err
+		}
+		if m == nil {
+			continue
+		}
+		c.MaterialID = m.ID
+		c.Material = m.Name
+		c.EnergyValue = m.EnergyValue
+	}
+	return nil
+}
+
+func (l *materialLookup) findByID(id uint) (*models.Material, error) {
+	if m, ok := l.byID[id]; ok {
+		return m, nil
+	}
+	m, err := l.repo.FindById(int(id))
+	if err != nil {
+		return nil, err
+	}
+	l.byID[id] = m
+	return m, nil
+}
+
+func (l *materialLookup) findByName(name string) (*models.Material, error) {
+	if m, ok := l.byName[name]; ok {
+		return m, nil
+	}
+	m, err := l.repo.FindByName(name)
+	if err != nil {
+		return nil, err
+	}
+	l.byName[name] = m
+	return m, nil
+}
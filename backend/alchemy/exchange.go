@@ -0,0 +1,131 @@
+package alchemy
+
+import (
+	"backend-avanzada/models"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+const (
+	// ExchangeModeReject rechaza las transmutaciones que violan el intercambio equivalente.
+	ExchangeModeReject = "reject"
+	// ExchangeModeFlag las deja continuar, pero registra la violación en auditoría.
+	ExchangeModeFlag = "flag"
+)
+
+var (
+	ErrEquivalentExchange = errors.New("equivalent exchange violated")
+	ErrUnvaluedMaterial   = errors.New("materials without registered energy value")
+)
+
+// ExchangePolicy define cuánto pueden superar los productos a los reactivos.
+type ExchangePolicy struct {
+	Tolerance float64
+	Mode      string
+}
+
+// Rejects indica si las violaciones deben bloquear la transmutación.
+func (p ExchangePolicy) Rejects() bool {
+	return p.Mode == ExchangeModeReject
+}
+
+// Balance calcula el valor de masa/energía de entradas y salidas y marca la
+// violación cuando las salidas superan a las entradas más la tolerancia.
+func (p ExchangePolicy) Balance(inputs, outputs []models.TransmutationComponent) *models.ExchangeBalance {
+	in := componentsValue(inputs)
+	out := componentsValue(outputs)
+	return &models.ExchangeBalance{
+		InputValue:  round(in),
+		OutputValue: round(out),
+		Imbalance:   round(out - in),
+		Tolerance:   p.Tolerance,
+		Violated:    out > in*(1+p.Tolerance)+1e-9,
+	}
+}
+
+// unvalued lista los componentes sin energy_value: materiales sin registrar
+// (salvo los productos nuevos ya valorados por valueNewProducts) o con valor
+// nulo. Con ellos el balance no significa nada.
+func unvalued(groups ...[]models.TransmutationComponent) []string {
+	seen := map[string]bool{}
+	names := []string{}
+	for _, components := range groups {
+		for _, c := range components {
+			if c.EnergyValue > 0 {
+				continue
+			}
+			name := c.Material
+			if name == "" {
+				name = "#" + strconv.FormatUint(uint64(c.MaterialID), 10)
+			}
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// valueNewProducts da a los productos de una fórmula que aún no existen como
+// material el valor que conserva el intercambio: lo que aportan los reactivos
+// menos lo que se llevan los productos registrados, repartido por cantidad.
+// Con ese valor se dan de alta al completarse la transmutación. Si no queda
+// valor que repartir se quedan sin él y unvalued los rechaza.
+func valueNewProducts(inputs, outputs []models.TransmutationComponent) {
+	remaining := componentsValue(inputs)
+	quantity := 0.0
+	for _, c := range outputs {
+		if c.MaterialID == 0 {
+			quantity += c.Quantity
+		} else {
+			remaining -= c.Quantity * c.EnergyValue
+		}
+	}
+	if quantity <= 0 || remaining <= 1e-9 {
+		return
+	}
+	value := round(remaining / quantity)
+	for i := range outputs {
+		if outputs[i].MaterialID == 0 {
+			outputs[i].EnergyValue = value
+		}
+	}
+}
+
+func componentsValue(components []models.TransmutationComponent) float64 {
+	total := 0.0
+	for _, c := range components {
+		total += c.Quantity * c.EnergyValue
+	}
+	return total
+}
+
+// ExchangeError acompaña a ErrEquivalentExchange con el balance calculado.
+type ExchangeError struct {
+	Balance *models.ExchangeBalance
+}
+
+func (e *ExchangeError) Error() string {
+	return fmt.Sprintf("%v: %s", ErrEquivalentExchange, DescribeBalance(e.Balance))
+}
+
+func (e *ExchangeError) Unwrap() error {
+	return ErrEquivalentExchange
+}
+
+// DescribeBalance resume el balance para mensajes de error y auditorías.
+func DescribeBalance(b *models.ExchangeBalance) string {
+	return fmt.Sprintf("outputs worth %s exceed inputs worth %s (imbalance %+g, tolerance %s%%)",
+		strconv.FormatFloat(b.OutputValue, 'f', -1, 64),
+		strconv.FormatFloat(b.InputValue, 'f', -1, 64),
+		b.Imbalance,
+		strconv.FormatFloat(b.Tolerance*100, 'f', -1, 64),
+	)
+}
+
+func round(v float64) float64 {
+	return math.Round(v*1e6) / 1e6
+}
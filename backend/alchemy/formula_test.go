@@ -0,0 +1,150 @@
+package alchemy
+
+import (
+	"backend-avanzada/models"
+	"backend-avanzada/repository"
+	"errors"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestEngine abre una base en memoria con los materiales dados.
+func newTestEngine(t *testing.T, materials ...*models.Material) *Engine {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Cada conexión a :memory: es una base distinta.
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	if err := db.AutoMigrate(&models.Material{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range materials {
+		if err := db.Create(m).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	return NewEngine(repository.NewMaterialRepository(db), nil)
+}
+
+func TestEvaluateChecksReactants(t *testing.T) {
+	mercury := &models.Material{Name: "Mercury", Quantity: 10, EnergyValue: 2}
+	sulfur := &models.Material{Name: "Sulfur", Quantity: 10, EnergyValue: 1}
+	gold := &models.Material{Name: "Gold", EnergyValue: 1}
+	engine := newTestEngine(t, mercury, sulfur, gold)
+
+	tests := []struct {
+		name       string
+		formula    string
+		materialID uint
+		wantErr    error
+	}{
+		{name: "single reactant", formula: "Mercury -> Gold", materialID: mercury.ID},
+		{name: "case-insensitive", formula: "mercury + Sulfur -> Gold", materialID: mercury.ID},
+		{name: "second reactant", formula: "Mercury + Sulfur -> Gold", materialID: sulfur.ID},
+		{name: "material only among products", formula: "Mercury -> Sulfur", materialID: sulfur.ID, wantErr: ErrReactantMismatch},
+		{name: "unrelated formula", formula: "Lead -> Gold", materialID: mercury.ID, wantErr: ErrReactantMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tm := &models.Transmutation{MaterialID: tt.materialID, Formula: tt.formula, Quantity: 1}
+			_, err := engine.Evaluate(tm, time.Now())
+			if tt.wantErr == nil && err != nil && errors.Is(err, ErrReactantMismatch) {
+				t.Fatalf("Evaluate(%q) = %v, want no reactant mismatch", tt.formula, err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Evaluate(%q) = %v, want %v", tt.formula, err, tt.wantErr)
+			}
+			if err := engine.CheckReactants(tm); !errors.Is(err, tt.wantErr) {
+				t.Errorf("CheckReactants(%q) = %v, want %v", tt.formula, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEvaluateRejectsUnvaluedMaterials(t *testing.T) {
+	mercury := &models.Material{Name: "Mercury", Quantity: 10, EnergyValue: 2}
+	lead := &models.Material{Name: "Lead", Quantity: 10}
+	gold := &models.Material{Name: "Gold", EnergyValue: 1}
+	engine := newTestEngine(t, mercury, lead, gold)
+
+	tests := []struct {
+		name       string
+		formula    string
+		materialID uint
+		wantErr    error
+	}{
+		{name: "valued", formula: "Mercury -> Gold", materialID: mercury.ID},
+		{name: "unregistered product", formula: "Mercury -> Silver", materialID: mercury.ID},
+		{name: "unregistered reactant", formula: "Mercury + Salt -> Gold", materialID: mercury.ID, wantErr: ErrUnvaluedMaterial},
+		{name: "nothing left for the new product", formula: "Mercury -> 2 Gold + Silver", materialID: mercury.ID, wantErr: ErrUnvaluedMaterial},
+		{name: "zero-value reactant", formula: "Lead -> Gold", materialID: lead.ID, wantErr: ErrUnvaluedMaterial},
+		{name: "zero-value product", formula: "Mercury -> Lead", materialID: mercury.ID, wantErr: ErrUnvaluedMaterial},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tm := &models.Transmutation{MaterialID: tt.materialID, Formula: tt.formula, Quantity: 1}
+			if _, err := engine.Evaluate(tm, time.Now()); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Evaluate(%q) = %v, want %v", tt.formula, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEvaluateBalancesEveryReactant(t *testing.T) {
+	mercury := &models.Material{Name: "Mercury", Quantity: 10, EnergyValue: 2}
+	sulfur := &models.Material{Name: "Sulfur", Quantity: 10, EnergyValue: 1}
+	cinnabar := &models.Material{Name: "Cinnabar", EnergyValue: 1}
+	engine := newTestEngine(t, mercury, sulfur, cinnabar)
+
+	// 3 unidades se reparten 2 de Mercury (valor 4) y 1 de Sulfur (valor 1).
+	tm := &models.Transmutation{MaterialID: mercury.ID, Formula: "2 Mercury + Sulfur -> 3 Cinnabar", Quantity: 3}
+	outcome, err := engine.Evaluate(tm, time.Now())
+	if err != nil {
+		t.Fatalf("Evaluate: %v", err)
+	}
+	if outcome.Exchange.InputValue != 5 {
+		t.Errorf("input value = %v, want 5", outcome.Exchange.InputValue)
+	}
+	if outcome.Exchange.OutputValue != 3 {
+		t.Errorf("output value = %v, want 3", outcome.Exchange.OutputValue)
+	}
+}
+
+func TestEvaluateValuesNewProducts(t *testing.T) {
+	mercury := &models.Material{Name: "Mercury", Quantity: 10, EnergyValue: 2}
+	gold := &models.Material{Name: "Gold", EnergyValue: 1}
+	engine := newTestEngine(t, mercury, gold)
+
+	tm := &models.Transmutation{MaterialID: mercury.ID, Formula: "2 Mercury -> Gold + 3 Silver", Quantity: 2}
+	outcome, err := engine.Evaluate(tm, time.Now())
+	if err != nil {
+		t.Fatalf("Evaluate: %v", err)
+	}
+	silver := 0
+	for _, out := range outcome.Outputs {
+		if out.Material != "Silver" {
+			continue
+		}
+		silver++
+		if out.MaterialID != 0 || out.EnergyValue != 1 {
+			t.Errorf("Silver: material %d energy value %v, want unregistered worth 1", out.MaterialID, out.EnergyValue)
+		}
+	}
+	if silver != 1 {
+		t.Fatalf("outputs %+v, want one Silver", outcome.Outputs)
+	}
+	if outcome.Exchange.Violated || outcome.Exchange.Imbalance != 0 {
+		t.Errorf("exchange %+v, want balanced", outcome.Exchange)
+	}
+}
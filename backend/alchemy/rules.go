@@ -0,0 +1,167 @@
+package alchemy
+
+import (
+	"backend-avanzada/models"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var ErrForbiddenTransmutation = errors.New("transmutation forbidden by rule")
+
+// RuleError acompaña a ErrForbiddenTransmutation con las reglas que bloquean.
+type RuleError struct {
+	Hits []models.RuleHit
+}
+
+func (e *RuleError) Error() string {
+	parts := make([]string, 0, len(e.Hits))
+	for _, hit := range e.Hits {
+		parts = append(parts, DescribeRuleHit(hit))
+	}
+	return fmt.Sprintf("%v %s", ErrForbiddenTransmutation, strings.Join(parts, "; "))
+}
+
+func (e *RuleError) Unwrap() error {
+	return ErrForbiddenTransmutation
+}
+
+// DescribeRuleHit nombra la regla y el motivo para mensajes y auditorías.
+func DescribeRuleHit(hit models.RuleHit) string {
+	return fmt.Sprintf("%q (%s): %s", hit.Rule, hit.Action, hit.Reason)
+}
+
+// ValidateRule normaliza la regla y comprueba su acción y sus criterios.
+func ValidateRule(rule *models.TransmutationRule) error {
+	rule.Name = strings.TrimSpace(rule.Name)
+	if rule.Name == "" {
+		return errors.New("name required")
+	}
+	rule.Action = strings.ToLower(strings.TrimSpace(rule.Action))
+	if !models.IsRuleAction(rule.Action) {
+		return errors.New("action must be block, require_approval or flag")
+	}
+	rule.FormulaPattern = strings.TrimSpace(rule.FormulaPattern)
+	if rule.FormulaPattern != "" {
+		if _, err := compileRulePattern(rule.FormulaPattern); err != nil {
+			return fmt.Errorf("invalid formula pattern: %w", err)
+		}
+	}
+	rule.Categories = cleanRuleList(rule.Categories, false)
+	rule.Roles = cleanRuleList(rule.Roles, true)
+	if rule.MinQuantity != nil && *rule.MinQuantity < 0 || rule.MaxQuantity != nil && *rule.MaxQuantity < 0 {
+		return errors.New("quantity bounds must not be negative")
+	}
+	if rule.MinQuantity != nil && rule.MaxQuantity != nil && *rule.MinQuantity > *rule.MaxQuantity {
+		return errors.New("min_quantity must not exceed max_quantity")
+	}
+	if rule.FormulaPattern == "" && len(rule.Categories) == 0 && len(rule.Roles) == 0 &&
+		rule.MinQuantity == nil && rule.MaxQuantity == nil {
+		return errors.New("at least one criterion is required")
+	}
+	return nil
+}
+
+// rulePatterns guarda cada patrón ya compilado: se compila al validar la regla
+// (al cargarla o guardarla) y las evaluaciones reutilizan el resultado.
+var (
+	rulePatternsMu sync.RWMutex
+	rulePatterns   = map[string]*regexp.Regexp{}
+)
+
+func compileRulePattern(pattern string) (*regexp.Regexp, error) {
+	rulePatternsMu.RLock()
+	re, ok := rulePatterns[pattern]
+	rulePatternsMu.RUnlock()
+	if ok {
+		return re, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	rulePatternsMu.Lock()
+	rulePatterns[pattern] = re
+	rulePatternsMu.Unlock()
+	return re, nil
+}
+
+func cleanRuleList(values []string, lower bool) []string {
+	cleaned := []string{}
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if lower {
+			v = strings.ToLower(v)
+		}
+		if v != "" {
+			cleaned = append(cleaned, v)
+		}
+	}
+	return cleaned
+}
+
+// ruleSubject reúne lo que las reglas pueden inspeccionar de una transmutación.
+type ruleSubject struct {
+	text       string
+	categories map[string]string
+	role       string
+	quantity   float64
+}
+
+// matchRule indica si se cumplen todos los criterios de la regla y describe cuáles.
+func matchRule(rule *models.TransmutationRule, s ruleSubject) (string, bool, error) {
+	reasons := []string{}
+	if rule.FormulaPattern != "" {
+		re, err := compileRulePattern(rule.FormulaPattern)
+		if err != nil {
+			return "", false, err
+		}
+		if !re.MatchString(s.text) {
+			return "", false, nil
+		}
+		reasons = append(reasons, fmt.Sprintf("formula matches %q", rule.FormulaPattern))
+	}
+	if len(rule.Categories) > 0 {
+		matched := ""
+		for _, category := range rule.Categories {
+			if label, ok := s.categories[strings.ToLower(category)]; ok {
+				matched = label
+				break
+			}
+		}
+		if matched == "" {
+			return "", false, nil
+		}
+		reasons = append(reasons, "category "+matched)
+	}
+	if len(rule.Roles) > 0 {
+		matched := false
+		for _, role := range rule.Roles {
+			if role == s.role {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return "", false, nil
+		}
+		reasons = append(reasons, "role "+s.role)
+	}
+	quantity := strconv.FormatFloat(s.quantity, 'f', -1, 64)
+	if rule.MinQuantity != nil {
+		if s.quantity < *rule.MinQuantity {
+			return "", false, nil
+		}
+		reasons = append(reasons, fmt.Sprintf("quantity %s >= %s", quantity, strconv.FormatFloat(*rule.MinQuantity, 'f', -1, 64)))
+	}
+	if rule.MaxQuantity != nil {
+		if s.quantity > *rule.MaxQuantity {
+			return "", false, nil
+		}
+		reasons = append(reasons, fmt.Sprintf("quantity %s <= %s", quantity, strconv.FormatFloat(*rule.MaxQuantity, 'f', -1, 64)))
+	}
+	return strings.Join(reasons, ", "), true, nil
+}
@@ -5,6 +5,7 @@ type AlchemistRequestDto struct {
 	Age       int32  `json:"age"`
 	Specialty string `json:"specialty"`
 	Rank      string `json:"rank"`
+	UserID    *uint  `json:"user_id,omitempty"`
 }
 
 type AlchemistEditRequestDto struct {
@@ -12,6 +13,8 @@ type AlchemistEditRequestDto struct {
 	Age       *int32  `json:"age,omitempty"`
 	Specialty *string `json:"specialty,omitempty"`
 	Rank      *string `json:"rank,omitempty"`
+	// UserID enlaza la cuenta del alquimista; 0 la desenlaza.
+	UserID *uint `json:"user_id,omitempty"`
 }
 
 type AlchemistResponseDto struct {
@@ -20,5 +23,6 @@ type AlchemistResponseDto struct {
 	Age       int    `json:"age"`
 	Specialty string `json:"specialty"`
 	Rank      string `json:"rank"`
+	UserID    *uint  `json:"user_id,omitempty"`
 	CreatedAt string `json:"created_at"`
 }
@@ -0,0 +1,42 @@
+package api
+
+type FormulaRequestDto struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Body        string `json:"body"`
+	Notes       string `json:"notes,omitempty"`
+}
+
+// FormulaEditRequestDto actualiza una fórmula del catálogo. Un Body distinto
+// del vigente publica una versión nueva; Notes la describe.
+type FormulaEditRequestDto struct {
+	Name              *string `json:"name,omitempty"`
+	Description       *string `json:"description,omitempty"`
+	Body              *string `json:"body,omitempty"`
+	Notes             string  `json:"notes,omitempty"`
+	Deprecated        *bool   `json:"deprecated,omitempty"`
+	DeprecationReason *string `json:"deprecation_reason,omitempty"`
+}
+
+type FormulaVersionResponseDto struct {
+	FormulaID uint   `json:"formula_id"`
+	Version   int    `json:"version"`
+	Body      string `json:"body"`
+	Author    string `json:"author"`
+	Notes     string `json:"notes,omitempty"`
+	CreatedAt string `json:"created_at"`
+}
+
+type FormulaResponseDto struct {
+	ID                uint                        `json:"id"`
+	Name              string                      `json:"name"`
+	Description       string                      `json:"description"`
+	Author            string                      `json:"author"`
+	LatestVersion     int                         `json:"latest_version"`
+	Body              string                      `json:"body"`
+	Deprecated        bool                        `json:"deprecated"`
+	DeprecationReason string                      `json:"deprecation_reason,omitempty"`
+	Versions          []FormulaVersionResponseDto `json:"versions,omitempty"`
+	CreatedAt         string                      `json:"created_at"`
+	UpdatedAt         string                      `json:"updated_at"`
+}
@@ -0,0 +1,61 @@
+package api
+
+type LocationRequestDto struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// IsDefault la convierte en la predeterminada en lugar de la actual.
+	IsDefault bool `json:"is_default"`
+}
+
+type LocationEditRequestDto struct {
+	Name        *string `json:"name,omitempty"`
+	Description *string `json:"description,omitempty"`
+	// Solo puede ponerse a true: deja de ser predeterminada al marcar otra.
+	IsDefault *bool `json:"is_default,omitempty"`
+}
+
+type LocationResponseDto struct {
+	ID          uint   `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	IsDefault   bool   `json:"is_default"`
+	CreatedAt   string `json:"created_at"`
+}
+
+// MaterialStockDto es la existencia de un material en una ubicación.
+type MaterialStockDto struct {
+	MaterialID uint    `json:"material_id"`
+	Material   string  `json:"material,omitempty"`
+	LocationID uint    `json:"location_id"`
+	Location   string  `json:"location,omitempty"`
+	Unit       string  `json:"unit,omitempty"`
+	Quantity   float64 `json:"quantity"`
+	Reserved   float64 `json:"reserved"`
+	Available  float64 `json:"available"`
+}
+
+type StockTransferRequestDto struct {
+	MaterialID     uint    `json:"material_id"`
+	FromLocationID uint    `json:"from_location_id"`
+	ToLocationID   uint    `json:"to_location_id"`
+	Quantity       float64 `json:"quantity"`
+	QuantityUnit   string  `json:"quantity_unit,omitempty"`
+	// LotID traslada (parte de) ese lote; sin él se mueve existencia sin lote.
+	LotID  *uint  `json:"lot_id,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+type StockTransferResponseDto struct {
+	ID             uint    `json:"id"`
+	MaterialID     uint    `json:"material_id"`
+	Material       string  `json:"material,omitempty"`
+	FromLocationID uint    `json:"from_location_id"`
+	FromLocation   string  `json:"from_location,omitempty"`
+	ToLocationID   uint    `json:"to_location_id"`
+	ToLocation     string  `json:"to_location,omitempty"`
+	LotID          *uint   `json:"lot_id,omitempty"`
+	Quantity       float64 `json:"quantity"`
+	Actor          string  `json:"actor,omitempty"`
+	Reason         string  `json:"reason,omitempty"`
+	CreatedAt      string  `json:"created_at"`
+}
@@ -1,21 +1,119 @@
 package api
 
+import "time"
+
 type MaterialRequestDto struct {
-	Name     string  `json:"name"`
-	Category string  `json:"category"`
-	Quantity float64 `json:"quantity"`
+	Name        string  `json:"name"`
+	Category    string  `json:"category"`
+	Quantity    float64 `json:"quantity"`
+	EnergyValue float64 `json:"energy_value"`
+	// Unit declara la unidad base; QuantityUnit, si se indica, es la unidad
+	// en que viene Quantity y se convierte a la base.
+	Unit         string  `json:"unit,omitempty"`
+	Density      float64 `json:"density,omitempty"`
+	QuantityUnit string  `json:"quantity_unit,omitempty"`
+	// ReorderLevel es el punto de pedido en la unidad base (0 = sin él) y
+	// ReorderQuantity lo que se pide al cruzarlo.
+	ReorderLevel    float64 `json:"reorder_level,omitempty"`
+	ReorderQuantity float64 `json:"reorder_quantity,omitempty"`
+	// LocationID es dónde se guarda la cantidad inicial (0 = la predeterminada).
+	LocationID uint `json:"location_id,omitempty"`
 }
 
 type MaterialResponseDto struct {
-	ID        int     `json:"id"`
-	Name      string  `json:"name"`
-	Category  string  `json:"category"`
-	Quantity  float64 `json:"quantity"`
-	CreatedAt string  `json:"created_at"`
+	ID          int     `json:"id"`
+	Name        string  `json:"name"`
+	Category    string  `json:"category"`
+	Quantity    float64 `json:"quantity"`
+	EnergyValue float64 `json:"energy_value"`
+	Unit        string  `json:"unit,omitempty"`
+	Density     float64 `json:"density,omitempty"`
+	// OnHand es la existencia física (igual que Quantity); Reserved, lo apartado
+	// por transmutaciones en curso, y Available, lo que aún puede reservarse.
+	OnHand    float64 `json:"on_hand"`
+	Reserved  float64 `json:"reserved"`
+	Available float64 `json:"available"`
+	// ReorderLevel 0 significa que el material no tiene punto de pedido.
+	ReorderLevel    float64 `json:"reorder_level"`
+	ReorderQuantity float64 `json:"reorder_quantity"`
+	CreatedAt       string  `json:"created_at"`
 }
 
 type MaterialEditRequestDto struct {
-	Name     *string  `json:"name,omitempty"`
-	Category *string  `json:"category,omitempty"`
-	Quantity *float64 `json:"quantity,omitempty"`
+	Name        *string  `json:"name,omitempty"`
+	Category    *string  `json:"category,omitempty"`
+	Quantity    *float64 `json:"quantity,omitempty"`
+	EnergyValue *float64 `json:"energy_value,omitempty"`
+	// Reason explica el ajuste de existencias cuando cambia Quantity.
+	Reason string `json:"reason,omitempty"`
+	// Unit solo puede declararse en materiales que aún no tienen unidad.
+	Unit         *string  `json:"unit,omitempty"`
+	Density      *float64 `json:"density,omitempty"`
+	QuantityUnit string   `json:"quantity_unit,omitempty"`
+	// ReorderLevel 0 quita el punto de pedido.
+	ReorderLevel    *float64 `json:"reorder_level,omitempty"`
+	ReorderQuantity *float64 `json:"reorder_quantity,omitempty"`
+	// LocationID es la ubicación donde se aplica la diferencia cuando cambia
+	// Quantity, que sigue siendo el total (0 = la predeterminada).
+	LocationID uint `json:"location_id,omitempty"`
+}
+
+// UnitDto es una entrada de la tabla de conversión: Factor es cuántas
+// unidades de referencia (g, ml o unit) equivalen a una de Symbol.
+type UnitDto struct {
+	Symbol    string  `json:"symbol"`
+	Dimension string  `json:"dimension"`
+	Factor    float64 `json:"factor"`
+}
+
+type StockMovementDto struct {
+	ID              uint    `json:"id"`
+	Kind            string  `json:"kind"`
+	Quantity        float64 `json:"quantity"`
+	Balance         float64 `json:"balance"`
+	TransmutationID *uint   `json:"transmutation_id,omitempty"`
+	LocationID      *uint   `json:"location_id,omitempty"`
+	Actor           string  `json:"actor,omitempty"`
+	Reason          string  `json:"reason,omitempty"`
+	CreatedAt       string  `json:"created_at"`
+}
+
+type MaterialMovementsDto struct {
+	MaterialID     uint               `json:"material_id"`
+	Material       string             `json:"material"`
+	Quantity       float64            `json:"quantity"`
+	Unit           string             `json:"unit,omitempty"`
+	LedgerQuantity float64            `json:"ledger_quantity"`
+	Discrepancy    float64            `json:"discrepancy"`
+	Reconciled     bool               `json:"reconciled"`
+	Movements      []StockMovementDto `json:"movements"`
+}
+
+type MaterialLotRequestDto struct {
+	LotNumber string `json:"lot_number"`
+	// ReceivedAt es ahora si no se indica; sin ExpiresAt el lote no caduca.
+	ReceivedAt   *time.Time `json:"received_at,omitempty"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	Quantity     float64    `json:"quantity"`
+	QuantityUnit string     `json:"quantity_unit,omitempty"`
+	// LocationID es dónde se guarda el lote (0 = la predeterminada).
+	LocationID uint `json:"location_id,omitempty"`
+}
+
+type MaterialLotEditRequestDto struct {
+	Quantity     float64 `json:"quantity"`
+	QuantityUnit string  `json:"quantity_unit,omitempty"`
+	Reason       string  `json:"reason,omitempty"`
+}
+
+type MaterialLotResponseDto struct {
+	ID         uint    `json:"id"`
+	MaterialID uint    `json:"material_id"`
+	LotNumber  string  `json:"lot_number"`
+	ReceivedAt string  `json:"received_at"`
+	ExpiresAt  string  `json:"expires_at,omitempty"`
+	Quantity   float64 `json:"quantity"`
+	LocationID uint    `json:"location_id"`
+	Expired    bool    `json:"expired"`
+	CreatedAt  string  `json:"created_at"`
 }
@@ -0,0 +1,46 @@
+package api
+
+type PipelineRequestDto struct {
+	Name   string                   `json:"name"`
+	UserID uint                     `json:"user_id,omitempty"`
+	Steps  []PipelineStepRequestDto `json:"steps"`
+}
+
+// PipelineStepRequestDto es una transmutación identificada por Key que
+// depende de los pasos listados en DependsOn.
+type PipelineStepRequestDto struct {
+	Key            string   `json:"key"`
+	DependsOn      []string `json:"depends_on"`
+	MaterialID     uint     `json:"material_id"`
+	RecipeID       uint     `json:"recipe_id,omitempty"`
+	Formula        string   `json:"formula"`
+	FormulaID      uint     `json:"formula_id,omitempty"`
+	FormulaVersion int      `json:"formula_version,omitempty"`
+	Quantity       float64  `json:"quantity"`
+	Unit           string   `json:"unit,omitempty"`
+}
+
+type PipelineResponseDto struct {
+	ID        uint                      `json:"id"`
+	Name      string                    `json:"name"`
+	UserID    uint                      `json:"user_id"`
+	Status    string                    `json:"status"`
+	Steps     []PipelineStepResponseDto `json:"steps"`
+	CreatedAt string                    `json:"created_at"`
+	UpdatedAt string                    `json:"updated_at"`
+}
+
+type PipelineStepResponseDto struct {
+	Key             string   `json:"key"`
+	DependsOn       []string `json:"depends_on"`
+	MaterialID      uint     `json:"material_id,omitempty"`
+	RecipeID        *uint    `json:"recipe_id,omitempty"`
+	Formula         string   `json:"formula"`
+	FormulaID       *uint    `json:"formula_id,omitempty"`
+	FormulaVersion  int      `json:"formula_version,omitempty"`
+	Quantity        float64  `json:"quantity"`
+	Unit            string   `json:"unit,omitempty"`
+	Status          string   `json:"status"`
+	TransmutationID *uint    `json:"transmutation_id,omitempty"`
+	Error           string   `json:"error,omitempty"`
+}
@@ -0,0 +1,73 @@
+package api
+
+import "time"
+
+type PurchaseOrderLineRequestDto struct {
+	MaterialID uint    `json:"material_id"`
+	Quantity   float64 `json:"quantity"`
+	// QuantityUnit, si se indica, se convierte a la unidad base del material.
+	QuantityUnit string  `json:"quantity_unit,omitempty"`
+	UnitPrice    float64 `json:"unit_price,omitempty"`
+}
+
+type PurchaseOrderRequestDto struct {
+	SupplierID uint                          `json:"supplier_id"`
+	Reference  string                        `json:"reference,omitempty"`
+	Notes      string                        `json:"notes,omitempty"`
+	Lines      []PurchaseOrderLineRequestDto `json:"lines"`
+	// LocationID es dónde se recibirá la mercancía (0 = la predeterminada).
+	LocationID uint `json:"location_id,omitempty"`
+}
+
+// PurchaseOrderEditRequestDto solo se acepta en DRAFT; Lines sustituye todas
+// las líneas si se envía.
+type PurchaseOrderEditRequestDto struct {
+	SupplierID *uint                         `json:"supplier_id,omitempty"`
+	Reference  *string                       `json:"reference,omitempty"`
+	Notes      *string                       `json:"notes,omitempty"`
+	Lines      []PurchaseOrderLineRequestDto `json:"lines,omitempty"`
+	// LocationID 0 vuelve a la ubicación predeterminada.
+	LocationID *uint `json:"location_id,omitempty"`
+}
+
+type PurchaseOrderLineResponseDto struct {
+	ID               uint    `json:"id"`
+	MaterialID       uint    `json:"material_id"`
+	Material         string  `json:"material,omitempty"`
+	Unit             string  `json:"unit,omitempty"`
+	Quantity         float64 `json:"quantity"`
+	ReceivedQuantity float64 `json:"received_quantity"`
+	Pending          float64 `json:"pending"`
+	UnitPrice        float64 `json:"unit_price,omitempty"`
+}
+
+type PurchaseOrderResponseDto struct {
+	ID         uint                           `json:"id"`
+	SupplierID uint                           `json:"supplier_id"`
+	Supplier   string                         `json:"supplier,omitempty"`
+	Reference  string                         `json:"reference,omitempty"`
+	Status     string                         `json:"status"`
+	Notes      string                         `json:"notes,omitempty"`
+	CreatedBy  string                         `json:"created_by,omitempty"`
+	LocationID *uint                          `json:"location_id,omitempty"`
+	Total      float64                        `json:"total"`
+	Lines      []PurchaseOrderLineResponseDto `json:"lines"`
+	SentAt     string                         `json:"sent_at,omitempty"`
+	ClosedAt   string                         `json:"closed_at,omitempty"`
+	CreatedAt  string                         `json:"created_at"`
+}
+
+type PurchaseOrderReceiptLineDto struct {
+	LineID uint `json:"line_id"`
+	// Sin Quantity se recibe lo pendiente de la línea.
+	Quantity     float64 `json:"quantity,omitempty"`
+	QuantityUnit string  `json:"quantity_unit,omitempty"`
+	// LotNumber, si se indica, registra la entrada como lote.
+	LotNumber string     `json:"lot_number,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// PurchaseOrderReceiveRequestDto sin líneas recibe todo lo pendiente.
+type PurchaseOrderReceiveRequestDto struct {
+	Lines []PurchaseOrderReceiptLineDto `json:"lines,omitempty"`
+}
@@ -0,0 +1,21 @@
+package api
+
+// QuotaUsageDto muestra una cuota efectiva: kind "material" limita lo consumido
+// por periodo y kind "active" las transmutaciones en curso.
+type QuotaUsageDto struct {
+	Kind       string  `json:"kind"`
+	Scope      string  `json:"scope"`
+	Material   string  `json:"material,omitempty"`
+	MaterialID uint    `json:"material_id,omitempty"`
+	Period     string  `json:"period,omitempty"`
+	Limit      float64 `json:"limit"`
+	Used       float64 `json:"used"`
+	Remaining  float64 `json:"remaining"`
+	ResetsAt   string  `json:"resets_at,omitempty"`
+}
+
+type QuotaSummaryDto struct {
+	UserID uint            `json:"user_id"`
+	Rank   string          `json:"rank,omitempty"`
+	Quotas []QuotaUsageDto `json:"quotas"`
+}
@@ -0,0 +1,35 @@
+package api
+
+type RecipeComponentDto struct {
+	MaterialID uint    `json:"material_id"`
+	Quantity   float64 `json:"quantity"`
+}
+
+type RecipeRequestDto struct {
+	Name        string               `json:"name"`
+	Description string               `json:"description"`
+	Inputs      []RecipeComponentDto `json:"inputs"`
+	Outputs     []RecipeComponentDto `json:"outputs"`
+}
+
+type RecipeEditRequestDto struct {
+	Name        *string               `json:"name,omitempty"`
+	Description *string               `json:"description,omitempty"`
+	Inputs      *[]RecipeComponentDto `json:"inputs,omitempty"`
+	Outputs     *[]RecipeComponentDto `json:"outputs,omitempty"`
+}
+
+type RecipeComponentResponseDto struct {
+	MaterialID   uint    `json:"material_id"`
+	MaterialName string  `json:"material_name"`
+	Quantity     float64 `json:"quantity"`
+}
+
+type RecipeResponseDto struct {
+	ID          int                          `json:"id"`
+	Name        string                       `json:"name"`
+	Description string                       `json:"description"`
+	Inputs      []RecipeComponentResponseDto `json:"inputs"`
+	Outputs     []RecipeComponentResponseDto `json:"outputs"`
+	CreatedAt   string                       `json:"created_at"`
+}
@@ -0,0 +1,41 @@
+package api
+
+import "time"
+
+type RestockRequestResponseDto struct {
+	ID               uint    `json:"id"`
+	MaterialID       uint    `json:"material_id"`
+	Material         string  `json:"material,omitempty"`
+	Unit             string  `json:"unit,omitempty"`
+	Quantity         float64 `json:"quantity"`
+	Status           string  `json:"status"`
+	Available        float64 `json:"available"`
+	Trigger          string  `json:"trigger,omitempty"`
+	ReviewedBy       string  `json:"reviewed_by,omitempty"`
+	Note             string  `json:"note,omitempty"`
+	ReceivedBy       string  `json:"received_by,omitempty"`
+	ReceivedQuantity float64 `json:"received_quantity,omitempty"`
+	ClosedAt         string  `json:"closed_at,omitempty"`
+	CreatedAt        string  `json:"created_at"`
+}
+
+type RestockApproveRequestDto struct {
+	// Quantity corrige la cantidad pedida; QuantityUnit es su unidad.
+	Quantity     *float64 `json:"quantity,omitempty"`
+	QuantityUnit string   `json:"quantity_unit,omitempty"`
+}
+
+type RestockReceiveRequestDto struct {
+	// Sin Quantity se recibe lo pedido.
+	Quantity     *float64 `json:"quantity,omitempty"`
+	QuantityUnit string   `json:"quantity_unit,omitempty"`
+	// LotNumber, si se indica, registra la entrada como lote.
+	LotNumber string     `json:"lot_number,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// LocationID es dónde se recibe (0 = la predeterminada).
+	LocationID uint `json:"location_id,omitempty"`
+}
+
+type RestockDismissRequestDto struct {
+	Reason string `json:"reason,omitempty"`
+}
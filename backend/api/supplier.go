@@ -0,0 +1,27 @@
+package api
+
+type SupplierRequestDto struct {
+	Name    string `json:"name"`
+	Email   string `json:"email"`
+	Phone   string `json:"phone"`
+	Address string `json:"address"`
+	Notes   string `json:"notes"`
+}
+
+type SupplierResponseDto struct {
+	ID        uint   `json:"id"`
+	Name      string `json:"name"`
+	Email     string `json:"email,omitempty"`
+	Phone     string `json:"phone,omitempty"`
+	Address   string `json:"address,omitempty"`
+	Notes     string `json:"notes,omitempty"`
+	CreatedAt string `json:"created_at"`
+}
+
+type SupplierEditRequestDto struct {
+	Name    *string `json:"name,omitempty"`
+	Email   *string `json:"email,omitempty"`
+	Phone   *string `json:"phone,omitempty"`
+	Address *string `json:"address,omitempty"`
+	Notes   *string `json:"notes,omitempty"`
+}
@@ -1,26 +1,174 @@
 package api
 
+import "time"
+
 type TransmutationRequestDto struct {
 	UserID     uint    `json:"user_id,omitempty"`
 	MaterialID uint    `json:"material_id"`
+	RecipeID   uint    `json:"recipe_id,omitempty"`
 	Formula    string  `json:"formula"`
 	Quantity   float64 `json:"quantity"`
+	// Unit es la unidad de Quantity; sin ella se entiende la unidad base del
+	// material. No se admite con receta, donde Quantity es el número de lotes.
+	Unit string `json:"unit,omitempty"`
+	// FormulaID toma la fórmula del catálogo en lugar de Formula; sin
+	// FormulaVersion se usa su versión vigente.
+	FormulaID      uint `json:"formula_id,omitempty"`
+	FormulaVersion int  `json:"formula_version,omitempty"`
+	// ScheduledAt difiere el procesamiento hasta esa hora (RFC 3339).
+	ScheduledAt *time.Time `json:"scheduled_at,omitempty"`
+	// LocationID es la ubicación de la que se toman los materiales; sin ella
+	// se elige la primera que tenga todo, empezando por la predeterminada.
+	LocationID uint `json:"location_id,omitempty"`
 }
 
 type TransmutationResponseDto struct {
-	ID         int     `json:"id"`
-	UserID     uint    `json:"user_id"`
+	ID             int                       `json:"id"`
+	UserID         uint                      `json:"user_id"`
+	MaterialID     uint                      `json:"material_id"`
+	RecipeID       *uint                     `json:"recipe_id,omitempty"`
+	BatchID        *uint                     `json:"batch_id,omitempty"`
+	PipelineID     *uint                     `json:"pipeline_id,omitempty"`
+	Formula        string                    `json:"formula"`
+	FormulaID      *uint                     `json:"formula_id,omitempty"`
+	FormulaVersion int                       `json:"formula_version,omitempty"`
+	Quantity       float64                   `json:"quantity"`
+	Unit           string                    `json:"unit,omitempty"`
+	LocationID     *uint                     `json:"location_id,omitempty"`
+	Status         string                    `json:"status"`
+	Result         string                    `json:"result"`
+	Attempts       int                       `json:"attempts"`
+	ScheduledAt    string                    `json:"scheduled_at,omitempty"`
+	ApprovalReason string                    `json:"approval_reason,omitempty"`
+	ReviewedBy     string                    `json:"reviewed_by,omitempty"`
+	ReviewComment  string                    `json:"review_comment,omitempty"`
+	Outcome        *TransmutationOutcomeDto  `json:"outcome,omitempty"`
+	Progress       *TransmutationProgressDto `json:"progress,omitempty"`
+	Inputs         []RecipeComponentDto      `json:"inputs"`
+	Lots           []TransmutationLotDrawDto `json:"lots,omitempty"`
+	CreatedAt      string                    `json:"created_at"`
+	UpdatedAt      string                    `json:"updated_at"`
+}
+
+// TransmutationLotDrawDto indica cuánto tomó un intento de un lote de material.
+type TransmutationLotDrawDto struct {
+	LotID      uint    `json:"lot_id"`
 	MaterialID uint    `json:"material_id"`
-	Formula    string  `json:"formula"`
 	Quantity   float64 `json:"quantity"`
-	Status     string  `json:"status"`
-	Result     string  `json:"result"`
-	CreatedAt  string  `json:"created_at"`
-	UpdatedAt  string  `json:"updated_at"`
+	Attempt    int     `json:"attempt"`
+}
+
+type TransmutationOutcomeDto struct {
+	Batches     float64                     `json:"batches"`
+	Yield       float64                     `json:"yield"`
+	Inputs      []TransmutationComponentDto `json:"inputs"`
+	Outputs     []TransmutationComponentDto `json:"outputs"`
+	Exchange    *ExchangeBalanceDto         `json:"exchange,omitempty"`
+	CompletedAt string                      `json:"completed_at"`
+}
+
+type TransmutationComponentDto struct {
+	MaterialID  uint    `json:"material_id,omitempty"`
+	Material    string  `json:"material"`
+	Quantity    float64 `json:"quantity"`
+	EnergyValue float64 `json:"energy_value,omitempty"`
+	Created     bool    `json:"created,omitempty"`
+}
+
+type ExchangeBalanceDto struct {
+	InputValue  float64 `json:"input_value"`
+	OutputValue float64 `json:"output_value"`
+	Imbalance   float64 `json:"imbalance"`
+	Tolerance   float64 `json:"tolerance"`
+	Violated    bool    `json:"violated"`
 }
 
 type TransmutationEditRequestDto struct {
 	Formula *string `json:"formula,omitempty"`
 	Status  *string `json:"status,omitempty"`
 	Result  *string `json:"result,omitempty"`
+	Reason  *string `json:"reason,omitempty"`
+}
+
+type TransmutationCancelRequestDto struct {
+	Reason string `json:"reason"`
+}
+
+type TransmutationTransitionDto struct {
+	ID              uint   `json:"id"`
+	TransmutationID uint   `json:"transmutation_id"`
+	FromStatus      string `json:"from_status"`
+	ToStatus        string `json:"to_status"`
+	Actor           string `json:"actor"`
+	Reason          string `json:"reason,omitempty"`
+	CreatedAt       string `json:"created_at"`
+}
+
+// TransmutationEstimateDto es la simulación de una transmutación sin reservar nada.
+type TransmutationEstimateDto struct {
+	Feasible                 bool                     `json:"feasible"`
+	Sufficient               bool                     `json:"sufficient"`
+	Materials                []StockProjectionDto     `json:"materials"`
+	Outcome                  *TransmutationOutcomeDto `json:"outcome"`
+	EstimatedDurationSeconds float64                  `json:"estimated_duration_seconds"`
+	DurationSamples          int                      `json:"duration_samples"`
+	Violations               []PolicyViolationDto     `json:"violations"`
+}
+
+type StockProjectionDto struct {
+	MaterialID uint    `json:"material_id"`
+	Material   string  `json:"material"`
+	LocationID uint    `json:"location_id"`
+	Available  float64 `json:"available"`
+	Required   float64 `json:"required"`
+	Remaining  float64 `json:"remaining"`
+	Sufficient bool    `json:"sufficient"`
+}
+
+type PolicyViolationDto struct {
+	Policy   string `json:"policy"`
+	Message  string `json:"message"`
+	Blocking bool   `json:"blocking"`
+}
+
+type TransmutationBatchRequestDto struct {
+	Mode  string                    `json:"mode"`
+	Items []TransmutationRequestDto `json:"items"`
+}
+
+type TransmutationBatchItemResultDto struct {
+	Index         int                       `json:"index"`
+	Status        int                       `json:"status"`
+	Error         string                    `json:"error,omitempty"`
+	Transmutation *TransmutationResponseDto `json:"transmutation,omitempty"`
+}
+
+type TransmutationBatchResponseDto struct {
+	ID             uint                              `json:"id"`
+	UserID         uint                              `json:"user_id"`
+	Mode           string                            `json:"mode"`
+	Total          int                               `json:"total"`
+	Progress       map[string]int                    `json:"progress"`
+	Results        []TransmutationBatchItemResultDto `json:"results,omitempty"`
+	Transmutations []*TransmutationResponseDto       `json:"transmutations,omitempty"`
+	CreatedAt      string                            `json:"created_at"`
+}
+
+type TransmutationScheduleRequestDto struct {
+	ScheduledAt *time.Time `json:"scheduled_at"`
+}
+
+type TransmutationReviewRequestDto struct {
+	Comment string `json:"comment"`
+}
+
+// TransmutationProgressDto es el payload de transmutation.progress y el último
+// avance que devuelve GET /transmutations/{id}.
+type TransmutationProgressDto struct {
+	TransmutationID uint   `json:"transmutation_id"`
+	Status          string `json:"status"`
+	Stage           string `json:"stage"`
+	Percent         int    `json:"percent"`
+	Message         string `json:"message,omitempty"`
+	UpdatedAt       string `json:"updated_at,omitempty"`
 }
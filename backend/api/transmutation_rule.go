@@ -0,0 +1,30 @@
+package api
+
+// TransmutationRuleRequestDto se usa tanto en la API como en el fichero de
+// reglas de la configuración. PUT reemplaza la regla completa.
+type TransmutationRuleRequestDto struct {
+	Name           string   `json:"name"`
+	Description    string   `json:"description"`
+	FormulaPattern string   `json:"formula_pattern"`
+	Categories     []string `json:"categories"`
+	Roles          []string `json:"roles"`
+	MinQuantity    *float64 `json:"min_quantity,omitempty"`
+	MaxQuantity    *float64 `json:"max_quantity,omitempty"`
+	Action         string   `json:"action"`
+	Enabled        *bool    `json:"enabled,omitempty"`
+}
+
+type TransmutationRuleResponseDto struct {
+	ID             uint     `json:"id"`
+	Name           string   `json:"name"`
+	Description    string   `json:"description"`
+	FormulaPattern string   `json:"formula_pattern,omitempty"`
+	Categories     []string `json:"categories"`
+	Roles          []string `json:"roles"`
+	MinQuantity    *float64 `json:"min_quantity,omitempty"`
+	MaxQuantity    *float64 `json:"max_quantity,omitempty"`
+	Action         string   `json:"action"`
+	Enabled        bool     `json:"enabled"`
+	CreatedAt      string   `json:"created_at"`
+	UpdatedAt      string   `json:"updated_at"`
+}
@@ -9,4 +9,32 @@ type Config struct {
 	VerificationIntervalMinutes int     `json:"verification_interval_minutes"`
 	PendingTransmutationHours   int     `json:"pending_transmutation_hours"`
 	MaterialLowStockThreshold   float64 `json:"material_low_stock_threshold"`
+	EquivalentExchangeTolerance float64 `json:"equivalent_exchange_tolerance"`
+	EquivalentExchangeMode      string  `json:"equivalent_exchange_mode"`
+	// Sin valor se usa alchemy.DefaultMaxRetries; 0 desactiva los reintentos.
+	MaxTransmutationRetries *int `json:"max_transmutation_retries"`
+	// Umbrales de consumo por categoría y patrones (regexp) de fórmulas que requieren aprobación.
+	ApprovalCategoryThresholds map[string]float64 `json:"approval_category_thresholds"`
+	ApprovalRestrictedFormulas []string           `json:"approval_restricted_formulas"`
+	// Fichero JSON con las reglas de transmutaciones prohibidas que se cargan al arrancar.
+	TransmutationRulesFile string  `json:"transmutation_rules_file"`
+	TransmutationQuotas    []Quota `json:"transmutation_quotas"`
+	// Horas durante las que se repite la respuesta a una petición con Idempotency-Key.
+	IdempotencyTTLHours int `json:"idempotency_ttl_hours"`
+	// Días de antelación con que la verificación diaria avisa de lotes que caducan.
+	LotExpiryWarningDays int `json:"lot_expiry_warning_days"`
+	// Segundos sin cambios tras los que el reaper da por atascada una
+	// transmutación en PROCESSING; debe superar kill_duration. 0 lo desactiva.
+	ReaperStuckAfterSeconds int `json:"reaper_stuck_after_seconds"`
+}
+
+// Quota se aplica a un usuario (email) o a un rango. Con material limita lo
+// consumido por periodo ("day" o "week"); sin él, las transmutaciones en curso.
+type Quota struct {
+	Email       string  `json:"email,omitempty"`
+	Rank        string  `json:"rank,omitempty"`
+	Material    string  `json:"material,omitempty"`
+	Period      string  `json:"period,omitempty"`
+	MaxQuantity float64 `json:"max_quantity,omitempty"`
+	MaxActive   int     `json:"max_active,omitempty"`
 }
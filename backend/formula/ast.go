@@ -0,0 +1,17 @@
+package formula
+
+// Term es un material acompañado de su coeficiente estequiométrico.
+type Term struct {
+	Coefficient float64
+	Material    string
+	Pos         int
+}
+
+// Formula es el árbol sintáctico de una transmutación:
+// reactivos -> productos [@ rendimiento].
+type Formula struct {
+	Reactants []Term
+	Products  []Term
+	// Yield es la eficiencia de la transmutación en el rango (0, 1].
+	Yield float64
+}
@@ -0,0 +1,48 @@
+package formula
+
+import (
+	"errors"
+	"math"
+)
+
+// Quantity es la cantidad calculada para un material de la fórmula.
+type Quantity struct {
+	Material string  `json:"material"`
+	Quantity float64 `json:"quantity"`
+}
+
+// Result es el resultado de evaluar una fórmula sobre una cantidad de entrada.
+type Result struct {
+	Batches float64    `json:"batches"`
+	Yield   float64    `json:"yield"`
+	Inputs  []Quantity `json:"inputs"`
+	Outputs []Quantity `json:"outputs"`
+}
+
+// Evaluate reparte la cantidad de entrada entre los reactivos según sus
+// coeficientes y calcula los productos aplicando el rendimiento.
+func (f *Formula) Evaluate(input float64) (*Result, error) {
+	if input <= 0 {
+		return nil, errors.New("formula: input quantity must be greater than zero")
+	}
+	total := 0.0
+	for _, t := range f.Reactants {
+		total += t.Coefficient
+	}
+	if total <= 0 {
+		return nil, errors.New("formula: reactants have no mass")
+	}
+	batches := input / total
+	res := &Result{Batches: round(batches), Yield: f.Yield}
+	for _, t := range f.Reactants {
+		res.Inputs = append(res.Inputs, Quantity{Material: t.Material, Quantity: round(t.Coefficient * batches)})
+	}
+	for _, t := range f.Products {
+		res.Outputs = append(res.Outputs, Quantity{Material: t.Material, Quantity: round(t.Coefficient * batches * f.Yield)})
+	}
+	return res, nil
+}
+
+func round(v float64) float64 {
+	return math.Round(v*1e6) / 1e6
+}
@@ -0,0 +1,210 @@
+package formula
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestLex(t *testing.T) {
+	tests := []struct {
+		name  string
+		src   string
+		kinds []tokenKind
+		texts []string
+	}{
+		{
+			name:  "simple",
+			src:   "Hg -> Au",
+			kinds: []tokenKind{tokenIdent, tokenArrow, tokenIdent, tokenEOF},
+			texts: []string{"Hg", "->", "Au", ""},
+		},
+		{
+			name:  "coefficient glued to name",
+			src:   "2Hg+1.5 S=>Au",
+			kinds: []tokenKind{tokenNumber, tokenIdent, tokenPlus, tokenNumber, tokenIdent, tokenArrow, tokenIdent, tokenEOF},
+			texts: []string{"2", "Hg", "+", "1.5", "S", "=>", "Au", ""},
+		},
+		{
+			name:  "digits inside a name",
+			src:   "H2O → H2",
+			kinds: []tokenKind{tokenIdent, tokenArrow, tokenIdent, tokenEOF},
+			texts: []string{"H2O", "→", "H2", ""},
+		},
+		{
+			name:  "quoted name and yield",
+			src:   `"Philosopher's Stone" -> Au @ 50%`,
+			kinds: []tokenKind{tokenString, tokenArrow, tokenIdent, tokenAt, tokenNumber, tokenPercent, tokenEOF},
+			texts: []string{"Philosopher's Stone", "->", "Au", "@", "50", "%", ""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, err := lex(tt.src)
+			if err != nil {
+				t.Fatalf("lex(%q): %v", tt.src, err)
+			}
+			var kinds []tokenKind
+			var texts []string
+			for _, tok := range tokens {
+				kinds = append(kinds, tok.kind)
+				texts = append(texts, tok.text)
+			}
+			if !reflect.DeepEqual(kinds, tt.kinds) {
+				t.Errorf("kinds = %v, want %v", kinds, tt.kinds)
+			}
+			if !reflect.DeepEqual(texts, tt.texts) {
+				t.Errorf("texts = %q, want %q", texts, tt.texts)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want *Formula
+	}{
+		{
+			name: "default coefficients and yield",
+			src:  "Hg -> Au",
+			want: &Formula{
+				Reactants: []Term{{Coefficient: 1, Material: "Hg", Pos: 1}},
+				Products:  []Term{{Coefficient: 1, Material: "Au", Pos: 7}},
+				Yield:     1,
+			},
+		},
+		{
+			// El coeficiente se une al término, '+' a cada lado y '@' a toda la fórmula.
+			name: "precedence",
+			src:  "2 Hg + S -> 3 Au + Salt @ 0.5",
+			want: &Formula{
+				Reactants: []Term{{Coefficient: 2, Material: "Hg", Pos: 1}, {Coefficient: 1, Material: "S", Pos: 8}},
+				Products:  []Term{{Coefficient: 3, Material: "Au", Pos: 13}, {Coefficient: 1, Material: "Salt", Pos: 20}},
+				Yield:     0.5,
+			},
+		},
+		{
+			name: "multi-word name and percent yield",
+			src:  "Red Lion -> Gold @ 80%",
+			want: &Formula{
+				Reactants: []Term{{Coefficient: 1, Material: "Red Lion", Pos: 1}},
+				Products:  []Term{{Coefficient: 1, Material: "Gold", Pos: 13}},
+				Yield:     0.8,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.src)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.src, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse(%q) = %+v, want %+v", tt.src, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		src string
+		pos int
+	}{
+		{src: "", pos: 1},
+		{src: "Hg Au", pos: 6},
+		{src: "Hg - Au", pos: 4},
+		{src: "Hg -> ", pos: 7},
+		{src: "0 Hg -> Au", pos: 1},
+		{src: "1.2.3 Hg -> Au", pos: 1},
+		{src: `"Hg -> Au`, pos: 1},
+		{src: `"" -> Au`, pos: 1},
+		{src: "Hg -> Au @ 150%", pos: 12},
+		{src: "Hg -> Au @", pos: 11},
+		{src: "Hg -> Au -> Ag", pos: 10},
+		{src: "Hg # Au", pos: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			_, err := Parse(tt.src)
+			var syntaxErr *SyntaxError
+			if !errors.As(err, &syntaxErr) {
+				t.Fatalf("Parse(%q) error = %v, want *SyntaxError", tt.src, err)
+			}
+			if syntaxErr.Pos != tt.pos {
+				t.Errorf("Parse(%q) error at column %d, want %d (%v)", tt.src, syntaxErr.Pos, tt.pos, err)
+			}
+		})
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		input   float64
+		batches float64
+		inputs  []Quantity
+		outputs []Quantity
+	}{
+		{
+			name:    "one to one",
+			src:     "Hg -> Au",
+			input:   10,
+			batches: 10,
+			inputs:  []Quantity{{Material: "Hg", Quantity: 10}},
+			outputs: []Quantity{{Material: "Au", Quantity: 10}},
+		},
+		{
+			name:    "coefficients split the input",
+			src:     "3 Hg + S -> 2 Au",
+			input:   8,
+			batches: 2,
+			inputs:  []Quantity{{Material: "Hg", Quantity: 6}, {Material: "S", Quantity: 2}},
+			outputs: []Quantity{{Material: "Au", Quantity: 4}},
+		},
+		{
+			name:    "yield reduces the products",
+			src:     "Hg -> Au + Salt @ 25%",
+			input:   4,
+			batches: 4,
+			inputs:  []Quantity{{Material: "Hg", Quantity: 4}},
+			outputs: []Quantity{{Material: "Au", Quantity: 1}, {Material: "Salt", Quantity: 1}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := Parse(tt.src)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.src, err)
+			}
+			res, err := f.Evaluate(tt.input)
+			if err != nil {
+				t.Fatalf("Evaluate(%v): %v", tt.input, err)
+			}
+			if res.Batches != tt.batches {
+				t.Errorf("batches = %v, want %v", res.Batches, tt.batches)
+			}
+			if !reflect.DeepEqual(res.Inputs, tt.inputs) {
+				t.Errorf("inputs = %+v, want %+v", res.Inputs, tt.inputs)
+			}
+			if !reflect.DeepEqual(res.Outputs, tt.outputs) {
+				t.Errorf("outputs = %+v, want %+v", res.Outputs, tt.outputs)
+			}
+		})
+	}
+}
+
+func TestEvaluateRejectsNonPositiveInput(t *testing.T) {
+	f, err := Parse("Hg -> Au")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, input := range []float64{0, -1} {
+		if _, err := f.Evaluate(input); err == nil {
+			t.Errorf("Evaluate(%v) succeeded, want error", input)
+		}
+	}
+}
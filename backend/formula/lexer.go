@@ -0,0 +1,145 @@
+package formula
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenNumber
+	tokenIdent
+	tokenString
+	tokenPlus
+	tokenArrow
+	tokenAt
+	tokenPercent
+)
+
+func (k tokenKind) String() string {
+	switch k {
+	case tokenEOF:
+		return "end of formula"
+	case tokenNumber:
+		return "number"
+	case tokenIdent:
+		return "material name"
+	case tokenString:
+		return "quoted material name"
+	case tokenPlus:
+		return "'+'"
+	case tokenArrow:
+		return "'->'"
+	case tokenAt:
+		return "'@'"
+	case tokenPercent:
+		return "'%'"
+	default:
+		return "unknown token"
+	}
+}
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int // columna (1-based) donde empieza el token
+}
+
+// SyntaxError describe un error de análisis señalando el token ofensivo.
+type SyntaxError struct {
+	Pos     int
+	Token   string
+	Message string
+}
+
+func (e *SyntaxError) Error() string {
+	if e.Token == "" {
+		return fmt.Sprintf("formula: %s at column %d", e.Message, e.Pos)
+	}
+	return fmt.Sprintf("formula: %s at column %d near %q", e.Message, e.Pos, e.Token)
+}
+
+// lex convierte la fórmula en una lista de tokens terminada en tokenEOF.
+func lex(src string) ([]token, error) {
+	runes := []rune(src)
+	tokens := []token{}
+	i := 0
+	for i < len(runes) {
+		r := runes[i]
+		col := i + 1
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '+':
+			tokens = append(tokens, token{kind: tokenPlus, text: "+", pos: col})
+			i++
+		case r == '@':
+			tokens = append(tokens, token{kind: tokenAt, text: "@", pos: col})
+			i++
+		case r == '%':
+			tokens = append(tokens, token{kind: tokenPercent, text: "%", pos: col})
+			i++
+		case r == '-' || r == '=' || r == '→':
+			if r == '→' {
+				tokens = append(tokens, token{kind: tokenArrow, text: "→", pos: col})
+				i++
+				continue
+			}
+			if i+1 < len(runes) && runes[i+1] == '>' {
+				tokens = append(tokens, token{kind: tokenArrow, text: string(runes[i : i+2]), pos: col})
+				i += 2
+				continue
+			}
+			return nil, &SyntaxError{Pos: col, Token: string(r), Message: "unexpected character, did you mean '->'?"}
+		case r == '"':
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				end++
+			}
+			if end >= len(runes) {
+				return nil, &SyntaxError{Pos: col, Token: string(runes[i:]), Message: "unterminated quoted material name"}
+			}
+			name := strings.TrimSpace(string(runes[i+1 : end]))
+			if name == "" {
+				return nil, &SyntaxError{Pos: col, Token: `""`, Message: "empty material name"}
+			}
+			tokens = append(tokens, token{kind: tokenString, text: name, pos: col})
+			i = end + 1
+		case unicode.IsDigit(r) || r == '.':
+			end := i
+			dots := 0
+			for end < len(runes) && (unicode.IsDigit(runes[end]) || runes[end] == '.') {
+				if runes[end] == '.' {
+					dots++
+				}
+				end++
+			}
+			text := string(runes[i:end])
+			if dots > 1 || text == "." {
+				return nil, &SyntaxError{Pos: col, Token: text, Message: "malformed number"}
+			}
+			// El número acaba en la primera letra, así que "2Hg" da el coeficiente 2
+			// y el material Hg; "H2O", en cambio, es un único nombre.
+			tokens = append(tokens, token{kind: tokenNumber, text: text, pos: col})
+			i = end
+		case isIdentRune(r):
+			end := i
+			for end < len(runes) && (isIdentRune(runes[end]) || unicode.IsDigit(runes[end])) {
+				end++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: string(runes[i:end]), pos: col})
+			i = end
+		default:
+			return nil, &SyntaxError{Pos: col, Token: string(r), Message: "unexpected character"}
+		}
+	}
+	tokens = append(tokens, token{kind: tokenEOF, pos: len(runes) + 1})
+	return tokens, nil
+}
+
+func isIdentRune(r rune) bool {
+	return unicode.IsLetter(r) || r == '_' || r == '\''
+}
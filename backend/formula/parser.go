@@ -0,0 +1,142 @@
+package formula
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Parse analiza una fórmula con la gramática:
+//
+//	formula  = side ( "->" | "=>" | "→" ) side [ "@" number [ "%" ] ]
+//	side     = term { "+" term }
+//	term     = [ number ] material
+//	material = word { word } | "texto entre comillas"
+//
+// Los coeficientes son proporciones (por defecto 1) y el rendimiento, si se
+// indica, debe estar en (0, 1] o en (0%, 100%].
+func Parse(src string) (*Formula, error) {
+	if strings.TrimSpace(src) == "" {
+		return nil, &SyntaxError{Pos: 1, Message: "empty formula, expected reactants -> products"}
+	}
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	return p.parseFormula()
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) errorf(t token, message string) error {
+	return &SyntaxError{Pos: t.pos, Token: t.text, Message: message}
+}
+
+func (p *parser) parseFormula() (*Formula, error) {
+	reactants, err := p.parseSide()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.next(); t.kind != tokenArrow {
+		return nil, p.errorf(t, "expected '->' between reactants and products, found "+t.kind.String())
+	}
+	products, err := p.parseSide()
+	if err != nil {
+		return nil, err
+	}
+	f := &Formula{Reactants: reactants, Products: products, Yield: 1}
+
+	if p.peek().kind == tokenAt {
+		p.next()
+		yield, err := p.parseYield()
+		if err != nil {
+			return nil, err
+		}
+		f.Yield = yield
+	}
+	if t := p.next(); t.kind != tokenEOF {
+		return nil, p.errorf(t, "unexpected "+t.kind.String()+" after end of formula")
+	}
+	return f, nil
+}
+
+func (p *parser) parseSide() ([]Term, error) {
+	terms := []Term{}
+	for {
+		term, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, term)
+		if p.peek().kind != tokenPlus {
+			return terms, nil
+		}
+		p.next()
+	}
+}
+
+func (p *parser) parseTerm() (Term, error) {
+	start := p.peek()
+	term := Term{Coefficient: 1, Pos: start.pos}
+	if start.kind == tokenNumber {
+		p.next()
+		value, err := strconv.ParseFloat(start.text, 64)
+		if err != nil {
+			return term, p.errorf(start, "malformed number")
+		}
+		if value <= 0 {
+			return term, p.errorf(start, "coefficient must be greater than zero")
+		}
+		term.Coefficient = value
+	}
+
+	t := p.peek()
+	switch t.kind {
+	case tokenString:
+		p.next()
+		term.Material = t.text
+	case tokenIdent:
+		words := []string{}
+		for p.peek().kind == tokenIdent {
+			words = append(words, p.next().text)
+		}
+		term.Material = strings.Join(words, " ")
+	default:
+		return term, p.errorf(t, "expected material name, found "+t.kind.String())
+	}
+	return term, nil
+}
+
+func (p *parser) parseYield() (float64, error) {
+	t := p.next()
+	if t.kind != tokenNumber {
+		return 0, p.errorf(t, "expected yield after '@', found "+t.kind.String())
+	}
+	value, err := strconv.ParseFloat(t.text, 64)
+	if err != nil {
+		return 0, p.errorf(t, "malformed number")
+	}
+	if p.peek().kind == tokenPercent {
+		p.next()
+		value /= 100
+	}
+	if value <= 0 || value > 1 {
+		return 0, p.errorf(t, "yield must be between 0 and 1 (or 0% and 100%)")
+	}
+	return value, nil
+}
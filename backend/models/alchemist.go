@@ -8,4 +8,8 @@ type Alchemist struct {
 	Age       int    `gorm:"not null"`
 	Specialty string `gorm:"size:255"`
 	Rank      string `gorm:"size:100"`
+	// UserID es la cuenta con la que el alquimista inicia sesión; de aquí sale
+	// el rango que aplican las cuotas.
+	UserID *uint `gorm:"index"`
+	User   *User `gorm:"constraint:OnDelete:SET NULL"`
 }
@@ -0,0 +1,28 @@
+package models
+
+import "gorm.io/gorm"
+
+// Formula es una entrada del catálogo de fórmulas. El cuerpo vive en sus
+// versiones: editarlo crea una versión nueva y las anteriores no cambian,
+// así que cada transmutación conserva la fórmula exacta con la que se creó.
+type Formula struct {
+	gorm.Model
+	Name        string `gorm:"size:128;index"`
+	Description string
+	Author      string
+	// LatestVersion es el número de la versión vigente; las versiones empiezan en 1.
+	LatestVersion     int
+	Deprecated        bool
+	DeprecationReason string
+	Versions          []FormulaVersion
+}
+
+// FormulaVersion es una revisión inmutable del cuerpo de una fórmula.
+type FormulaVersion struct {
+	gorm.Model
+	FormulaID uint `gorm:"uniqueIndex:idx_formula_version"`
+	Version   int  `gorm:"uniqueIndex:idx_formula_version"`
+	Body      string
+	Author    string
+	Notes     string
+}
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// IdempotencyRecord guarda la primera respuesta a una petición con
+// Idempotency-Key para repetirla si el cliente reintenta. Mientras la
+// petición original se procesa, Completed es false y LockedUntil marca hasta
+// cuándo la retiene; pasado ese plazo otro reintento puede tomarla.
+type IdempotencyRecord struct {
+	gorm.Model
+	Scope          string `gorm:"size:64;uniqueIndex:idx_idempotency_key"`
+	IdempotencyKey string `gorm:"size:255;uniqueIndex:idx_idempotency_key"`
+	Method         string `gorm:"size:16"`
+	Path           string
+	RequestHash    string `gorm:"size:64"`
+	Completed      bool
+	StatusCode     int
+	ContentType    string
+	Body           []byte
+	ExpiresAt      time.Time `gorm:"index"`
+	LockedUntil    time.Time
+	// LeaseToken identifica a la petición que tiene la reserva: al tomarla
+	// otra, la original ya no puede completar ni liberar el registro.
+	LeaseToken string `gorm:"size:32"`
+}
@@ -0,0 +1,42 @@
+package models
+
+import "gorm.io/gorm"
+
+// Location es un almacén o bóveda donde se guarda material. Una de ellas es
+// la predeterminada: recibe lo que no indica ubicación y las existencias
+// anteriores a las ubicaciones.
+type Location struct {
+	gorm.Model
+	Name        string `gorm:"size:64;index"`
+	Description string
+	IsDefault   bool `gorm:"index"`
+}
+
+// MaterialStock es la existencia de un material en una ubicación. La suma de
+// Quantity y Reserved de sus ubicaciones coincide con Material.Quantity y
+// Material.Reserved.
+type MaterialStock struct {
+	gorm.Model
+	MaterialID uint `gorm:"uniqueIndex:idx_material_location"`
+	Material   *Material
+	LocationID uint `gorm:"uniqueIndex:idx_material_location"`
+	Location   *Location
+	Quantity   float64
+	Reserved   float64
+}
+
+// StockTransfer registra un traslado de material entre dos ubicaciones. Si
+// LotID no es nil se trasladó (parte de) ese lote.
+type StockTransfer struct {
+	gorm.Model
+	MaterialID     uint `gorm:"index"`
+	Material       *Material
+	FromLocationID uint `gorm:"index"`
+	FromLocation   *Location
+	ToLocationID   uint `gorm:"index"`
+	ToLocation     *Location
+	LotID          *uint
+	Quantity       float64
+	Actor          string
+	Reason         string
+}
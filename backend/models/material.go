@@ -7,4 +7,19 @@ type Material struct {
 	Name     string
 	Category string
 	Quantity float64
+	// EnergyValue es la masa/energía equivalente de una unidad, usada por la ley de intercambio equivalente.
+	EnergyValue float64
+	// Unit es la unidad base en la que se expresan Quantity y las reservas;
+	// vacía en los materiales anteriores a las unidades, que pueden declararla
+	// una vez. Density (g/ml) permite convertir entre masa y volumen.
+	Unit    string `gorm:"size:16"`
+	Density float64
+	// Reserved es la parte de Quantity apartada por transmutaciones en curso;
+	// lo disponible es Quantity - Reserved (sin contar lotes caducados).
+	Reserved float64
+	// Cuando lo no reservado baja a ReorderLevel o menos se abre una
+	// solicitud de reposición por ReorderQuantity. 0 desactiva el punto de
+	// pedido y el material usa el umbral global de stock crítico.
+	ReorderLevel    float64
+	ReorderQuantity float64
 }
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// MaterialLot es una partida recibida de un material. Su Quantity forma parte
+// de Material.Quantity; lo que no está en ningún lote (existencias anteriores
+// a los lotes o productos de transmutaciones) se consume después de los lotes.
+type MaterialLot struct {
+	gorm.Model
+	MaterialID uint `gorm:"index"`
+	Material   *Material
+	LotNumber  string `gorm:"size:64"`
+	ReceivedAt time.Time
+	// ExpiresAt nil significa que el lote no caduca.
+	ExpiresAt *time.Time `gorm:"index"`
+	Quantity  float64
+	// LocationID es la ubicación donde está el lote.
+	LocationID uint `gorm:"index"`
+}
+
+// Expired indica si el lote ya no puede consumirse en at.
+func (l *MaterialLot) Expired(at time.Time) bool {
+	return l.ExpiresAt != nil && !l.ExpiresAt.After(at)
+}
+
+// TransmutationLotDraw registra cuánto tomó un intento de una transmutación de
+// cada lote, para devolverlo al mismo lote si se cancela o se rechaza.
+type TransmutationLotDraw struct {
+	gorm.Model
+	TransmutationID uint `gorm:"index"`
+	Attempt         int
+	LotID           uint `gorm:"index"`
+	MaterialID      uint
+	Quantity        float64
+}
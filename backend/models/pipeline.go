@@ -0,0 +1,53 @@
+package models
+
+import "gorm.io/gorm"
+
+// Pipeline encadena transmutaciones formando un grafo acíclico: cada paso se
+// lanza cuando todos los pasos de los que depende han terminado con éxito.
+type Pipeline struct {
+	gorm.Model
+	Name   string
+	UserID uint
+	Status string `gorm:"size:32"`
+	Steps  []PipelineStep
+}
+
+// PipelineStep es un nodo del pipeline. Los pasos se guardan en orden
+// topológico y TransmutationID se rellena al lanzar el paso.
+type PipelineStep struct {
+	gorm.Model
+	PipelineID      uint `gorm:"index"`
+	Key             string
+	DependsOn       []string `gorm:"serializer:json"`
+	MaterialID      uint
+	RecipeID        *uint
+	Formula         string
+	FormulaID       *uint
+	FormulaVersion  int
+	Quantity        float64
+	Unit            string `gorm:"size:16"`
+	ApprovalReason  string
+	TransmutationID *uint
+	Status          string `gorm:"size:32"`
+	Error           string
+}
+
+const (
+	PipelineStatusRunning   = "RUNNING"
+	PipelineStatusCompleted = "COMPLETED"
+	PipelineStatusFailed    = "FAILED"
+
+	// Los pasos lanzados reflejan el estado de su transmutación; antes de
+	// lanzarse esperan y, si una dependencia no termina bien, se omiten.
+	PipelineStepWaiting = "WAITING"
+	PipelineStepSkipped = "SKIPPED"
+)
+
+// IsTerminalStepStatus indica si el paso ya no va a cambiar de estado.
+func IsTerminalStepStatus(status string) bool {
+	switch status {
+	case TransmutationStatusCompleted, TransmutationStatusFailed, TransmutationStatusCancelled, TransmutationStatusRejected, PipelineStepSkipped:
+		return true
+	}
+	return false
+}
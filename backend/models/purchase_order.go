@@ -0,0 +1,62 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	PurchaseOrderStatusDraft             = "DRAFT"
+	PurchaseOrderStatusSent              = "SENT"
+	PurchaseOrderStatusPartiallyReceived = "PARTIALLY_RECEIVED"
+	PurchaseOrderStatusReceived          = "RECEIVED"
+	PurchaseOrderStatusCancelled         = "CANCELLED"
+)
+
+// PurchaseOrder es un pedido a un proveedor. Se edita en DRAFT, se envía y
+// después se recibe por líneas, cada una con su entrada en el libro de
+// movimientos del material.
+type PurchaseOrder struct {
+	gorm.Model
+	SupplierID uint `gorm:"index"`
+	Supplier   *Supplier
+	Reference  string `gorm:"size:64"`
+	Status     string `gorm:"size:24;index;default:DRAFT"`
+	Notes      string
+	CreatedBy  string
+	// LocationID es dónde se recibe la mercancía; nil usa la predeterminada.
+	LocationID *uint
+	SentAt     *time.Time
+	// ClosedAt es cuándo quedó recibida del todo o cancelada.
+	ClosedAt *time.Time
+	Lines    []PurchaseOrderLine
+}
+
+// IsReceivable indica si la orden admite recepciones.
+func (o *PurchaseOrder) IsReceivable() bool {
+	return o.Status == PurchaseOrderStatusSent || o.Status == PurchaseOrderStatusPartiallyReceived
+}
+
+// PurchaseOrderLine es la cantidad pedida de un material, en su unidad base.
+type PurchaseOrderLine struct {
+	gorm.Model
+	PurchaseOrderID  uint `gorm:"index"`
+	MaterialID       uint `gorm:"index"`
+	Material         *Material
+	Quantity         float64
+	ReceivedQuantity float64
+	UnitPrice        float64
+}
+
+// ReceiptTolerance absorbe el error de redondeo al sumar recepciones parciales.
+const ReceiptTolerance = 1e-9
+
+// Pending es lo que falta por recibir de la línea; un resto menor que
+// ReceiptTolerance cuenta como recibido.
+func (l *PurchaseOrderLine) Pending() float64 {
+	if l.Quantity-l.ReceivedQuantity <= ReceiptTolerance {
+		return 0
+	}
+	return l.Quantity - l.ReceivedQuantity
+}
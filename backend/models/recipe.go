@@ -0,0 +1,28 @@
+package models
+
+import "gorm.io/gorm"
+
+// Recipe describe los reactivos que consume y los materiales que produce un lote de transmutación.
+type Recipe struct {
+	gorm.Model
+	Name        string `gorm:"size:255;not null"`
+	Description string
+	Inputs      []RecipeInput
+	Outputs     []RecipeOutput
+}
+
+type RecipeInput struct {
+	gorm.Model
+	RecipeID   uint `gorm:"index"`
+	MaterialID uint
+	Material   *Material
+	Quantity   float64
+}
+
+type RecipeOutput struct {
+	gorm.Model
+	RecipeID   uint `gorm:"index"`
+	MaterialID uint
+	Material   *Material
+	Quantity   float64
+}
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	RestockStatusOpen      = "OPEN"
+	RestockStatusApproved  = "APPROVED"
+	RestockStatusReceived  = "RECEIVED"
+	RestockStatusDismissed = "DISMISSED"
+)
+
+// RestockRequest es una solicitud de reposición abierta automáticamente cuando
+// un material cruza su punto de pedido. Un supervisor la aprueba, registra su
+// recepción (que suma al stock) o la descarta. Cada material tiene como mucho
+// una solicitud OPEN o APPROVED.
+type RestockRequest struct {
+	gorm.Model
+	MaterialID uint `gorm:"index"`
+	Material   *Material
+	Quantity   float64
+	Status     string `gorm:"size:16;index"`
+	// Available y Trigger describen el momento en que se abrió.
+	Available float64
+	Trigger   string
+	// ReviewedBy aprueba o descarta; ReceivedBy registra la entrada.
+	ReviewedBy       string
+	Note             string
+	ReceivedBy       string
+	ReceivedQuantity float64
+	ClosedAt         *time.Time
+}
+
+// IsPending indica si la solicitud sigue esperando mercancía.
+func (r *RestockRequest) IsPending() bool {
+	return r.Status == RestockStatusOpen || r.Status == RestockStatusApproved
+}
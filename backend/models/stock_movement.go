@@ -0,0 +1,29 @@
+package models
+
+import "gorm.io/gorm"
+
+// StockMovement es un apunte del libro de movimientos de un material. El
+// libro solo crece: la suma de Quantity de un material debe coincidir con su
+// existencia actual.
+type StockMovement struct {
+	gorm.Model
+	MaterialID uint   `gorm:"index"`
+	Kind       string `gorm:"size:32"`
+	// Quantity es positiva si entra material y negativa si sale.
+	Quantity        float64
+	TransmutationID *uint `gorm:"index"`
+	Actor           string
+	Reason          string
+	// LocationID es la ubicación afectada; nil en los apuntes anteriores a
+	// las ubicaciones.
+	LocationID *uint `gorm:"index"`
+}
+
+const (
+	StockMovementReceipt     = "receipt"
+	StockMovementConsumption = "consumption"
+	StockMovementProduction  = "production"
+	StockMovementAdjustment  = "adjustment"
+	StockMovementRefund      = "refund"
+	StockMovementTransfer    = "transfer"
+)
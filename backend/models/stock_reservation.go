@@ -0,0 +1,24 @@
+package models
+
+import "gorm.io/gorm"
+
+const (
+	StockReservationActive   = "active"
+	StockReservationConsumed = "consumed"
+	StockReservationReleased = "released"
+)
+
+// StockReservation aparta existencias de un material para un intento de una
+// transmutación. Mientras está activa cuenta en Material.Reserved y en el de
+// la existencia de su ubicación; al completarse se convierte en consumo y al
+// fallar o cancelarse se libera.
+type StockReservation struct {
+	gorm.Model
+	MaterialID      uint `gorm:"index"`
+	TransmutationID uint `gorm:"index"`
+	Attempt         int
+	Quantity        float64
+	Status          string `gorm:"size:16;index"`
+	// LocationID es la ubicación de la que se aparta.
+	LocationID uint `gorm:"index"`
+}
@@ -0,0 +1,13 @@
+package models
+
+import "gorm.io/gorm"
+
+// Supplier es un proveedor al que se emiten órdenes de compra.
+type Supplier struct {
+	gorm.Model
+	Name    string `gorm:"size:128;index"`
+	Email   string
+	Phone   string `gorm:"size:32"`
+	Address string
+	Notes   string
+}
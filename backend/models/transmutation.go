@@ -1,15 +1,144 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
 
 type Transmutation struct {
 	gorm.Model
 	UserID     uint
 	MaterialID uint
+	RecipeID   *uint
+	Recipe     *Recipe
+	BatchID    *uint `gorm:"index"`
+	PipelineID *uint `gorm:"index"`
 	Formula    string
 	Quantity   float64
 	Status     string `gorm:"size:32;default:PENDING"`
 	Result     string
+	Attempts   int `gorm:"default:1"`
+	// ApprovalReason explica por qué quedó en AWAITING_APPROVAL; ReviewedBy y
+	// ReviewComment registran la decisión del supervisor.
+	ApprovalReason string
+	ReviewedBy     string
+	ReviewComment  string
+	// FormulaID y FormulaVersion identifican la versión del catálogo de la que
+	// se copió Formula, si la transmutación se creó a partir de una.
+	FormulaID      *uint `gorm:"index"`
+	FormulaVersion int
+	// Unit es la unidad base del material en la que quedó expresada Quantity.
+	Unit string `gorm:"size:16"`
+	// LocationID es la ubicación de la que se reservan los reactivos y en la
+	// que se acreditan los productos; nil en las anteriores a las ubicaciones
+	// (se entiende la predeterminada).
+	LocationID *uint `gorm:"index"`
+	// ScheduledAt, si no es nil, es la hora a partir de la cual el worker puede procesarla.
+	ScheduledAt *time.Time
+	Outcome     *TransmutationOutcome `gorm:"serializer:json"`
+	Progress    TransmutationProgress `gorm:"embedded;embeddedPrefix:progress_"`
+	Inputs      []TransmutationInput
+	// Outputs copia los productos de la receta al crearla, para que editarla o
+	// borrarla no cambie lo que acreditan las transmutaciones en curso.
+	Outputs []TransmutationOutput
+	// LotDraws son los lotes de los que se tomaron los reactivos (FEFO).
+	LotDraws []TransmutationLotDraw
+}
+
+// TransmutationProgress es el último avance que informó el worker, para que
+// un cliente que se reconecta vea en qué punto va el procesamiento.
+type TransmutationProgress struct {
+	Stage      string `gorm:"size:32"`
+	Percent    int
+	Message    string
+	ReportedAt *time.Time
+}
+
+const (
+	ProgressStageStarted    = "started"
+	ProgressStageEvaluating = "evaluating"
+	ProgressStageExchange   = "checking_exchange"
+	ProgressStageCrediting  = "crediting"
+	ProgressStageCompleted  = "completed"
+	ProgressStageFailed     = "failed"
+)
+
+// TransmutationBatch agrupa las transmutaciones enviadas juntas para seguir su progreso.
+type TransmutationBatch struct {
+	gorm.Model
+	UserID         uint
+	Mode           string `gorm:"size:16"`
+	RequestedBy    string
+	Transmutations []Transmutation `gorm:"foreignKey:BatchID"`
+}
+
+const (
+	BatchModeAllOrNothing = "all_or_nothing"
+	BatchModeBestEffort   = "best_effort"
+)
+
+// TransmutationInput registra cuánto de cada material reservó la transmutación al crearse.
+type TransmutationInput struct {
+	gorm.Model
+	TransmutationID uint `gorm:"index"`
+	MaterialID      uint
+	Quantity        float64
+}
+
+// TransmutationOutput registra cuánto de cada material producirá una
+// transmutación con receta, ya multiplicado por el número de lotes.
+type TransmutationOutput struct {
+	gorm.Model
+	TransmutationID uint `gorm:"index"`
+	MaterialID      uint
+	Quantity        float64
+}
+
+// TransmutationOutcome es el resultado estructurado que escribe el worker al evaluar la fórmula.
+type TransmutationOutcome struct {
+	Batches     float64                  `json:"batches"`
+	Yield       float64                  `json:"yield"`
+	Inputs      []TransmutationComponent `json:"inputs"`
+	Outputs     []TransmutationComponent `json:"outputs"`
+	Exchange    *ExchangeBalance         `json:"exchange,omitempty"`
+	Rules       []RuleHit                `json:"rules,omitempty"`
+	CompletedAt time.Time                `json:"completed_at"`
+}
+
+type TransmutationComponent struct {
+	MaterialID  uint    `json:"material_id,omitempty"`
+	Material    string  `json:"material"`
+	Quantity    float64 `json:"quantity"`
+	EnergyValue float64 `json:"energy_value,omitempty"`
+	// Created indica que el material no existía y se dio de alta al acreditar el producto.
+	Created bool `json:"created,omitempty"`
+}
+
+// Summary genera el texto legible que se guarda en Result, con el ID del
+// material acreditado por cada producto.
+func (o *TransmutationOutcome) Summary() string {
+	parts := make([]string, 0, len(o.Outputs))
+	for _, out := range o.Outputs {
+		part := fmt.Sprintf("%s %s", strconv.FormatFloat(out.Quantity, 'f', -1, 64), out.Material)
+		if out.MaterialID != 0 {
+			part += fmt.Sprintf(" (#%d)", out.MaterialID)
+		}
+		parts = append(parts, part)
+	}
+	return fmt.Sprintf("Produced %s (yield %s%%)", strings.Join(parts, ", "), strconv.FormatFloat(o.Yield*100, 'f', -1, 64))
+}
+
+// ExchangeBalance compara el valor consumido con el producido por una transmutación.
+type ExchangeBalance struct {
+	InputValue  float64 `json:"input_value"`
+	OutputValue float64 `json:"output_value"`
+	Imbalance   float64 `json:"imbalance"`
+	Tolerance   float64 `json:"tolerance"`
+	Violated    bool    `json:"violated"`
 }
 
 const (
@@ -17,4 +146,45 @@ const (
 	TransmutationStatusProcessing = "PROCESSING"
 	TransmutationStatusCompleted  = "COMPLETED"
 	TransmutationStatusFailed     = "FAILED"
+	TransmutationStatusCancelled  = "CANCELLED"
+	// TransmutationStatusAwaitingApproval retiene la transmutación hasta que un supervisor la revise.
+	TransmutationStatusAwaitingApproval = "AWAITING_APPROVAL"
+	TransmutationStatusRejected         = "REJECTED"
 )
+
+// transmutationTransitions es la tabla central de cambios de estado permitidos.
+var transmutationTransitions = map[string][]string{
+	TransmutationStatusAwaitingApproval: {TransmutationStatusPending, TransmutationStatusRejected, TransmutationStatusCancelled},
+	TransmutationStatusPending:          {TransmutationStatusProcessing, TransmutationStatusFailed, TransmutationStatusCancelled},
+	TransmutationStatusProcessing:       {TransmutationStatusCompleted, TransmutationStatusFailed, TransmutationStatusCancelled},
+	TransmutationStatusCompleted:        {},
+	TransmutationStatusFailed:           {TransmutationStatusPending},
+	TransmutationStatusCancelled:        {},
+	TransmutationStatusRejected:         {},
+}
+
+// IsTransmutationStatus indica si el valor es uno de los estados conocidos.
+func IsTransmutationStatus(status string) bool {
+	_, ok := transmutationTransitions[status]
+	return ok
+}
+
+// CanTransitionTransmutation indica si la tabla permite pasar de from a to.
+func CanTransitionTransmutation(from, to string) bool {
+	for _, allowed := range transmutationTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// TransmutationTransition es una entrada del historial de estados de una transmutación.
+type TransmutationTransition struct {
+	gorm.Model
+	TransmutationID uint   `gorm:"index"`
+	FromStatus      string `gorm:"size:32"`
+	ToStatus        string `gorm:"size:32"`
+	Actor           string
+	Reason          string
+}
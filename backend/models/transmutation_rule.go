@@ -0,0 +1,42 @@
+package models
+
+import "gorm.io/gorm"
+
+// TransmutationRule declara trabajo prohibido o delicado. Coincide cuando se
+// cumplen todos sus criterios no vacíos y entonces aplica su acción.
+type TransmutationRule struct {
+	gorm.Model
+	Name        string `gorm:"size:128;index"`
+	Description string
+	// FormulaPattern es una expresión regular sobre la fórmula (o el nombre de la receta).
+	FormulaPattern string
+	// Categories coincide si algún material consumido o producido es de esas categorías.
+	Categories  []string `gorm:"serializer:json"`
+	Roles       []string `gorm:"serializer:json"`
+	MinQuantity *float64
+	MaxQuantity *float64
+	Action      string `gorm:"size:32"`
+	Enabled     bool
+}
+
+const (
+	RuleActionBlock           = "block"
+	RuleActionRequireApproval = "require_approval"
+	RuleActionFlag            = "flag"
+)
+
+func IsRuleAction(action string) bool {
+	switch action {
+	case RuleActionBlock, RuleActionRequireApproval, RuleActionFlag:
+		return true
+	}
+	return false
+}
+
+// RuleHit es una regla que coincidió al evaluar una transmutación.
+type RuleHit struct {
+	RuleID uint   `json:"rule_id"`
+	Rule   string `json:"rule"`
+	Action string `json:"action"`
+	Reason string `json:"reason"`
+}
@@ -2,8 +2,16 @@ package repository
 
 import (
 	"backend-avanzada/models"
+	"errors"
+	"strings"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrUserNotFound      = errors.New("user not found")
+	ErrUserAlreadyLinked = errors.New("user is already linked to another alchemist")
 )
 
 type AlchemistRepository struct {
@@ -29,13 +37,69 @@ func (r *AlchemistRepository) FindById(id int) (*models.Alchemist, error) {
 	return &a, err
 }
 
+// Save guarda el alquimista comprobando que su usuario existe y no está
+// enlazado a otro alquimista.
 func (r *AlchemistRepository) Save(a *models.Alchemist) (*models.Alchemist, error) {
-	if err := r.db.Save(a).Error; err != nil {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if a.UserID != nil {
+			var users int64
+			if err := tx.Model(&models.User{}).Where("id = ?", *a.UserID).Count(&users).Error; err != nil {
+				return err
+			}
+			if users == 0 {
+				return ErrUserNotFound
+			}
+			var linked int64
+			if err := tx.Model(&models.Alchemist{}).Where("user_id = ? AND id <> ?", *a.UserID, a.ID).Count(&linked).Error; err != nil {
+				return err
+			}
+			if linked > 0 {
+				return ErrUserAlreadyLinked
+			}
+		}
+		return tx.Omit(clause.Associations).Save(a).Error
+	})
+	if err != nil {
 		return nil, err
 	}
 	return a, nil
 }
 
+// LinkUsersByName enlaza cada alquimista sin usuario con el único usuario de
+// su mismo nombre, que es como se resolvía el rango antes de existir user_id.
+// Los nombres ambiguos o ya enlazados se dejan para hacerlo a mano.
+func (r *AlchemistRepository) LinkUsersByName() (int, error) {
+	linked := 0
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var alchemists []*models.Alchemist
+		if err := tx.Where("user_id IS NULL").Order("id").Find(&alchemists).Error; err != nil {
+			return err
+		}
+		for _, a := range alchemists {
+			var users []models.User
+			if err := tx.Where("LOWER(name) = LOWER(?)", strings.TrimSpace(a.Name)).Limit(2).Find(&users).Error; err != nil {
+				return err
+			}
+			if len(users) != 1 {
+				continue
+			}
+			var taken int64
+			if err := tx.Model(&models.Alchemist{}).Where("user_id = ?", users[0].ID).Count(&taken).Error; err != nil {
+				return err
+			}
+			if taken > 0 {
+				continue
+			}
+			if err := tx.Model(a).Update("user_id", users[0].ID).Error; err != nil {
+				return err
+			}
+			linked++
+		}
+		return nil
+	})
+	return linked, err
+}
+
 func (r *AlchemistRepository) Delete(a *models.Alchemist) error {
 	return r.db.Delete(a).Error
 }
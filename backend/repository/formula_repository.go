@@ -0,0 +1,182 @@
+package repository
+
+import (
+	"backend-avanzada/models"
+	"errors"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrFormulaNotFound        = errors.New("formula not found")
+	ErrFormulaVersionNotFound = errors.New("formula version not found")
+	ErrFormulaNameTaken       = errors.New("a formula with that name already exists")
+)
+
+type FormulaRepository struct {
+	db *gorm.DB
+}
+
+func NewFormulaRepository(db *gorm.DB) *FormulaRepository {
+	return &FormulaRepository{db: db}
+}
+
+func (r *FormulaRepository) withVersions(db *gorm.DB) *gorm.DB {
+	return db.Preload("Versions", func(db *gorm.DB) *gorm.DB {
+		return db.Order("version")
+	})
+}
+
+func (r *FormulaRepository) FindAll() ([]*models.Formula, error) {
+	var formulas []*models.Formula
+	err := r.withVersions(r.db).Order("id").Find(&formulas).Error
+	return formulas, err
+}
+
+func (r *FormulaRepository) FindById(id int) (*models.Formula, error) {
+	var f models.Formula
+	err := r.withVersions(r.db).First(&f, id).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// FindVersion devuelve la fórmula y la versión pedida; con version 0 la vigente.
+func (r *FormulaRepository) FindVersion(formulaID uint, version int) (*models.Formula, *models.FormulaVersion, error) {
+	var f models.Formula
+	if err := r.db.First(&f, formulaID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil, ErrFormulaNotFound
+		}
+		return nil, nil, err
+	}
+	if version == 0 {
+		version = f.LatestVersion
+	}
+	var v models.FormulaVersion
+	if err := r.db.Where("formula_id = ? AND version = ?", f.ID, version).First(&v).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil, ErrFormulaVersionNotFound
+		}
+		return nil, nil, err
+	}
+	return &f, &v, nil
+}
+
+// Create guarda la fórmula junto con su versión 1.
+func (r *FormulaRepository) Create(f *models.Formula, body, notes string) (*models.Formula, error) {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := checkFormulaName(tx, f); err != nil {
+			return err
+		}
+		f.LatestVersion = 1
+		if err := tx.Omit("Versions").Create(f).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.FormulaVersion{
+			FormulaID: f.ID,
+			Version:   1,
+			Body:      body,
+			Author:    f.Author,
+			Notes:     notes,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r.FindById(int(f.ID))
+}
+
+// FormulaChanges son los cambios de una edición; los campos nil no se tocan.
+type FormulaChanges struct {
+	Name              *string
+	Description       *string
+	Body              *string
+	Deprecated        *bool
+	DeprecationReason *string
+	// Author y Notes describen la versión nueva si Body la crea.
+	Author string
+	Notes  string
+}
+
+// Update aplica changes sobre la fórmula releída con bloqueo, así dos
+// ediciones simultáneas no se pisan. Un Body distinto del vigente añade una
+// versión nueva; las existentes no se tocan. Devuelve también la fórmula tal
+// como estaba antes del cambio.
+func (r *FormulaRepository) Update(id uint, changes FormulaChanges) (*models.Formula, *models.Formula, error) {
+	var previous models.Formula
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var current models.Formula
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&current, id).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return ErrFormulaNotFound
+			}
+			return err
+		}
+		previous = current
+		if changes.Name != nil {
+			current.Name = *changes.Name
+			if err := checkFormulaName(tx, &current); err != nil {
+				return err
+			}
+		}
+		if changes.Description != nil {
+			current.Description = *changes.Description
+		}
+		if changes.Deprecated != nil {
+			current.Deprecated = *changes.Deprecated
+			if !current.Deprecated {
+				current.DeprecationReason = ""
+			}
+		}
+		if changes.DeprecationReason != nil && current.Deprecated {
+			current.DeprecationReason = *changes.DeprecationReason
+		}
+		if changes.Body != nil {
+			var latest []models.FormulaVersion
+			if err := tx.Where("formula_id = ? AND version = ?", id, current.LatestVersion).Limit(1).Find(&latest).Error; err != nil {
+				return err
+			}
+			// Reenviar el cuerpo vigente no crea una versión nueva.
+			if len(latest) == 0 || latest[0].Body != *changes.Body {
+				current.LatestVersion++
+				if err := tx.Create(&models.FormulaVersion{
+					FormulaID: id,
+					Version:   current.LatestVersion,
+					Body:      *changes.Body,
+					Author:    changes.Author,
+					Notes:     changes.Notes,
+				}).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return tx.Omit("Versions").Save(&current).Error
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	updated, err := r.FindById(int(id))
+	if err != nil {
+		return nil, nil, err
+	}
+	return updated, &previous, nil
+}
+
+func checkFormulaName(tx *gorm.DB, f *models.Formula) error {
+	var count int64
+	if err := tx.Model(&models.Formula{}).
+		Where("LOWER(name) = LOWER(?) AND id <> ?", f.Name, f.ID).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrFormulaNameTaken
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package repository
+
+import (
+	"backend-avanzada/models"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrIdempotencyLeaseLost indica que la reserva de la clave venció y la tomó
+// otra petición: la respuesta de esta ya no se guarda.
+var ErrIdempotencyLeaseLost = errors.New("idempotency key lease was taken over by another request")
+
+type IdempotencyRepository struct {
+	db *gorm.DB
+}
+
+func NewIdempotencyRepository(db *gorm.DB) *IdempotencyRepository {
+	return &IdempotencyRepository{db: db}
+}
+
+// Begin reserva la clave de rec. Si ya estaba reservada y no ha caducado
+// devuelve el registro existente y false; si no, guarda rec y devuelve true.
+// Un registro caducado, o uno sin completar cuya reserva (LockedUntil) venció
+// porque la petición original no terminó, se reutiliza para rec. Cada reserva
+// recibe un LeaseToken nuevo con el que se completa o se libera.
+func (r *IdempotencyRepository) Begin(rec *models.IdempotencyRecord, now time.Time) (*models.IdempotencyRecord, bool, error) {
+	token, err := leaseToken()
+	if err != nil {
+		return nil, false, err
+	}
+	rec.LeaseToken = token
+	existing, err := r.find(rec.Scope, rec.IdempotencyKey)
+	if err != nil {
+		return nil, false, err
+	}
+	if existing != nil {
+		return r.takeOver(existing, rec, now)
+	}
+	if err := r.db.Create(rec).Error; err != nil {
+		// Otra petición con la misma clave se adelantó entre la consulta y el alta.
+		existing, findErr := r.find(rec.Scope, rec.IdempotencyKey)
+		if findErr != nil || existing == nil {
+			return nil, false, err
+		}
+		return existing, false, nil
+	}
+	return rec, true, nil
+}
+
+// takeOver reutiliza el registro existente para rec si caducó o si su reserva
+// venció sin completarse con la misma petición. La condición va en el UPDATE,
+// así de dos reintentos simultáneos solo uno lo consigue.
+func (r *IdempotencyRepository) takeOver(existing, rec *models.IdempotencyRecord, now time.Time) (*models.IdempotencyRecord, bool, error) {
+	result := r.db.Model(&models.IdempotencyRecord{}).
+		Where("id = ? AND (expires_at <= ? OR (completed = ? AND locked_until <= ? AND request_hash = ?))",
+			existing.ID, now, false, now, rec.RequestHash).
+		Updates(map[string]interface{}{
+			"method":       rec.Method,
+			"path":         rec.Path,
+			"request_hash": rec.RequestHash,
+			"completed":    false,
+			"status_code":  0,
+			"content_type": "",
+			"body":         nil,
+			"expires_at":   rec.ExpiresAt,
+			"locked_until": rec.LockedUntil,
+			"lease_token":  rec.LeaseToken,
+		})
+	if result.Error != nil {
+		return nil, false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return existing, false, nil
+	}
+	rec.ID = existing.ID
+	rec.CreatedAt = existing.CreatedAt
+	return rec, true, nil
+}
+
+// PurgeExpired borra los registros caducados. Lo ejecuta periódicamente el
+// TaskQueue para no cargar cada petición con el borrado.
+func (r *IdempotencyRepository) PurgeExpired(now time.Time) (int64, error) {
+	result := r.db.Unscoped().Where("expires_at <= ?", now).Delete(&models.IdempotencyRecord{})
+	return result.RowsAffected, result.Error
+}
+
+func (r *IdempotencyRepository) find(scope, key string) (*models.IdempotencyRecord, error) {
+	var recs []models.IdempotencyRecord
+	if err := r.db.Where("scope = ? AND idempotency_key = ?", scope, key).Limit(1).Find(&recs).Error; err != nil {
+		return nil, err
+	}
+	if len(recs) == 0 {
+		return nil, nil
+	}
+	return &recs[0], nil
+}
+
+func leaseToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Complete guarda la respuesta de la petición original para repetirla.
+// Devuelve ErrIdempotencyLeaseLost si otra petición tomó la reserva.
+func (r *IdempotencyRepository) Complete(rec *models.IdempotencyRecord) error {
+	result := r.db.Model(&models.IdempotencyRecord{}).
+		Where("id = ? AND lease_token = ? AND completed = ?", rec.ID, rec.LeaseToken, false).
+		Updates(map[string]interface{}{
+			"completed":    true,
+			"status_code":  rec.StatusCode,
+			"content_type": rec.ContentType,
+			"body":         rec.Body,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrIdempotencyLeaseLost
+	}
+	rec.Completed = true
+	return nil
+}
+
+// Release libera la clave para que el cliente pueda reintentar, p. ej. tras
+// un error interno. Devuelve ErrIdempotencyLeaseLost si otra petición tomó la
+// reserva; su registro se deja intacto.
+func (r *IdempotencyRepository) Release(rec *models.IdempotencyRecord) error {
+	result := r.db.Unscoped().
+		Where("id = ? AND lease_token = ? AND completed = ?", rec.ID, rec.LeaseToken, false).
+		Delete(&models.IdempotencyRecord{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrIdempotencyLeaseLost
+	}
+	return nil
+}
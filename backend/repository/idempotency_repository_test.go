@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"backend-avanzada/models"
+	"errors"
+	"testing"
+	"time"
+)
+
+func idempotencyRecord(now time.Time) *models.IdempotencyRecord {
+	return &models.IdempotencyRecord{
+		Scope:          "user:1",
+		IdempotencyKey: "key",
+		Method:         "POST",
+		Path:           "/transmutations",
+		RequestHash:    "hash",
+		ExpiresAt:      now.Add(24 * time.Hour),
+		LockedUntil:    now.Add(time.Minute),
+	}
+}
+
+func TestIdempotencyTakeOverFencesOriginalRequest(t *testing.T) {
+	repo := NewIdempotencyRepository(newTestDB(t))
+	now := time.Now().UTC()
+
+	original, acquired, err := repo.Begin(idempotencyRecord(now), now)
+	if err != nil || !acquired {
+		t.Fatalf("first Begin = %v, %v", acquired, err)
+	}
+	if _, acquired, err := repo.Begin(idempotencyRecord(now), now); err != nil || acquired {
+		t.Fatalf("Begin while the lease is held = %v, %v, want not acquired", acquired, err)
+	}
+
+	// La petición original se retrasa más que la reserva y un reintento la toma.
+	later := now.Add(2 * time.Minute)
+	retry, acquired, err := repo.Begin(idempotencyRecord(later), later)
+	if err != nil || !acquired {
+		t.Fatalf("Begin after the lease expired = %v, %v", acquired, err)
+	}
+	if retry.ID != original.ID || retry.LeaseToken == original.LeaseToken {
+		t.Fatalf("takeover reused record %d with token %q, want record %d with a new token", retry.ID, retry.LeaseToken, original.ID)
+	}
+
+	original.StatusCode = 201
+	original.Body = []byte("stale")
+	if err := repo.Complete(original); !errors.Is(err, ErrIdempotencyLeaseLost) {
+		t.Errorf("Complete by the original request = %v, want %v", err, ErrIdempotencyLeaseLost)
+	}
+	if err := repo.Release(original); !errors.Is(err, ErrIdempotencyLeaseLost) {
+		t.Errorf("Release by the original request = %v, want %v", err, ErrIdempotencyLeaseLost)
+	}
+	stored, err := repo.find("user:1", "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored == nil || stored.Completed || stored.LeaseToken != retry.LeaseToken {
+		t.Fatalf("record after the stale calls = %+v, want the retry's open lease", stored)
+	}
+
+	retry.StatusCode = 201
+	retry.Body = []byte("fresh")
+	if err := repo.Complete(retry); err != nil {
+		t.Fatalf("Complete by the retry: %v", err)
+	}
+	replay, acquired, err := repo.Begin(idempotencyRecord(later), later)
+	if err != nil || acquired || !replay.Completed || string(replay.Body) != "fresh" {
+		t.Errorf("Begin after completion = %+v, %v, %v, want the retry's response", replay, acquired, err)
+	}
+	if err := repo.Release(retry); !errors.Is(err, ErrIdempotencyLeaseLost) {
+		t.Errorf("Release after completion = %v, want %v", err, ErrIdempotencyLeaseLost)
+	}
+}
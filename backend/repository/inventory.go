@@ -0,0 +1,576 @@
+package repository
+
+import (
+	"backend-avanzada/models"
+	"errors"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// materialAmount es una cantidad de un material concreto dentro de una operación de inventario.
+type materialAmount struct {
+	MaterialID uint
+	Quantity   float64
+}
+
+// mergeAmounts agrupa las cantidades por material y las ordena por ID.
+func mergeAmounts(amounts []materialAmount) []materialAmount {
+	totals := map[uint]float64{}
+	for _, a := range amounts {
+		totals[a.MaterialID] += a.Quantity
+	}
+	merged := make([]materialAmount, 0, len(totals))
+	for id, qty := range totals {
+		merged = append(merged, materialAmount{MaterialID: id, Quantity: qty})
+	}
+	sort.Slice(merged, func(i, j int) bool { return merged[i].MaterialID < merged[j].MaterialID })
+	return merged
+}
+
+// stockRef identifica qué transmutación o qué usuario causó un movimiento de
+// inventario y en qué ubicación.
+type stockRef struct {
+	TransmutationID *uint
+	Actor           string
+	Reason          string
+	LocationID      uint
+}
+
+func transmutationRef(t *models.Transmutation, actor, reason string) stockRef {
+	id := t.ID
+	return stockRef{TransmutationID: &id, Actor: actor, Reason: reason, LocationID: locationOf(t)}
+}
+
+// recordMovement anota en el libro un movimiento ya aplicado a la existencia.
+func recordMovement(tx *gorm.DB, materialID uint, kind string, quantity float64, ref stockRef) error {
+	movement := &models.StockMovement{
+		MaterialID:      materialID,
+		Kind:            kind,
+		Quantity:        quantity,
+		TransmutationID: ref.TransmutationID,
+		Actor:           ref.Actor,
+		Reason:          ref.Reason,
+	}
+	if ref.LocationID != 0 {
+		locationID := ref.LocationID
+		movement.LocationID = &locationID
+	}
+	return tx.Create(movement).Error
+}
+
+// recordMovements anota un movimiento por material con el signo de kind.
+func recordMovements(tx *gorm.DB, amounts []materialAmount, kind string, ref stockRef) error {
+	sign := 1.0
+	if kind == models.StockMovementConsumption {
+		sign = -1
+	}
+	for _, a := range amounts {
+		if err := recordMovement(tx, a.MaterialID, kind, sign*a.Quantity, ref); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lockMaterial obtiene la fila del material con bloqueo de escritura.
+func lockMaterial(tx *gorm.DB, id uint) (*models.Material, error) {
+	var material models.Material
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&material, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrMaterialNotFound
+		}
+		return nil, err
+	}
+	return &material, nil
+}
+
+// reserveMaterials aparta todas las cantidades en locationID (o, si es 0, en
+// la primera ubicación que lo tenga todo, ver pickLocation) dentro de la
+// transacción sin descontarlas todavía de la existencia. Los materiales se
+// bloquean siempre en orden ascendente de ID para evitar interbloqueos. Lo
+// disponible es la existencia en la ubicación menos lo ya reservado allí y lo
+// que está en sus lotes caducados. Devuelve la ubicación usada; quien la llama
+// registra las reservas (recordReservations) cuando conoce la transmutación.
+func reserveMaterials(tx *gorm.DB, amounts []materialAmount, locationID uint) (uint, error) {
+	merged := mergeAmounts(amounts)
+	materials := make([]*models.Material, len(merged))
+	for i, a := range merged {
+		material, err := lockMaterial(tx, a.MaterialID)
+		if err != nil {
+			return 0, err
+		}
+		materials[i] = material
+	}
+	now := time.Now()
+	var err error
+	if locationID == 0 {
+		locationID, err = pickLocation(tx, merged, now)
+	} else {
+		locationID, err = resolveLocation(tx, locationID)
+	}
+	if err != nil {
+		return 0, err
+	}
+	for i, a := range merged {
+		available, err := availableAt(tx, a.MaterialID, locationID, now)
+		if err != nil {
+			return 0, err
+		}
+		if available < a.Quantity {
+			return 0, ErrInsufficientMaterial
+		}
+		if _, err := adjustStock(tx, a.MaterialID, locationID, 0, a.Quantity); err != nil {
+			return 0, err
+		}
+		material := materials[i]
+		material.Reserved += a.Quantity
+		if err := tx.Save(material).Error; err != nil {
+			return 0, err
+		}
+		if err := checkReorder(tx, material, "reserved by a transmutation"); err != nil {
+			return 0, err
+		}
+	}
+	return locationID, nil
+}
+
+// recordReservations guarda lo apartado por el intento actual de t en su ubicación.
+func recordReservations(tx *gorm.DB, t *models.Transmutation, amounts []materialAmount) error {
+	for _, a := range mergeAmounts(amounts) {
+		reservation := &models.StockReservation{
+			MaterialID:      a.MaterialID,
+			TransmutationID: t.ID,
+			Attempt:         t.Attempts,
+			Quantity:        a.Quantity,
+			Status:          models.StockReservationActive,
+			LocationID:      locationOf(t),
+		}
+		if err := tx.Create(reservation).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// activeReservations devuelve las reservas activas de t ordenadas por material.
+func activeReservations(tx *gorm.DB, t *models.Transmutation) ([]models.StockReservation, error) {
+	var reservations []models.StockReservation
+	err := tx.Where("transmutation_id = ? AND status = ?", t.ID, models.StockReservationActive).
+		Order("material_id, id").
+		Find(&reservations).Error
+	return reservations, err
+}
+
+// releaseReservations libera las reservas activas de t sin tocar la
+// existencia. Devuelve false si no tenía ninguna (transmutaciones anteriores a
+// las reservas, que descontaron el stock al crearse).
+func releaseReservations(tx *gorm.DB, t *models.Transmutation) (bool, error) {
+	reservations, err := activeReservations(tx, t)
+	if err != nil || len(reservations) == 0 {
+		return false, err
+	}
+	for i := range reservations {
+		res := &reservations[i]
+		material, err := lockMaterial(tx, res.MaterialID)
+		if err != nil && !errors.Is(err, ErrMaterialNotFound) {
+			return false, err
+		}
+		if material != nil {
+			material.Reserved = math.Max(0, material.Reserved-res.Quantity)
+			if err := tx.Save(material).Error; err != nil {
+				return false, err
+			}
+			locationID, err := orDefault(tx, res.LocationID)
+			if err != nil {
+				return false, err
+			}
+			if _, err := adjustStock(tx, res.MaterialID, locationID, 0, -res.Quantity); err != nil {
+				return false, err
+			}
+		}
+		if err := tx.Model(res).Update("status", models.StockReservationReleased).Error; err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// consumeReservations convierte las reservas activas de t en consumo: descuenta
+// la existencia de su ubicación, toma las cantidades de los lotes (drawLots) y
+// lo anota en el libro.
+func consumeReservations(tx *gorm.DB, t *models.Transmutation, actor string) error {
+	reservations, err := activeReservations(tx, t)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for i := range reservations {
+		res := &reservations[i]
+		material, err := lockMaterial(tx, res.MaterialID)
+		if err != nil && !errors.Is(err, ErrMaterialNotFound) {
+			return err
+		}
+		// Si el material se eliminó después de reservarse no hay nada que descontar.
+		if material != nil {
+			locationID, err := orDefault(tx, res.LocationID)
+			if err != nil {
+				return err
+			}
+			stock, err := locationStock(tx, material.ID, locationID)
+			if err != nil {
+				return err
+			}
+			if err := drawLots(tx, t, stock, res.Quantity, now); err != nil {
+				return err
+			}
+			if _, err := adjustStock(tx, material.ID, locationID, -res.Quantity, -res.Quantity); err != nil {
+				return err
+			}
+			material.Quantity -= res.Quantity
+			material.Reserved = math.Max(0, material.Reserved-res.Quantity)
+			if err := tx.Save(material).Error; err != nil {
+				return err
+			}
+			ref := transmutationRef(t, actor, "consumed on completion")
+			ref.LocationID = locationID
+			if err := recordMovement(tx, res.MaterialID, models.StockMovementConsumption, -res.Quantity, ref); err != nil {
+				return err
+			}
+		}
+		if err := tx.Model(res).Update("status", models.StockReservationConsumed).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// productMaterial devuelve el material con ese nombre o, si no existe, lo da
+// de alta sin existencias para poder acreditarlo, con la categoría y la unidad
+// de source y el valor energético con el que se evaluó el producto. Si otra
+// transacción lo crea a la vez, el índice único sobre el nombre rechaza esta
+// alta (en un savepoint, para no abortar la transacción) y se toma el suyo.
+func productMaterial(tx *gorm.DB, name string, source *models.Material, energyValue float64) (*models.Material, bool, error) {
+	name = strings.TrimSpace(name)
+	existing, err := materialByName(tx, name)
+	if existing != nil || err != nil {
+		return existing, false, err
+	}
+	material := &models.Material{Name: name, EnergyValue: energyValue}
+	if source != nil {
+		material.Category = source.Category
+		material.Unit = source.Unit
+	}
+	createErr := tx.Transaction(func(sp *gorm.DB) error {
+		return sp.Create(material).Error
+	})
+	if createErr == nil {
+		return material, true, nil
+	}
+	existing, err = materialByName(tx, name)
+	if err != nil {
+		return nil, false, err
+	}
+	if existing == nil {
+		return nil, false, createErr
+	}
+	return existing, false, nil
+}
+
+func materialByName(tx *gorm.DB, name string) (*models.Material, error) {
+	var ms []models.Material
+	if err := tx.Where("LOWER(name) = LOWER(?)", name).Order("id").Limit(1).Find(&ms).Error; err != nil {
+		return nil, err
+	}
+	if len(ms) == 0 {
+		return nil, nil
+	}
+	return &ms[0], nil
+}
+
+// creditMaterials suma al inventario de la ubicación de ref (la predeterminada
+// si no tiene) las cantidades producidas y las anota en el libro.
+func creditMaterials(tx *gorm.DB, amounts []materialAmount, ref stockRef) error {
+	locationID, err := orDefault(tx, ref.LocationID)
+	if err != nil {
+		return err
+	}
+	ref.LocationID = locationID
+	merged := mergeAmounts(amounts)
+	for _, a := range merged {
+		material, err := lockMaterial(tx, a.MaterialID)
+		if err != nil {
+			return err
+		}
+		material.Quantity += a.Quantity
+		if err := tx.Save(material).Error; err != nil {
+			return err
+		}
+		if _, err := adjustStock(tx, a.MaterialID, locationID, a.Quantity, 0); err != nil {
+			return err
+		}
+	}
+	return recordMovements(tx, merged, models.StockMovementProduction, ref)
+}
+
+// lotStock suma lo que queda en los lotes del material (en locationID si no
+// es 0); con expiredAt, solo en los que ya habían caducado en ese momento.
+func lotStock(tx *gorm.DB, materialID, locationID uint, expiredAt *time.Time) (float64, error) {
+	query := tx.Model(&models.MaterialLot{}).
+		Select("COALESCE(SUM(quantity), 0)").
+		Where("material_id = ? AND quantity > 0", materialID)
+	if locationID != 0 {
+		query = query.Where("location_id = ?", locationID)
+	}
+	if expiredAt != nil {
+		query = query.Where("expires_at IS NOT NULL AND expires_at <= ?", *expiredAt)
+	}
+	var total float64
+	return total, query.Scan(&total).Error
+}
+
+// drawLots reparte lo que el intento actual de t consume de stock entre los
+// lotes de esa ubicación: primero los vigentes que caducan antes (FEFO) y
+// después los que no caducan; luego las existencias sin lote y, solo si un
+// lote caducó mientras la reserva esperaba, los lotes caducados. El material
+// está bloqueado y a stock aún no se le ha descontado quantity.
+func drawLots(tx *gorm.DB, t *models.Transmutation, stock *models.MaterialStock, quantity float64, at time.Time) error {
+	var lots []models.MaterialLot
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("material_id = ? AND location_id = ? AND quantity > 0", stock.MaterialID, stock.LocationID).
+		Order("expires_at IS NULL, expires_at, received_at, id").
+		Find(&lots).Error
+	if err != nil {
+		return err
+	}
+	inLots := 0.0
+	usable, expired := []*models.MaterialLot{}, []*models.MaterialLot{}
+	for i := range lots {
+		inLots += lots[i].Quantity
+		if lots[i].Expired(at) {
+			expired = append(expired, &lots[i])
+		} else {
+			usable = append(usable, &lots[i])
+		}
+	}
+	remaining, err := drawFrom(tx, t, usable, quantity)
+	if err != nil {
+		return err
+	}
+	remaining -= math.Min(remaining, math.Max(0, stock.Quantity-inLots))
+	_, err = drawFrom(tx, t, expired, remaining)
+	return err
+}
+
+// drawFrom toma quantity de los lotes en orden y devuelve lo que falte.
+func drawFrom(tx *gorm.DB, t *models.Transmutation, lots []*models.MaterialLot, quantity float64) (float64, error) {
+	for _, lot := range lots {
+		if quantity <= 0 {
+			break
+		}
+		take := math.Min(quantity, lot.Quantity)
+		quantity -= take
+		if err := tx.Model(lot).Update("quantity", lot.Quantity-take).Error; err != nil {
+			return 0, err
+		}
+		draw := &models.TransmutationLotDraw{
+			TransmutationID: t.ID,
+			Attempt:         t.Attempts,
+			LotID:           lot.ID,
+			MaterialID:      lot.MaterialID,
+			Quantity:        take,
+		}
+		if err := tx.Create(draw).Error; err != nil {
+			return 0, err
+		}
+	}
+	return quantity, nil
+}
+
+// returnLotDraws devuelve a sus lotes lo que tomó el intento actual de t. Si
+// un lote se borró entretanto, esa cantidad vuelve como existencia sin lote.
+func returnLotDraws(tx *gorm.DB, t *models.Transmutation) error {
+	var draws []models.TransmutationLotDraw
+	if err := tx.Where("transmutation_id = ? AND attempt = ?", t.ID, t.Attempts).Order("lot_id").Find(&draws).Error; err != nil {
+		return err
+	}
+	for i := range draws {
+		err := tx.Model(&models.MaterialLot{}).
+			Where("id = ?", draws[i].LotID).
+			Update("quantity", gorm.Expr("quantity + ?", draws[i].Quantity)).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Delete(&draws[i]).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// receiveStock suma quantity al material bloqueado en la ubicación de ref (la
+// predeterminada si no tiene), como lote si lot no es nil, y lo anota en el
+// libro como entrada.
+func receiveStock(tx *gorm.DB, material *models.Material, quantity float64, lot *models.MaterialLot, ref stockRef) error {
+	locationID, err := resolveLocation(tx, ref.LocationID)
+	if err != nil {
+		return err
+	}
+	ref.LocationID = locationID
+	if lot != nil {
+		lot.MaterialID = material.ID
+		lot.LocationID = locationID
+		lot.Quantity = quantity
+		if err := tx.Omit("Material").Create(lot).Error; err != nil {
+			return err
+		}
+	}
+	material.Quantity += quantity
+	if err := tx.Save(material).Error; err != nil {
+		return err
+	}
+	if _, err := adjustStock(tx, material.ID, locationID, quantity, 0); err != nil {
+		return err
+	}
+	return recordMovement(tx, material.ID, models.StockMovementReceipt, quantity, ref)
+}
+
+// checkReorder abre una solicitud de reposición si lo no reservado del
+// material bloqueado está en su punto de pedido o por debajo y no tiene ya
+// una pendiente. Sin ReorderQuantity se pide el propio punto de pedido.
+func checkReorder(tx *gorm.DB, material *models.Material, trigger string) error {
+	if material.ReorderLevel <= 0 {
+		return nil
+	}
+	available := material.Quantity - material.Reserved
+	if available > material.ReorderLevel {
+		return nil
+	}
+	var pending int64
+	err := tx.Model(&models.RestockRequest{}).
+		Where("material_id = ? AND status IN ?", material.ID, []string{models.RestockStatusOpen, models.RestockStatusApproved}).
+		Count(&pending).Error
+	if err != nil || pending > 0 {
+		return err
+	}
+	quantity := material.ReorderQuantity
+	if quantity <= 0 {
+		quantity = material.ReorderLevel
+	}
+	return tx.Omit("Material").Create(&models.RestockRequest{
+		MaterialID: material.ID,
+		Quantity:   quantity,
+		Status:     models.RestockStatusOpen,
+		Available:  available,
+		Trigger:    trigger,
+	}).Error
+}
+
+// locationOf devuelve la ubicación de t, o 0 si es anterior a las ubicaciones.
+func locationOf(t *models.Transmutation) uint {
+	if t.LocationID == nil {
+		return 0
+	}
+	return *t.LocationID
+}
+
+// defaultLocation devuelve la ubicación predeterminada.
+func defaultLocation(tx *gorm.DB) (uint, error) {
+	var locations []models.Location
+	if err := tx.Where("is_default = ?", true).Order("id").Limit(1).Find(&locations).Error; err != nil {
+		return 0, err
+	}
+	if len(locations) == 0 {
+		return 0, ErrNoDefaultLocation
+	}
+	return locations[0].ID, nil
+}
+
+// orDefault devuelve id o, si es 0, la ubicación predeterminada.
+func orDefault(tx *gorm.DB, id uint) (uint, error) {
+	if id != 0 {
+		return id, nil
+	}
+	return defaultLocation(tx)
+}
+
+// resolveLocation es orDefault comprobando además que la ubicación existe.
+func resolveLocation(tx *gorm.DB, id uint) (uint, error) {
+	if id == 0 {
+		return defaultLocation(tx)
+	}
+	var count int64
+	if err := tx.Model(&models.Location{}).Where("id = ?", id).Count(&count).Error; err != nil {
+		return 0, err
+	}
+	if count == 0 {
+		return 0, ErrLocationNotFound
+	}
+	return id, nil
+}
+
+// locationStock devuelve la existencia del material en la ubicación, que se
+// crea vacía si aún no la tenía. Quien la llama ya tiene bloqueado el
+// material, así que no hace falta bloquear también la fila.
+func locationStock(tx *gorm.DB, materialID, locationID uint) (*models.MaterialStock, error) {
+	stock := models.MaterialStock{MaterialID: materialID, LocationID: locationID}
+	err := tx.Where("material_id = ? AND location_id = ?", materialID, locationID).FirstOrCreate(&stock).Error
+	return &stock, err
+}
+
+// adjustStock suma quantity y reserved a la existencia del material en la ubicación.
+func adjustStock(tx *gorm.DB, materialID, locationID uint, quantity, reserved float64) (*models.MaterialStock, error) {
+	stock, err := locationStock(tx, materialID, locationID)
+	if err != nil {
+		return nil, err
+	}
+	stock.Quantity += quantity
+	stock.Reserved = math.Max(0, stock.Reserved+reserved)
+	return stock, tx.Omit(clause.Associations).Save(stock).Error
+}
+
+// availableAt es lo que aún puede reservarse del material en la ubicación.
+func availableAt(tx *gorm.DB, materialID, locationID uint, at time.Time) (float64, error) {
+	var stocks []models.MaterialStock
+	if err := tx.Where("material_id = ? AND location_id = ?", materialID, locationID).Limit(1).Find(&stocks).Error; err != nil {
+		return 0, err
+	}
+	if len(stocks) == 0 {
+		return 0, nil
+	}
+	expired, err := lotStock(tx, materialID, locationID, &at)
+	if err != nil {
+		return 0, err
+	}
+	return stocks[0].Quantity - stocks[0].Reserved - expired, nil
+}
+
+// pickLocation elige la primera ubicación (la predeterminada antes que las
+// demás, luego por ID) donde está disponible todo lo necesario.
+func pickLocation(tx *gorm.DB, amounts []materialAmount, at time.Time) (uint, error) {
+	var locations []models.Location
+	if err := tx.Order("is_default DESC, id").Find(&locations).Error; err != nil {
+		return 0, err
+	}
+	for _, location := range locations {
+		fits := true
+		for _, a := range amounts {
+			available, err := availableAt(tx, a.MaterialID, location.ID, at)
+			if err != nil {
+				return 0, err
+			}
+			if available < a.Quantity {
+				fits = false
+				break
+			}
+		}
+		if fits {
+			return location.ID, nil
+		}
+	}
+	return 0, ErrInsufficientMaterial
+}
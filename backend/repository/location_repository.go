@@ -0,0 +1,255 @@
+package repository
+
+import (
+	"backend-avanzada/models"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrLocationNotFound  = errors.New("location not found")
+	ErrNoDefaultLocation = errors.New("no default location configured")
+	ErrLocationInUse     = errors.New("location still holds stock, reservations or lots")
+	ErrDefaultLocation   = errors.New("the default location cannot be deleted")
+	ErrSameLocation      = errors.New("source and destination locations must differ")
+	ErrLotNotAtLocation  = errors.New("lot is not stored at the source location")
+)
+
+// DefaultLocationName es el nombre con que se crea la ubicación predeterminada.
+const DefaultLocationName = "Main storage"
+
+type LocationRepository struct{ db *gorm.DB }
+
+func NewLocationRepository(db *gorm.DB) *LocationRepository { return &LocationRepository{db: db} }
+
+// Save guarda la ubicación; si queda como predeterminada, las demás dejan de serlo.
+func (r *LocationRepository) Save(l *models.Location) (*models.Location, error) {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if l.IsDefault {
+			if err := tx.Model(&models.Location{}).Where("id <> ? AND is_default = ?", l.ID, true).
+				Update("is_default", false).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Save(l).Error
+	})
+	return l, err
+}
+
+func (r *LocationRepository) FindAll() ([]*models.Location, error) {
+	var xs []*models.Location
+	return xs, r.db.Order("is_default DESC, name, id").Find(&xs).Error
+}
+
+func (r *LocationRepository) FindById(id int) (*models.Location, error) {
+	var l models.Location
+	if err := r.db.First(&l, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &l, nil
+}
+
+// Delete borra una ubicación vacía: sin existencias, reservas ni lotes. La
+// predeterminada no se puede borrar; antes hay que marcar otra.
+func (r *LocationRepository) Delete(l *models.Location) error {
+	if l.IsDefault {
+		return ErrDefaultLocation
+	}
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		// Lo que queda de materiales borrados no impide borrar la ubicación.
+		var held int64
+		if err := tx.Model(&models.MaterialStock{}).
+			Where("location_id = ? AND (quantity <> 0 OR reserved <> 0)", l.ID).
+			Where("material_id IN (?)", liveMaterialIDs(tx)).Count(&held).Error; err != nil {
+			return err
+		}
+		if held == 0 {
+			if err := tx.Model(&models.MaterialLot{}).
+				Where("location_id = ? AND quantity > 0", l.ID).
+				Where("material_id IN (?)", liveMaterialIDs(tx)).Count(&held).Error; err != nil {
+				return err
+			}
+		}
+		if held > 0 {
+			return ErrLocationInUse
+		}
+		if err := tx.Where("location_id = ?", l.ID).Delete(&models.MaterialStock{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(l).Error
+	})
+}
+
+// liveMaterialIDs es la subconsulta de los materiales no borrados.
+func liveMaterialIDs(tx *gorm.DB) *gorm.DB {
+	return tx.Session(&gorm.Session{NewDB: true}).Model(&models.Material{}).Select("id")
+}
+
+// Stock devuelve las existencias guardadas en la ubicación con su material.
+func (r *LocationRepository) Stock(locationID uint) ([]*models.MaterialStock, error) {
+	var stocks []*models.MaterialStock
+	err := r.db.Preload("Material").
+		Where("location_id = ? AND (quantity <> 0 OR reserved <> 0)", locationID).
+		Where("material_id IN (?)", liveMaterialIDs(r.db)).
+		Order("material_id").Find(&stocks).Error
+	return stocks, err
+}
+
+// Transfers devuelve los traslados, del material indicado si materialID no es 0.
+func (r *LocationRepository) Transfers(materialID uint) ([]*models.StockTransfer, error) {
+	var transfers []*models.StockTransfer
+	db := r.db.Preload("Material").Preload("FromLocation").Preload("ToLocation")
+	if materialID != 0 {
+		db = db.Where("material_id = ?", materialID)
+	}
+	return transfers, db.Order("id").Find(&transfers).Error
+}
+
+// Transfer mueve tr.Quantity del material de una ubicación a otra en una sola
+// transacción. Solo puede moverse lo que no está reservado ni caducado; sin
+// lote, además, lo que no pertenece a ningún lote, y con lote, a lo sumo lo
+// que queda en él (se parte si no se mueve entero). Deja dos movimientos
+// "transfer" en el libro que se compensan entre sí.
+func (r *LocationRepository) Transfer(tr *models.StockTransfer) (*models.StockTransfer, error) {
+	if tr.FromLocationID == tr.ToLocationID {
+		return nil, ErrSameLocation
+	}
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if _, err := lockMaterial(tx, tr.MaterialID); err != nil {
+			return err
+		}
+		for _, id := range []uint{tr.FromLocationID, tr.ToLocationID} {
+			if _, err := resolveLocation(tx, id); err != nil {
+				return err
+			}
+		}
+		now := time.Now()
+		available, err := availableAt(tx, tr.MaterialID, tr.FromLocationID, now)
+		if err != nil {
+			return err
+		}
+		if available < tr.Quantity {
+			return ErrInsufficientMaterial
+		}
+		if tr.LotID == nil {
+			from, err := locationStock(tx, tr.MaterialID, tr.FromLocationID)
+			if err != nil {
+				return err
+			}
+			inLots, err := lotStock(tx, tr.MaterialID, tr.FromLocationID, nil)
+			if err != nil {
+				return err
+			}
+			if from.Quantity-inLots < tr.Quantity {
+				return ErrInsufficientMaterial
+			}
+		} else if err := moveLot(tx, tr, now); err != nil {
+			return err
+		}
+		if _, err := adjustStock(tx, tr.MaterialID, tr.FromLocationID, -tr.Quantity, 0); err != nil {
+			return err
+		}
+		if _, err := adjustStock(tx, tr.MaterialID, tr.ToLocationID, tr.Quantity, 0); err != nil {
+			return err
+		}
+		if err := tx.Omit(clause.Associations).Create(tr).Error; err != nil {
+			return err
+		}
+		reason := fmt.Sprintf("transfer #%d", tr.ID)
+		if tr.Reason != "" {
+			reason += ": " + tr.Reason
+		}
+		out := stockRef{Actor: tr.Actor, Reason: reason, LocationID: tr.FromLocationID}
+		if err := recordMovement(tx, tr.MaterialID, models.StockMovementTransfer, -tr.Quantity, out); err != nil {
+			return err
+		}
+		in := stockRef{Actor: tr.Actor, Reason: reason, LocationID: tr.ToLocationID}
+		return recordMovement(tx, tr.MaterialID, models.StockMovementTransfer, tr.Quantity, in)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tr, r.db.Preload("Material").Preload("FromLocation").Preload("ToLocation").First(tr, tr.ID).Error
+}
+
+// moveLot lleva el lote de tr a la ubicación de destino, o solo tr.Quantity
+// de él en un lote nuevo con el mismo número y caducidad. Un lote caducado no
+// se traslada: está a la espera de retirarse.
+func moveLot(tx *gorm.DB, tr *models.StockTransfer, at time.Time) error {
+	var lot models.MaterialLot
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("material_id = ?", tr.MaterialID).First(&lot, *tr.LotID).Error
+	if err == gorm.ErrRecordNotFound {
+		return ErrLotNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if lot.LocationID != tr.FromLocationID {
+		return ErrLotNotAtLocation
+	}
+	if lot.Expired(at) || lot.Quantity < tr.Quantity {
+		return ErrInsufficientMaterial
+	}
+	if lot.Quantity == tr.Quantity {
+		return tx.Model(&lot).Update("location_id", tr.ToLocationID).Error
+	}
+	if err := tx.Model(&lot).Update("quantity", lot.Quantity-tr.Quantity).Error; err != nil {
+		return err
+	}
+	split := models.MaterialLot{
+		MaterialID: lot.MaterialID,
+		LotNumber:  lot.LotNumber,
+		ReceivedAt: lot.ReceivedAt,
+		ExpiresAt:  lot.ExpiresAt,
+		Quantity:   tr.Quantity,
+		LocationID: tr.ToLocationID,
+	}
+	return tx.Create(&split).Error
+}
+
+// OpenLocations prepara las ubicaciones al arrancar: crea la predeterminada si
+// no hay ninguna y lleva a ella las existencias, lotes y reservas anteriores a
+// las ubicaciones. Devuelve cuántos materiales abrió en ella.
+func (r *LocationRepository) OpenLocations() (int, error) {
+	opened := 0
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		locationID, err := defaultLocation(tx)
+		if errors.Is(err, ErrNoDefaultLocation) {
+			location := models.Location{Name: DefaultLocationName, IsDefault: true}
+			if err := tx.Create(&location).Error; err != nil {
+				return err
+			}
+			locationID, err = location.ID, nil
+		}
+		if err != nil {
+			return err
+		}
+		var materials []models.Material
+		if err := tx.Where("NOT EXISTS (SELECT 1 FROM material_stocks WHERE material_stocks.material_id = materials.id AND material_stocks.deleted_at IS NULL)").
+			Order("id").Find(&materials).Error; err != nil {
+			return err
+		}
+		for _, m := range materials {
+			stock := models.MaterialStock{MaterialID: m.ID, LocationID: locationID, Quantity: m.Quantity, Reserved: m.Reserved}
+			if err := tx.Create(&stock).Error; err != nil {
+				return err
+			}
+			opened++
+		}
+		if err := tx.Model(&models.MaterialLot{}).Where("location_id = 0").
+			Update("location_id", locationID).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.StockReservation{}).Where("location_id = 0").
+			Update("location_id", locationID).Error
+	})
+	return opened, err
+}
@@ -2,8 +2,28 @@ package repository
 
 import (
 	"backend-avanzada/models"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrLotNotFound       = errors.New("material lot not found")
+	ErrMaterialNameTaken = errors.New("a material with that name already exists")
+	// ErrBelowLotStock impide fijar una existencia menor que lo que hay en
+	// lotes: esa diferencia se ajusta en los propios lotes.
+	ErrBelowLotStock = errors.New("quantity is lower than the stock held in lots")
+	// ErrBelowReserved impide dejar la existencia por debajo de lo reservado
+	// por transmutaciones en curso.
+	ErrBelowReserved = errors.New("quantity is lower than the stock reserved by transmutations")
+	// ErrBelowLocationStock impide que un ajuste deje en negativo la
+	// existencia de la ubicación en la que se aplica.
+	ErrBelowLocationStock = errors.New("adjustment exceeds the stock held at the location")
 )
 
 type MaterialRepository struct {
@@ -14,8 +34,127 @@ func NewMaterialRepository(db *gorm.DB) *MaterialRepository {
 	return &MaterialRepository{db: db}
 }
 
-func (r *MaterialRepository) Save(m *models.Material) (*models.Material, error) {
-	return m, r.db.Save(m).Error
+// Create da de alta el material con su existencia inicial en locationID (la
+// predeterminada si es 0) y la anota como entrada.
+func (r *MaterialRepository) Create(m *models.Material, locationID uint, actor string) (*models.Material, error) {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		locationID, err := resolveLocation(tx, locationID)
+		if err != nil {
+			return err
+		}
+		if err := checkMaterialName(tx, m); err != nil {
+			return err
+		}
+		if err := tx.Create(m).Error; err != nil {
+			return err
+		}
+		if _, err := adjustStock(tx, m.ID, locationID, m.Quantity, 0); err != nil {
+			return err
+		}
+		if m.Quantity != 0 {
+			ref := stockRef{Actor: actor, Reason: "initial stock", LocationID: locationID}
+			if err := recordMovement(tx, m.ID, models.StockMovementReceipt, m.Quantity, ref); err != nil {
+				return err
+			}
+		}
+		return checkReorder(tx, m, "initial stock")
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Update guarda los datos descriptivos de m. Si quantity no es nil fija la
+// existencia total a ese valor y anota la diferencia como ajuste en
+// locationID (la predeterminada si es 0), sobre la fila bloqueada para no
+// pisar reservas simultáneas.
+func (r *MaterialRepository) Update(m *models.Material, quantity *float64, locationID uint, actor, reason string) (*models.Material, error) {
+	var updated *models.Material
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		current, err := lockMaterial(tx, m.ID)
+		if err != nil {
+			return err
+		}
+		current.Name = m.Name
+		if err := checkMaterialName(tx, current); err != nil {
+			return err
+		}
+		current.Category = m.Category
+		current.EnergyValue = m.EnergyValue
+		current.Unit = m.Unit
+		current.Density = m.Density
+		current.ReorderLevel = m.ReorderLevel
+		current.ReorderQuantity = m.ReorderQuantity
+		if quantity != nil && *quantity != current.Quantity {
+			locationID, err := resolveLocation(tx, locationID)
+			if err != nil {
+				return err
+			}
+			stock, err := locationStock(tx, current.ID, locationID)
+			if err != nil {
+				return err
+			}
+			inLots, err := lotStock(tx, current.ID, locationID, nil)
+			if err != nil {
+				return err
+			}
+			delta := *quantity - current.Quantity
+			switch remaining := stock.Quantity + delta; {
+			case remaining < 0:
+				return ErrBelowLocationStock
+			case remaining < inLots:
+				return ErrBelowLotStock
+			case remaining < stock.Reserved:
+				return ErrBelowReserved
+			}
+			if _, err := adjustStock(tx, current.ID, locationID, delta, 0); err != nil {
+				return err
+			}
+			current.Quantity = *quantity
+			if reason == "" {
+				reason = "manual adjustment"
+			}
+			ref := stockRef{Actor: actor, Reason: reason, LocationID: locationID}
+			if err := recordMovement(tx, current.ID, models.StockMovementAdjustment, delta, ref); err != nil {
+				return err
+			}
+		}
+		if err := tx.Save(current).Error; err != nil {
+			return err
+		}
+		if err := checkReorder(tx, current, "edited by "+actor); err != nil {
+			return err
+		}
+		updated = current
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// checkMaterialName impide dos materiales con el mismo nombre: los productos
+// de las fórmulas se acreditan buscando el material por nombre.
+func checkMaterialName(tx *gorm.DB, m *models.Material) error {
+	var count int64
+	if err := tx.Model(&models.Material{}).
+		Where("LOWER(name) = LOWER(?) AND id <> ?", strings.TrimSpace(m.Name), m.ID).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrMaterialNameTaken
+	}
+	return nil
+}
+
+// EnsureUniqueNames crea el índice único sobre LOWER(name) de los materiales
+// vigentes, que resuelve las altas simultáneas del mismo producto. Falla si ya
+// hay nombres repetidos.
+func (r *MaterialRepository) EnsureUniqueNames() error {
+	return r.db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_materials_lower_name ON materials (LOWER(name)) WHERE deleted_at IS NULL").Error
 }
 
 func (r *MaterialRepository) FindAll() ([]*models.Material, error) {
@@ -34,12 +173,238 @@ func (r *MaterialRepository) FindById(id int) (*models.Material, error) {
 	return &m, nil
 }
 
+// FindByName busca un material por nombre sin distinguir mayúsculas.
+func (r *MaterialRepository) FindByName(name string) (*models.Material, error) {
+	var ms []*models.Material
+	if err := r.db.Where("LOWER(name) = LOWER(?)", strings.TrimSpace(name)).Order("id").Limit(1).Find(&ms).Error; err != nil {
+		return nil, err
+	}
+	if len(ms) == 0 {
+		return nil, nil
+	}
+	return ms[0], nil
+}
+
 func (r *MaterialRepository) Delete(m *models.Material) error {
 	return r.db.Delete(m).Error
 }
 
-func (r *MaterialRepository) FindScarce(threshold float64) ([]*models.Material, error) {
-	var materials []*models.Material
-	err := r.db.Where("quantity <= ?", threshold).Find(&materials).Error
-	return materials, err
+// FindScarce devuelve, por ubicación, las existencias cuya parte no reservada
+// está en el punto de pedido del material o por debajo (threshold si no lo
+// tiene), con su material y su ubicación. Las ubicaciones vacías de un
+// material que sí tiene existencias en otra no cuentan: allí simplemente no
+// se guarda.
+func (r *MaterialRepository) FindScarce(threshold float64) ([]*models.MaterialStock, error) {
+	var stocks []*models.MaterialStock
+	err := r.db.Preload("Material").Preload("Location").
+		Joins("JOIN materials ON materials.id = material_stocks.material_id AND materials.deleted_at IS NULL").
+		Joins("JOIN locations ON locations.id = material_stocks.location_id AND locations.deleted_at IS NULL").
+		Where("(materials.reorder_level > 0 AND material_stocks.quantity - material_stocks.reserved <= materials.reorder_level) OR "+
+			"(materials.reorder_level <= 0 AND material_stocks.quantity - material_stocks.reserved <= ?)", threshold).
+		Where("material_stocks.quantity <> 0 OR material_stocks.reserved <> 0 OR NOT EXISTS (" +
+			"SELECT 1 FROM material_stocks other WHERE other.material_id = material_stocks.material_id " +
+			"AND other.id <> material_stocks.id AND other.deleted_at IS NULL AND (other.quantity <> 0 OR other.reserved <> 0))").
+		Order("material_stocks.location_id, material_stocks.material_id").
+		Find(&stocks).Error
+	return stocks, err
+}
+
+// Stock devuelve la existencia del material en cada ubicación.
+func (r *MaterialRepository) Stock(materialID uint) ([]*models.MaterialStock, error) {
+	var stocks []*models.MaterialStock
+	err := r.db.Preload("Location").Where("material_id = ?", materialID).Order("location_id").Find(&stocks).Error
+	return stocks, err
+}
+
+// Movements devuelve el libro de movimientos del material en orden cronológico.
+func (r *MaterialRepository) Movements(materialID uint) ([]*models.StockMovement, error) {
+	var movements []*models.StockMovement
+	err := r.db.Where("material_id = ?", materialID).Order("id").Find(&movements).Error
+	return movements, err
+}
+
+// StockReconciliation compara la existencia de un material con la suma de su libro.
+type StockReconciliation struct {
+	MaterialID uint
+	Quantity   float64
+	Ledger     float64
+}
+
+func (s StockReconciliation) Discrepancy() float64 {
+	return s.Quantity - s.Ledger
+}
+
+func (s StockReconciliation) Reconciled() bool {
+	return math.Abs(s.Discrepancy()) < 1e-9
+}
+
+// Reconcile calcula la existencia que resulta del libro de un material.
+func (r *MaterialRepository) Reconcile(m *models.Material) (StockReconciliation, error) {
+	rec := StockReconciliation{MaterialID: m.ID, Quantity: m.Quantity}
+	err := r.db.Model(&models.StockMovement{}).
+		Select("COALESCE(SUM(quantity), 0)").
+		Where("material_id = ?", m.ID).
+		Scan(&rec.Ledger).Error
+	return rec, err
+}
+
+// FindUnreconciled devuelve los materiales cuya existencia no coincide con su libro.
+func (r *MaterialRepository) FindUnreconciled() ([]StockReconciliation, error) {
+	var rows []StockReconciliation
+	err := r.db.Model(&models.Material{}).
+		Select("materials.id AS material_id, materials.quantity AS quantity, COALESCE(SUM(stock_movements.quantity), 0) AS ledger").
+		Joins("LEFT JOIN stock_movements ON stock_movements.material_id = materials.id AND stock_movements.deleted_at IS NULL").
+		Group("materials.id, materials.quantity").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	unreconciled := []StockReconciliation{}
+	for _, row := range rows {
+		if !row.Reconciled() {
+			unreconciled = append(unreconciled, row)
+		}
+	}
+	return unreconciled, nil
+}
+
+// OpenMissingBalances anota como saldo inicial la existencia de los materiales
+// que aún no tienen movimientos (p. ej. los cargados por init.sql o anteriores
+// al libro). Devuelve cuántos materiales abrió.
+func (r *MaterialRepository) OpenMissingBalances(actor string) (int, error) {
+	opened := 0
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var materials []models.Material
+		if err := tx.Where("quantity <> 0 AND NOT EXISTS (SELECT 1 FROM stock_movements WHERE stock_movements.material_id = materials.id)").
+			Order("id").Find(&materials).Error; err != nil {
+			return err
+		}
+		for _, m := range materials {
+			if err := recordMovement(tx, m.ID, models.StockMovementAdjustment, m.Quantity, stockRef{Actor: actor, Reason: "opening balance"}); err != nil {
+				return err
+			}
+			opened++
+		}
+		return nil
+	})
+	return opened, err
+}
+
+// Lots devuelve los lotes del material en el orden en que se consumen.
+func (r *MaterialRepository) Lots(materialID uint) ([]*models.MaterialLot, error) {
+	var lots []*models.MaterialLot
+	err := r.db.Where("material_id = ?", materialID).
+		Order("expires_at IS NULL, expires_at, received_at, id").
+		Find(&lots).Error
+	return lots, err
+}
+
+// ReceiveLot da de alta un lote en lot.LocationID (la predeterminada si es 0),
+// suma su cantidad al material y lo anota en el libro como entrada.
+func (r *MaterialRepository) ReceiveLot(lot *models.MaterialLot, actor string) (*models.MaterialLot, error) {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		material, err := lockMaterial(tx, lot.MaterialID)
+		if err != nil {
+			return err
+		}
+		ref := stockRef{Actor: actor, Reason: "lot " + lot.LotNumber, LocationID: lot.LocationID}
+		return receiveStock(tx, material, lot.Quantity, lot, ref)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return lot, nil
+}
+
+// AdjustLot fija la cantidad de un lote (p. ej. a 0 al retirar uno caducado)
+// y traslada la diferencia al material y a la ubicación del lote como ajuste.
+func (r *MaterialRepository) AdjustLot(materialID, lotID uint, quantity float64, actor, reason string) (*models.MaterialLot, error) {
+	var updated models.MaterialLot
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		material, err := lockMaterial(tx, materialID)
+		if err != nil {
+			return err
+		}
+		err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("material_id = ?", materialID).
+			First(&updated, lotID).Error
+		if err == gorm.ErrRecordNotFound {
+			return ErrLotNotFound
+		}
+		if err != nil {
+			return err
+		}
+		delta := quantity - updated.Quantity
+		if delta == 0 {
+			return nil
+		}
+		locationID, err := orDefault(tx, updated.LocationID)
+		if err != nil {
+			return err
+		}
+		stock, err := locationStock(tx, material.ID, locationID)
+		if err != nil {
+			return err
+		}
+		if stock.Quantity+delta < stock.Reserved {
+			return ErrBelowReserved
+		}
+		updated.Quantity = quantity
+		if err := tx.Model(&updated).Update("quantity", quantity).Error; err != nil {
+			return err
+		}
+		if _, err := adjustStock(tx, material.ID, locationID, delta, 0); err != nil {
+			return err
+		}
+		material.Quantity += delta
+		if err := tx.Save(material).Error; err != nil {
+			return err
+		}
+		if reason == "" {
+			reason = "lot adjustment"
+		}
+		ref := stockRef{Actor: actor, Reason: fmt.Sprintf("lot %s: %s", updated.LotNumber, reason), LocationID: locationID}
+		if err := recordMovement(tx, material.ID, models.StockMovementAdjustment, delta, ref); err != nil {
+			return err
+		}
+		return checkReorder(tx, material, "lot "+updated.LotNumber+" adjusted by "+actor)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// FindExpiringLots devuelve los lotes con existencias que caducan antes de
+// before (incluidos los ya caducados), con su material.
+func (r *MaterialRepository) FindExpiringLots(before time.Time) ([]*models.MaterialLot, error) {
+	var lots []*models.MaterialLot
+	err := r.db.Preload("Material").
+		Where("quantity > 0 AND expires_at IS NOT NULL AND expires_at <= ?", before).
+		Order("expires_at, id").
+		Find(&lots).Error
+	return lots, err
+}
+
+// ExpiredLotStock suma por material lo que queda en lotes caducados en at;
+// sin materialIDs, de todos los materiales.
+func (r *MaterialRepository) ExpiredLotStock(at time.Time, materialIDs ...uint) (map[uint]float64, error) {
+	var rows []struct {
+		MaterialID uint
+		Total      float64
+	}
+	query := r.db.Model(&models.MaterialLot{}).
+		Select("material_id, COALESCE(SUM(quantity), 0) AS total").
+		Where("quantity > 0 AND expires_at IS NOT NULL AND expires_at <= ?", at)
+	if len(materialIDs) > 0 {
+		query = query.Where("material_id IN ?", materialIDs)
+	}
+	if err := query.Group("material_id").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	totals := make(map[uint]float64, len(rows))
+	for _, row := range rows {
+		totals[row.MaterialID] = row.Total
+	}
+	return totals, nil
 }
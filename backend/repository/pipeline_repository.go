@@ -0,0 +1,269 @@
+package repository
+
+import (
+	"backend-avanzada/models"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrPipelineNotFound = errors.New("pipeline not found")
+
+type PipelineRepository struct {
+	db     *gorm.DB
+	quotas *QuotaPolicy
+}
+
+// WithQuotas aplica las cuotas del alquimista al lanzar cada paso.
+func (r *PipelineRepository) WithQuotas(quotas *QuotaPolicy) {
+	r.quotas = quotas
+}
+
+func NewPipelineRepository(db *gorm.DB) *PipelineRepository {
+	return &PipelineRepository{db: db}
+}
+
+func (r *PipelineRepository) withSteps(db *gorm.DB) *gorm.DB {
+	return db.Preload("Steps", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id")
+	})
+}
+
+func (r *PipelineRepository) FindAll() ([]*models.Pipeline, error) {
+	var pipelines []*models.Pipeline
+	err := r.withSteps(r.db).Order("id").Find(&pipelines).Error
+	return pipelines, err
+}
+
+func (r *PipelineRepository) FindAllByUser(userID uint) ([]*models.Pipeline, error) {
+	var pipelines []*models.Pipeline
+	err := r.withSteps(r.db).Where("user_id = ?", userID).Order("id").Find(&pipelines).Error
+	return pipelines, err
+}
+
+func (r *PipelineRepository) FindById(id int) (*models.Pipeline, error) {
+	var pipeline models.Pipeline
+	err := r.withSteps(r.db).First(&pipeline, id).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &pipeline, nil
+}
+
+// Create guarda el pipeline con sus pasos en espera. Los pasos deben venir
+// ya en orden topológico; Advance lanza después los que no tienen dependencias.
+func (r *PipelineRepository) Create(p *models.Pipeline) (*models.Pipeline, error) {
+	p.Status = models.PipelineStatusRunning
+	for i := range p.Steps {
+		p.Steps[i].Status = models.PipelineStepWaiting
+	}
+	if err := r.db.Create(p).Error; err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Advance sincroniza cada paso con su transmutación, crea (reservando material)
+// las transmutaciones de los pasos cuyas dependencias ya se completaron y
+// omite los que dependen de un paso fallido. Un pipeline FAILED se reabre si
+// se reintenta el paso que falló. Todo ocurre con el pipeline bloqueado, así
+// que llamadas concurrentes no lanzan dos veces el mismo paso.
+// Devuelve el pipeline actualizado y las transmutaciones recién creadas.
+func (r *PipelineRepository) Advance(id uint, actor string) (*models.Pipeline, []*models.Transmutation, error) {
+	var (
+		pipeline models.Pipeline
+		created  []*models.Transmutation
+	)
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&pipeline, id).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return ErrPipelineNotFound
+			}
+			return err
+		}
+		if err := tx.Order("id").Where("pipeline_id = ?", id).Find(&pipeline.Steps).Error; err != nil {
+			return err
+		}
+		if pipeline.Status == models.PipelineStatusCompleted {
+			return nil
+		}
+		locations, err := syncStepStatuses(tx, pipeline.Steps)
+		if err != nil {
+			return err
+		}
+
+		byKey := map[string]*models.PipelineStep{}
+		for i := range pipeline.Steps {
+			step := &pipeline.Steps[i]
+			byKey[step.Key] = step
+			// Si el paso que causó la omisión se reintentó, el omitido vuelve
+			// a esperar; los pasos están en orden topológico, así que sus
+			// propios descendientes se reabren en esta misma pasada.
+			if step.Status == models.PipelineStepSkipped && !dependencyFailed(step, byKey) {
+				step.Status = models.PipelineStepWaiting
+				step.Error = ""
+			}
+			if step.Status != models.PipelineStepWaiting {
+				continue
+			}
+			ready := true
+			for _, dep := range step.DependsOn {
+				parent := byKey[dep]
+				switch parent.Status {
+				case models.TransmutationStatusCompleted:
+				case models.TransmutationStatusFailed, models.TransmutationStatusCancelled, models.TransmutationStatusRejected, models.PipelineStepSkipped:
+					step.Status = models.PipelineStepSkipped
+					step.Error = fmt.Sprintf("dependency %s is %s", parent.Key, parent.Status)
+					ready = false
+				default:
+					ready = false
+				}
+				if step.Status == models.PipelineStepSkipped {
+					break
+				}
+			}
+			if !ready {
+				continue
+			}
+			t := &models.Transmutation{
+				UserID:     pipeline.UserID,
+				MaterialID: step.MaterialID,
+				RecipeID:   step.RecipeID,
+				Formula:    step.Formula,
+				Quantity:   step.Quantity,
+				PipelineID: &pipeline.ID,
+			}
+			t.FormulaID = step.FormulaID
+			t.FormulaVersion = step.FormulaVersion
+			t.Unit = step.Unit
+			if step.ApprovalReason != "" {
+				t.Status = models.TransmutationStatusAwaitingApproval
+				t.ApprovalReason = step.ApprovalReason
+			}
+			// El paso toma sus materiales donde se completó su dependencia,
+			// que es donde quedaron sus productos.
+			stepLocation := uint(0)
+			for _, dep := range step.DependsOn {
+				if parent := byKey[dep]; parent.TransmutationID != nil {
+					if stepLocation = locations[*parent.TransmutationID]; stepLocation != 0 {
+						break
+					}
+				}
+			}
+			// Cada paso en su propio savepoint: si falta material, el paso
+			// falla sin deshacer lo ya lanzado.
+			err := tx.Transaction(func(stepTx *gorm.DB) error {
+				inputs, err := resolveInputs(stepTx, t)
+				if err != nil {
+					return err
+				}
+				inputs = mergeAmounts(inputs)
+				if err := r.quotas.check(stepTx, t.UserID, inputs, 1, time.Now()); err != nil {
+					return err
+				}
+				locationID, err := reserveMaterials(stepTx, inputs, stepLocation)
+				if err != nil {
+					return err
+				}
+				t.LocationID = &locationID
+				return insertTransmutation(stepTx, t, inputs, actor)
+			})
+			if err != nil {
+				if !errors.Is(err, ErrMaterialNotFound) && !errors.Is(err, ErrInsufficientMaterial) && !errors.Is(err, ErrRecipeNotFound) && !errors.Is(err, ErrQuotaExceeded) && !errors.Is(err, ErrLocationNotFound) {
+					return err
+				}
+				step.Status = models.TransmutationStatusFailed
+				step.Error = err.Error()
+				continue
+			}
+			step.TransmutationID = &t.ID
+			step.Status = t.Status
+			created = append(created, t)
+		}
+
+		pipeline.Status = pipelineStatus(pipeline.Steps)
+		for i := range pipeline.Steps {
+			if err := tx.Save(&pipeline.Steps[i]).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Omit(clause.Associations).Save(&pipeline).Error
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return &pipeline, created, nil
+}
+
+// dependencyFailed indica si alguna dependencia del paso terminó sin completarse.
+func dependencyFailed(step *models.PipelineStep, byKey map[string]*models.PipelineStep) bool {
+	for _, dep := range step.DependsOn {
+		switch byKey[dep].Status {
+		case models.TransmutationStatusFailed, models.TransmutationStatusCancelled, models.TransmutationStatusRejected, models.PipelineStepSkipped:
+			return true
+		}
+	}
+	return false
+}
+
+// syncStepStatuses copia en cada paso lanzado el estado de su transmutación.
+// Una transmutación eliminada cuenta como cancelada. Devuelve la ubicación de
+// cada transmutación por su ID.
+func syncStepStatuses(tx *gorm.DB, steps []models.PipelineStep) (map[uint]uint, error) {
+	ids := []uint{}
+	for _, step := range steps {
+		if step.TransmutationID != nil {
+			ids = append(ids, *step.TransmutationID)
+		}
+	}
+	locations := map[uint]uint{}
+	if len(ids) == 0 {
+		return locations, nil
+	}
+	var ts []models.Transmutation
+	if err := tx.Unscoped().Where("id IN ?", ids).Find(&ts).Error; err != nil {
+		return nil, err
+	}
+	statuses := map[uint]string{}
+	for _, t := range ts {
+		statuses[t.ID] = t.Status
+		locations[t.ID] = locationOf(&t)
+		if t.DeletedAt.Valid {
+			statuses[t.ID] = models.TransmutationStatusCancelled
+		}
+	}
+	for i := range steps {
+		if steps[i].TransmutationID == nil {
+			continue
+		}
+		if status, ok := statuses[*steps[i].TransmutationID]; ok {
+			steps[i].Status = status
+		} else {
+			steps[i].Status = models.TransmutationStatusCancelled
+		}
+	}
+	return locations, nil
+}
+
+// pipelineStatus resume el estado del pipeline a partir de sus pasos.
+func pipelineStatus(steps []models.PipelineStep) string {
+	completed := true
+	for _, step := range steps {
+		if !models.IsTerminalStepStatus(step.Status) {
+			return models.PipelineStatusRunning
+		}
+		if step.Status != models.TransmutationStatusCompleted {
+			completed = false
+		}
+	}
+	if completed {
+		return models.PipelineStatusCompleted
+	}
+	return models.PipelineStatusFailed
+}
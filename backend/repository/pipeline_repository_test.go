@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"backend-avanzada/models"
+	"testing"
+)
+
+func TestAdvanceReopensPipelineWhenFailedStepIsRetried(t *testing.T) {
+	db := newTestDB(t)
+	mercury := createMaterial(t, db, &models.Material{Name: "Mercury", Quantity: 10, EnergyValue: 2})
+	cinnabar := createMaterial(t, db, &models.Material{Name: "Cinnabar", EnergyValue: 1})
+	createMaterial(t, db, &models.Material{Name: "Gold", EnergyValue: 5})
+	pipelines := NewPipelineRepository(db)
+	transmutations := NewTransmutationRepository(db)
+
+	pipeline, err := pipelines.Create(&models.Pipeline{
+		Name:   "gold",
+		UserID: 1,
+		Steps: []models.PipelineStep{
+			{Key: "a", MaterialID: mercury.ID, Formula: "Mercury -> Cinnabar", Quantity: 2},
+			{Key: "b", DependsOn: []string{"a"}, MaterialID: cinnabar.ID, Formula: "Cinnabar -> Gold", Quantity: 2},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	advance := func() (*models.Pipeline, []*models.Transmutation) {
+		t.Helper()
+		p, created, err := pipelines.Advance(pipeline.ID, "worker")
+		if err != nil {
+			t.Fatalf("Advance: %v", err)
+		}
+		return p, created
+	}
+	assertStatuses := func(p *models.Pipeline, want, a, b string) {
+		t.Helper()
+		if p.Status != want || p.Steps[0].Status != a || p.Steps[1].Status != b {
+			t.Fatalf("pipeline %s steps %s/%s, want %s steps %s/%s", p.Status, p.Steps[0].Status, p.Steps[1].Status, want, a, b)
+		}
+	}
+
+	p, created := advance()
+	if len(created) != 1 {
+		t.Fatalf("first Advance launched %d steps, want 1", len(created))
+	}
+	first := created[0]
+	if _, err := transmutations.StartProcessing(first, "worker"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := transmutations.Fail(first, "worker", "boom"); err != nil {
+		t.Fatal(err)
+	}
+	p, _ = advance()
+	assertStatuses(p, models.PipelineStatusFailed, models.TransmutationStatusFailed, models.PipelineStepSkipped)
+
+	if _, err := transmutations.Retry(first.ID, "test", 1); err != nil {
+		t.Fatalf("Retry: %v", err)
+	}
+	p, _ = advance()
+	assertStatuses(p, models.PipelineStatusRunning, models.TransmutationStatusPending, models.PipelineStepWaiting)
+
+	if _, err := transmutations.StartProcessing(first, "worker"); err != nil {
+		t.Fatal(err)
+	}
+	first.Outcome = &models.TransmutationOutcome{Outputs: []models.TransmutationComponent{{MaterialID: cinnabar.ID, Material: "Cinnabar", Quantity: 2}}}
+	if _, err := transmutations.Complete(first, "worker"); err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	p, created = advance()
+	assertStatuses(p, models.PipelineStatusRunning, models.TransmutationStatusCompleted, models.TransmutationStatusPending)
+	if len(created) != 1 || created[0].MaterialID != cinnabar.ID {
+		t.Fatalf("Advance after the retry succeeded launched %+v, want step b", created)
+	}
+	if got := reloadMaterial(t, db, cinnabar.ID); got.Reserved != 2 {
+		t.Errorf("Cinnabar reserved by step b = %v, want 2", got.Reserved)
+	}
+}
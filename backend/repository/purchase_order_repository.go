@@ -0,0 +1,276 @@
+package repository
+
+import (
+	"backend-avanzada/models"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrPurchaseOrderNotFound      = errors.New("purchase order not found")
+	ErrInvalidPurchaseOrderStatus = errors.New("purchase order cannot change from its current status")
+	ErrEmptyPurchaseOrder         = errors.New("purchase order has no lines")
+	ErrPurchaseOrderLineNotFound  = errors.New("purchase order line not found")
+	ErrOverReceipt                = errors.New("received quantity exceeds what is pending on the line")
+)
+
+// LineReceipt es la recepción de una línea: Quantity 0 recibe lo pendiente y
+// Lot, si no es nil, registra la entrada como lote.
+type LineReceipt struct {
+	LineID     uint
+	MaterialID uint
+	Quantity   float64
+	Lot        *models.MaterialLot
+}
+
+type PurchaseOrderRepository struct {
+	db *gorm.DB
+}
+
+func NewPurchaseOrderRepository(db *gorm.DB) *PurchaseOrderRepository {
+	return &PurchaseOrderRepository{db: db}
+}
+
+func (r *PurchaseOrderRepository) withLines(db *gorm.DB) *gorm.DB {
+	return db.Preload("Supplier").Preload("Lines", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id")
+	}).Preload("Lines.Material")
+}
+
+// FindAll devuelve las órdenes, filtradas por estado si status no está vacío.
+func (r *PurchaseOrderRepository) FindAll(status string) ([]*models.PurchaseOrder, error) {
+	var orders []*models.PurchaseOrder
+	db := r.withLines(r.db)
+	if status != "" {
+		db = db.Where("status = ?", status)
+	}
+	return orders, db.Order("id").Find(&orders).Error
+}
+
+func (r *PurchaseOrderRepository) FindById(id int) (*models.PurchaseOrder, error) {
+	var order models.PurchaseOrder
+	err := r.withLines(r.db).First(&order, id).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+// checkReferences comprueba que existen el proveedor, la ubicación de
+// recepción si se indica y los materiales de las líneas.
+func checkReferences(tx *gorm.DB, o *models.PurchaseOrder) error {
+	var count int64
+	if err := tx.Model(&models.Supplier{}).Where("id = ?", o.SupplierID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrSupplierNotFound
+	}
+	if o.LocationID != nil {
+		if _, err := resolveLocation(tx, *o.LocationID); err != nil {
+			return err
+		}
+	}
+	for _, line := range o.Lines {
+		if err := tx.Model(&models.Material{}).Where("id = ?", line.MaterialID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return fmt.Errorf("%w: %d", ErrMaterialNotFound, line.MaterialID)
+		}
+	}
+	return nil
+}
+
+// Create guarda la orden en DRAFT con sus líneas.
+func (r *PurchaseOrderRepository) Create(o *models.PurchaseOrder) (*models.PurchaseOrder, error) {
+	o.Status = models.PurchaseOrderStatusDraft
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := checkReferences(tx, o); err != nil {
+			return err
+		}
+		return tx.Omit("Supplier", "Lines.Material").Create(o).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r.FindById(int(o.ID))
+}
+
+// UpdateDraft sustituye proveedor, referencia, notas, ubicación y, si lines no es nil,
+// las líneas de una orden que aún está en DRAFT.
+func (r *PurchaseOrderRepository) UpdateDraft(id uint, o *models.PurchaseOrder, lines []models.PurchaseOrderLine) (*models.PurchaseOrder, error) {
+	return r.transition(id, func(tx *gorm.DB, current *models.PurchaseOrder) error {
+		if current.Status != models.PurchaseOrderStatusDraft {
+			return ErrInvalidPurchaseOrderStatus
+		}
+		current.SupplierID = o.SupplierID
+		current.Reference = o.Reference
+		current.Notes = o.Notes
+		current.LocationID = o.LocationID
+		check := &models.PurchaseOrder{SupplierID: current.SupplierID, LocationID: current.LocationID, Lines: lines}
+		if err := checkReferences(tx, check); err != nil {
+			return err
+		}
+		if lines == nil {
+			return nil
+		}
+		if err := tx.Where("purchase_order_id = ?", current.ID).Delete(&models.PurchaseOrderLine{}).Error; err != nil {
+			return err
+		}
+		for i := range lines {
+			lines[i].PurchaseOrderID = current.ID
+		}
+		if len(lines) == 0 {
+			return nil
+		}
+		return tx.Omit("Material").Create(&lines).Error
+	})
+}
+
+// Send pasa una orden DRAFT con al menos una línea a SENT.
+func (r *PurchaseOrderRepository) Send(id uint) (*models.PurchaseOrder, error) {
+	return r.transition(id, func(tx *gorm.DB, current *models.PurchaseOrder) error {
+		if current.Status != models.PurchaseOrderStatusDraft {
+			return ErrInvalidPurchaseOrderStatus
+		}
+		var lines int64
+		if err := tx.Model(&models.PurchaseOrderLine{}).Where("purchase_order_id = ?", current.ID).Count(&lines).Error; err != nil {
+			return err
+		}
+		if lines == 0 {
+			return ErrEmptyPurchaseOrder
+		}
+		now := time.Now()
+		current.Status = models.PurchaseOrderStatusSent
+		current.SentAt = &now
+		return nil
+	})
+}
+
+// Cancel cierra una orden sin recibir del todo. Lo ya recibido se queda en el
+// inventario.
+func (r *PurchaseOrderRepository) Cancel(id uint) (*models.PurchaseOrder, error) {
+	return r.transition(id, func(tx *gorm.DB, current *models.PurchaseOrder) error {
+		if current.Status != models.PurchaseOrderStatusDraft && !current.IsReceivable() {
+			return ErrInvalidPurchaseOrderStatus
+		}
+		now := time.Now()
+		current.Status = models.PurchaseOrderStatusCancelled
+		current.ClosedAt = &now
+		return nil
+	})
+}
+
+// Receive suma a las existencias lo recibido de cada línea, con su entrada
+// en el libro, y deja la orden RECEIVED o PARTIALLY_RECEIVED. Sin receipts
+// recibe todo lo pendiente. Devuelve las recepciones aplicadas.
+func (r *PurchaseOrderRepository) Receive(id uint, receipts []LineReceipt, actor string) (*models.PurchaseOrder, []LineReceipt, error) {
+	var applied []LineReceipt
+	order, err := r.transition(id, func(tx *gorm.DB, current *models.PurchaseOrder) error {
+		if !current.IsReceivable() {
+			return ErrInvalidPurchaseOrderStatus
+		}
+		var lines []*models.PurchaseOrderLine
+		if err := tx.Where("purchase_order_id = ?", current.ID).Order("id").Find(&lines).Error; err != nil {
+			return err
+		}
+		byID := make(map[uint]*models.PurchaseOrderLine, len(lines))
+		for _, line := range lines {
+			byID[line.ID] = line
+		}
+		if len(receipts) == 0 {
+			for _, line := range lines {
+				if line.Pending() > 0 {
+					receipts = append(receipts, LineReceipt{LineID: line.ID})
+				}
+			}
+		}
+		pending := make(map[uint]float64, len(lines))
+		for _, line := range lines {
+			pending[line.ID] = line.Pending()
+		}
+		applied = make([]LineReceipt, 0, len(receipts))
+		for _, rc := range receipts {
+			line, ok := byID[rc.LineID]
+			if !ok {
+				return fmt.Errorf("%w: %d", ErrPurchaseOrderLineNotFound, rc.LineID)
+			}
+			if rc.Quantity == 0 {
+				rc.Quantity = pending[line.ID]
+			}
+			if rc.Quantity <= 0 || rc.Quantity > pending[line.ID]+models.ReceiptTolerance {
+				return fmt.Errorf("%w: line %d", ErrOverReceipt, line.ID)
+			}
+			pending[line.ID] -= rc.Quantity
+			rc.MaterialID = line.MaterialID
+			applied = append(applied, rc)
+		}
+		// Los materiales se bloquean en orden ascendente, como al reservar.
+		sorted := append([]LineReceipt(nil), applied...)
+		sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].MaterialID < sorted[j].MaterialID })
+		for _, rc := range sorted {
+			material, err := lockMaterial(tx, rc.MaterialID)
+			if err != nil {
+				return err
+			}
+			ref := stockRef{Actor: actor, Reason: fmt.Sprintf("purchase order #%d line #%d", current.ID, rc.LineID)}
+			if current.LocationID != nil {
+				ref.LocationID = *current.LocationID
+			}
+			if err := receiveStock(tx, material, rc.Quantity, rc.Lot, ref); err != nil {
+				return err
+			}
+			line := byID[rc.LineID]
+			line.ReceivedQuantity += rc.Quantity
+			if err := tx.Model(line).Update("received_quantity", line.ReceivedQuantity).Error; err != nil {
+				return err
+			}
+		}
+		current.Status = models.PurchaseOrderStatusReceived
+		for _, line := range lines {
+			if line.Pending() > 0 {
+				current.Status = models.PurchaseOrderStatusPartiallyReceived
+			}
+		}
+		if current.Status == models.PurchaseOrderStatusReceived {
+			now := time.Now()
+			current.ClosedAt = &now
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return order, applied, nil
+}
+
+// transition aplica apply a la orden bloqueada y la guarda.
+func (r *PurchaseOrderRepository) transition(id uint, apply func(tx *gorm.DB, current *models.PurchaseOrder) error) (*models.PurchaseOrder, error) {
+	var order models.PurchaseOrder
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, id).Error
+		if err == gorm.ErrRecordNotFound {
+			return ErrPurchaseOrderNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if err := apply(tx, &order); err != nil {
+			return err
+		}
+		return tx.Omit(clause.Associations).Save(&order).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r.FindById(int(order.ID))
+}
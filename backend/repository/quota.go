@@ -0,0 +1,303 @@
+package repository
+
+import (
+	"backend-avanzada/models"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrQuotaExceeded = errors.New("transmutation quota exceeded")
+
+const (
+	QuotaPeriodDay  = "day"
+	QuotaPeriodWeek = "week"
+)
+
+// Quota limita a un alquimista (Email) o a todos los de un rango (Rank). Con
+// Material limita lo que puede consumir de ese material por día o semana; sin
+// él, cuántas transmutaciones puede tener en curso a la vez.
+type Quota struct {
+	Email       string
+	Rank        string
+	Material    string
+	Period      string
+	MaxQuantity float64
+	MaxActive   int
+}
+
+func (q Quota) key() string {
+	if q.Material == "" {
+		return "active"
+	}
+	return strings.ToLower(q.Material) + "|" + q.Period
+}
+
+// QuotaError acompaña a ErrQuotaExceeded con el límite superado.
+type QuotaError struct {
+	Quota     Quota
+	Used      float64
+	Requested float64
+}
+
+func (e *QuotaError) Error() string {
+	if e.Quota.Material == "" {
+		return fmt.Sprintf("%v: %s active transmutations, limit %d",
+			ErrQuotaExceeded, formatQuantity(e.Used), e.Quota.MaxActive)
+	}
+	return fmt.Sprintf("%v: %s per %s, used %s + requested %s exceeds %s",
+		ErrQuotaExceeded, e.Quota.Material, e.Quota.Period,
+		formatQuantity(e.Used), formatQuantity(e.Requested), formatQuantity(e.Quota.MaxQuantity))
+}
+
+func (e *QuotaError) Unwrap() error {
+	return ErrQuotaExceeded
+}
+
+func formatQuantity(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// QuotaUsage es el consumo actual frente a una cuota efectiva.
+type QuotaUsage struct {
+	Quota      Quota
+	Scope      string
+	MaterialID uint
+	Limit      float64
+	Used       float64
+	Remaining  float64
+	ResetsAt   *time.Time
+}
+
+// QuotaPolicy aplica las cuotas configuradas. Una cuota de usuario sustituye a
+// la de su rango para el mismo material y periodo (o para las activas).
+type QuotaPolicy struct {
+	quotas []Quota
+}
+
+func NewQuotaPolicy(quotas []Quota) (*QuotaPolicy, error) {
+	policy := &QuotaPolicy{}
+	for i, q := range quotas {
+		q.Email = strings.TrimSpace(q.Email)
+		q.Rank = strings.TrimSpace(q.Rank)
+		q.Material = strings.TrimSpace(q.Material)
+		q.Period = strings.ToLower(strings.TrimSpace(q.Period))
+		if (q.Email == "") == (q.Rank == "") {
+			return nil, fmt.Errorf("quota %d: exactly one of email or rank is required", i)
+		}
+		if q.Material == "" {
+			if q.MaxActive <= 0 || q.MaxQuantity != 0 || q.Period != "" {
+				return nil, fmt.Errorf("quota %d: without material only max_active is allowed", i)
+			}
+		} else {
+			if q.Period != QuotaPeriodDay && q.Period != QuotaPeriodWeek {
+				return nil, fmt.Errorf("quota %d: period must be day or week", i)
+			}
+			if q.MaxQuantity <= 0 || q.MaxActive != 0 {
+				return nil, fmt.Errorf("quota %d: a material quota needs max_quantity and no max_active", i)
+			}
+		}
+		policy.quotas = append(policy.quotas, q)
+	}
+	return policy, nil
+}
+
+// periodStart devuelve el inicio del día o de la semana (lunes) en UTC.
+func periodStart(period string, now time.Time) time.Time {
+	now = now.UTC()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	if period == QuotaPeriodWeek {
+		offset := (int(day.Weekday()) + 6) % 7
+		return day.AddDate(0, 0, -offset)
+	}
+	return day
+}
+
+func periodEnd(period string, now time.Time) time.Time {
+	if period == QuotaPeriodWeek {
+		return periodStart(period, now).AddDate(0, 0, 7)
+	}
+	return periodStart(period, now).AddDate(0, 0, 1)
+}
+
+// userRank busca el rango del alquimista enlazado al usuario.
+func userRank(tx *gorm.DB, user *models.User) (string, error) {
+	var alchemists []models.Alchemist
+	if err := tx.Where("user_id = ?", user.ID).Order("id").Limit(1).Find(&alchemists).Error; err != nil {
+		return "", err
+	}
+	if len(alchemists) == 0 {
+		return "", nil
+	}
+	return alchemists[0].Rank, nil
+}
+
+// effective devuelve, ordenadas, las cuotas que aplican al usuario y si cada
+// una viene de su usuario o de su rango.
+func (p *QuotaPolicy) effective(user *models.User, rank string) ([]Quota, map[string]string) {
+	chosen := map[string]Quota{}
+	scopes := map[string]string{}
+	for _, q := range p.quotas {
+		switch {
+		case q.Email != "" && strings.EqualFold(q.Email, user.Email):
+			chosen[q.key()] = q
+			scopes[q.key()] = "user"
+		case q.Rank != "" && rank != "" && strings.EqualFold(q.Rank, rank) && scopes[q.key()] != "user":
+			chosen[q.key()] = q
+			scopes[q.key()] = "rank"
+		}
+	}
+	keys := make([]string, 0, len(chosen))
+	for key := range chosen {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	quotas := make([]Quota, 0, len(keys))
+	for _, key := range keys {
+		quotas = append(quotas, chosen[key])
+	}
+	return quotas, scopes
+}
+
+func quotaMaterial(tx *gorm.DB, name string) (*models.Material, error) {
+	var ms []models.Material
+	if err := tx.Where("LOWER(name) = LOWER(?)", name).Order("id").Limit(1).Find(&ms).Error; err != nil {
+		return nil, err
+	}
+	if len(ms) == 0 {
+		return nil, nil
+	}
+	return &ms[0], nil
+}
+
+// used calcula el consumo del usuario para la cuota. El material cuenta en el
+// periodo en que se reservó: cada intento reserva de nuevo, así que un
+// reintento cuenta en el periodo en que se reintenta. Las reservas liberadas
+// (fallos, cancelaciones, rechazos) y las de transmutaciones eliminadas no
+// cuentan.
+func (p *QuotaPolicy) used(tx *gorm.DB, userID uint, q Quota, materialID uint, now time.Time) (float64, error) {
+	if q.Material == "" {
+		var count int64
+		err := tx.Model(&models.Transmutation{}).
+			Where("user_id = ? AND status IN ?", userID, []string{
+				models.TransmutationStatusPending,
+				models.TransmutationStatusProcessing,
+				models.TransmutationStatusAwaitingApproval,
+			}).
+			Count(&count).Error
+		return float64(count), err
+	}
+	var total float64
+	err := tx.Model(&models.StockReservation{}).
+		Select("COALESCE(SUM(stock_reservations.quantity), 0)").
+		Joins("JOIN transmutations ON transmutations.id = stock_reservations.transmutation_id AND transmutations.deleted_at IS NULL").
+		Where("transmutations.user_id = ? AND stock_reservations.material_id = ? AND stock_reservations.created_at >= ? AND stock_reservations.status IN ?",
+			userID, materialID, periodStart(q.Period, now), []string{models.StockReservationActive, models.StockReservationConsumed}).
+		Scan(&total).Error
+	return total, err
+}
+
+// check comprueba, dentro de la transacción de creación, que reservar amounts
+// y abrir newActive transmutaciones no supera las cuotas del usuario. Bloquea
+// la fila del usuario para que dos creaciones simultáneas no se adelanten.
+func (p *QuotaPolicy) check(tx *gorm.DB, userID uint, amounts []materialAmount, newActive int, now time.Time) error {
+	if p == nil || len(p.quotas) == 0 {
+		return nil
+	}
+	var user models.User
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, userID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil
+		}
+		return err
+	}
+	rank, err := userRank(tx, &user)
+	if err != nil {
+		return err
+	}
+	quotas, _ := p.effective(&user, rank)
+	for _, q := range quotas {
+		requested := float64(newActive)
+		limit := float64(q.MaxActive)
+		var materialID uint
+		if q.Material != "" {
+			material, err := quotaMaterial(tx, q.Material)
+			if err != nil {
+				return err
+			}
+			if material == nil {
+				continue
+			}
+			materialID = material.ID
+			requested = 0
+			for _, a := range amounts {
+				if a.MaterialID == materialID {
+					requested += a.Quantity
+				}
+			}
+			limit = q.MaxQuantity
+		}
+		if requested == 0 {
+			continue
+		}
+		used, err := p.used(tx, userID, q, materialID, now)
+		if err != nil {
+			return err
+		}
+		if used+requested > limit+1e-9 {
+			return &QuotaError{Quota: q, Used: used, Requested: requested}
+		}
+	}
+	return nil
+}
+
+// Usage devuelve el rango del usuario y su consumo frente a cada cuota efectiva.
+func (p *QuotaPolicy) Usage(db *gorm.DB, userID uint, now time.Time) (string, []QuotaUsage, error) {
+	var user models.User
+	if err := db.First(&user, userID).Error; err != nil {
+		return "", nil, err
+	}
+	rank, err := userRank(db, &user)
+	if err != nil {
+		return "", nil, err
+	}
+	usages := []QuotaUsage{}
+	if p == nil {
+		return rank, usages, nil
+	}
+	quotas, scopes := p.effective(&user, rank)
+	for _, q := range quotas {
+		usage := QuotaUsage{Quota: q, Scope: scopes[q.key()], Limit: float64(q.MaxActive)}
+		if q.Material != "" {
+			usage.Limit = q.MaxQuantity
+			resetsAt := periodEnd(q.Period, now)
+			usage.ResetsAt = &resetsAt
+			material, err := quotaMaterial(db, q.Material)
+			if err != nil {
+				return "", nil, err
+			}
+			if material == nil {
+				usage.Remaining = usage.Limit
+				usages = append(usages, usage)
+				continue
+			}
+			usage.MaterialID = material.ID
+		}
+		usage.Used, err = p.used(db, userID, q, usage.MaterialID, now)
+		if err != nil {
+			return "", nil, err
+		}
+		usage.Remaining = usage.Limit - usage.Used
+		if usage.Remaining < 0 {
+			usage.Remaining = 0
+		}
+		usages = append(usages, usage)
+	}
+	return rank, usages, nil
+}
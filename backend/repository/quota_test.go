@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"backend-avanzada/models"
+	"errors"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// newQuotaRepository devuelve un repositorio de transmutaciones con policy
+// para un usuario alquimista y el material Mercury con existencias de sobra.
+func newQuotaRepository(t *testing.T, quotas ...Quota) (*gorm.DB, *TransmutationRepository, *models.User, *models.Material) {
+	t.Helper()
+	db := newTestDB(t)
+	user := &models.User{Name: "Ed", Specialty: "metal", Email: "ed@example.com", Role: "alchemist"}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	mercury := createMaterial(t, db, &models.Material{Name: "Mercury", Quantity: 100, EnergyValue: 2})
+	createMaterial(t, db, &models.Material{Name: "Cinnabar", EnergyValue: 1})
+	policy, err := NewQuotaPolicy(quotas)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := NewTransmutationRepository(db)
+	repo.WithQuotas(policy)
+	return db, repo, user, mercury
+}
+
+func createMercury(repo *TransmutationRepository, user *models.User, mercury *models.Material, quantity float64) (*models.Transmutation, error) {
+	return repo.Create(&models.Transmutation{
+		UserID:     user.ID,
+		MaterialID: mercury.ID,
+		Formula:    "Mercury -> Cinnabar",
+		Quantity:   quantity,
+	}, user.Email)
+}
+
+func TestQuotaLimitsActiveTransmutations(t *testing.T) {
+	_, repo, user, mercury := newQuotaRepository(t, Quota{Email: "ed@example.com", MaxActive: 1})
+
+	first, err := createMercury(repo, user, mercury, 1)
+	if err != nil {
+		t.Fatalf("first Create: %v", err)
+	}
+	if _, err := createMercury(repo, user, mercury, 1); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("second Create = %v, want %v", err, ErrQuotaExceeded)
+	}
+	if _, err := repo.Cancel(first.ID, user.Email, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := createMercury(repo, user, mercury, 1); err != nil {
+		t.Errorf("Create after cancelling the active one: %v", err)
+	}
+}
+
+func TestQuotaCountsRetriesInTheirOwnPeriod(t *testing.T) {
+	db, repo, user, mercury := newQuotaRepository(t, Quota{Email: "ed@example.com", Material: "Mercury", Period: QuotaPeriodWeek, MaxQuantity: 5})
+
+	old, err := createMercury(repo, user, mercury, 4)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if _, err := repo.StartProcessing(old, "worker"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Fail(old, "worker", "boom"); err != nil {
+		t.Fatal(err)
+	}
+	// La transmutación y su reserva son de la semana pasada.
+	lastWeek := time.Now().AddDate(0, 0, -8)
+	if err := db.Model(&models.Transmutation{}).Where("id = ?", old.ID).Update("created_at", lastWeek).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Model(&models.StockReservation{}).Where("transmutation_id = ?", old.ID).Update("created_at", lastWeek).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := createMercury(repo, user, mercury, 1); err != nil {
+		t.Fatalf("Create this week: %v", err)
+	}
+	// El reintento vuelve a reservar 4 esta semana: 1 + 4 llega justo al límite.
+	if _, err := repo.Retry(old.ID, user.Email, 3); err != nil {
+		t.Fatalf("Retry: %v", err)
+	}
+	if _, err := createMercury(repo, user, mercury, 1); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("Create after the retry = %v, want %v", err, ErrQuotaExceeded)
+	}
+}
+
+func TestQuotaIgnoresReleasedReservations(t *testing.T) {
+	_, repo, user, mercury := newQuotaRepository(t, Quota{Email: "ed@example.com", Material: "Mercury", Period: QuotaPeriodDay, MaxQuantity: 5})
+
+	first, err := createMercury(repo, user, mercury, 4)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if _, err := createMercury(repo, user, mercury, 2); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("Create over the limit = %v, want %v", err, ErrQuotaExceeded)
+	}
+	if _, err := repo.Cancel(first.ID, user.Email, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := createMercury(repo, user, mercury, 5); err != nil {
+		t.Errorf("Create after cancelling: %v", err)
+	}
+}
@@ -0,0 +1,124 @@
+package repository
+
+import (
+	"backend-avanzada/models"
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+var ErrRecipeNotFound = errors.New("recipe not found")
+
+type RecipeRepository struct {
+	db *gorm.DB
+}
+
+func NewRecipeRepository(db *gorm.DB) *RecipeRepository {
+	return &RecipeRepository{db: db}
+}
+
+func (r *RecipeRepository) withComponents(db *gorm.DB) *gorm.DB {
+	return db.Preload("Inputs.Material").Preload("Outputs.Material")
+}
+
+func (r *RecipeRepository) FindAll() ([]*models.Recipe, error) {
+	var recipes []*models.Recipe
+	err := r.withComponents(r.db).Find(&recipes).Error
+	return recipes, err
+}
+
+func (r *RecipeRepository) FindById(id int) (*models.Recipe, error) {
+	var recipe models.Recipe
+	err := r.withComponents(r.db).First(&recipe, id).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &recipe, nil
+}
+
+// Save guarda la receta y reemplaza por completo sus entradas y salidas.
+func (r *RecipeRepository) Save(recipe *models.Recipe) (*models.Recipe, error) {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := checkMaterialsExist(tx, recipeMaterialIDs(recipe)); err != nil {
+			return err
+		}
+		if err := tx.Omit("Inputs", "Outputs").Save(recipe).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("recipe_id = ?", recipe.ID).Delete(&models.RecipeInput{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("recipe_id = ?", recipe.ID).Delete(&models.RecipeOutput{}).Error; err != nil {
+			return err
+		}
+		for i := range recipe.Inputs {
+			recipe.Inputs[i].ID = 0
+			recipe.Inputs[i].RecipeID = recipe.ID
+			recipe.Inputs[i].Material = nil
+		}
+		for i := range recipe.Outputs {
+			recipe.Outputs[i].ID = 0
+			recipe.Outputs[i].RecipeID = recipe.ID
+			recipe.Outputs[i].Material = nil
+		}
+		if len(recipe.Inputs) > 0 {
+			if err := tx.Create(&recipe.Inputs).Error; err != nil {
+				return err
+			}
+		}
+		if len(recipe.Outputs) > 0 {
+			if err := tx.Create(&recipe.Outputs).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r.FindById(int(recipe.ID))
+}
+
+func (r *RecipeRepository) Delete(recipe *models.Recipe) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("recipe_id = ?", recipe.ID).Delete(&models.RecipeInput{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("recipe_id = ?", recipe.ID).Delete(&models.RecipeOutput{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(recipe).Error
+	})
+}
+
+func recipeMaterialIDs(recipe *models.Recipe) []uint {
+	ids := []uint{}
+	for _, in := range recipe.Inputs {
+		ids = append(ids, in.MaterialID)
+	}
+	for _, out := range recipe.Outputs {
+		ids = append(ids, out.MaterialID)
+	}
+	return ids
+}
+
+func checkMaterialsExist(tx *gorm.DB, ids []uint) error {
+	unique := map[uint]struct{}{}
+	for _, id := range ids {
+		unique[id] = struct{}{}
+	}
+	if len(unique) == 0 {
+		return nil
+	}
+	var count int64
+	if err := tx.Model(&models.Material{}).Where("id IN ?", ids).Count(&count).Error; err != nil {
+		return err
+	}
+	if int(count) != len(unique) {
+		return ErrMaterialNotFound
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"backend-avanzada/models"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestDB abre una base en memoria con el esquema completo y la ubicación
+// predeterminada creada.
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Cada conexión a :memory: es una base distinta.
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	err = db.AutoMigrate(
+		&models.User{},
+		&models.Alchemist{},
+		&models.Material{},
+		&models.TransmutationBatch{},
+		&models.Transmutation{},
+		&models.TransmutationInput{},
+		&models.TransmutationOutput{},
+		&models.TransmutationTransition{},
+		&models.Recipe{},
+		&models.RecipeInput{},
+		&models.RecipeOutput{},
+		&models.Pipeline{},
+		&models.PipelineStep{},
+		&models.IdempotencyRecord{},
+		&models.StockMovement{},
+		&models.MaterialLot{},
+		&models.TransmutationLotDraw{},
+		&models.StockReservation{},
+		&models.Location{},
+		&models.MaterialStock{},
+		&models.RestockRequest{},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewLocationRepository(db).OpenLocations(); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// createMaterial da de alta m con su existencia en la ubicación predeterminada.
+func createMaterial(t *testing.T, db *gorm.DB, m *models.Material) *models.Material {
+	t.Helper()
+	m, err := NewMaterialRepository(db).Create(m, 0, "test")
+	if err != nil {
+		t.Fatalf("create material %s: %v", m.Name, err)
+	}
+	return m
+}
+
+// reloadMaterial lee de nuevo el material con su existencia y lo reservado.
+func reloadMaterial(t *testing.T, db *gorm.DB, id uint) *models.Material {
+	t.Helper()
+	var m models.Material
+	if err := db.First(&m, id).Error; err != nil {
+		t.Fatal(err)
+	}
+	return &m
+}
@@ -0,0 +1,136 @@
+package repository
+
+import (
+	"backend-avanzada/models"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrRestockNotFound      = errors.New("restock request not found")
+	ErrInvalidRestockStatus = errors.New("restock request cannot change from its current status")
+)
+
+type RestockRepository struct {
+	db *gorm.DB
+}
+
+func NewRestockRepository(db *gorm.DB) *RestockRepository {
+	return &RestockRepository{db: db}
+}
+
+// FindAll devuelve las solicitudes, filtradas por estado si status no está vacío.
+func (r *RestockRepository) FindAll(status string) ([]*models.RestockRequest, error) {
+	var requests []*models.RestockRequest
+	db := r.db.Preload("Material")
+	if status != "" {
+		db = db.Where("status = ?", status)
+	}
+	return requests, db.Order("id").Find(&requests).Error
+}
+
+func (r *RestockRepository) FindById(id int) (*models.RestockRequest, error) {
+	var request models.RestockRequest
+	err := r.db.Preload("Material").First(&request, id).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &request, nil
+}
+
+// CountPending cuenta las solicitudes abiertas o aprobadas sin recibir.
+func (r *RestockRepository) CountPending() (int64, error) {
+	var count int64
+	err := r.db.Model(&models.RestockRequest{}).
+		Where("status IN ?", []string{models.RestockStatusOpen, models.RestockStatusApproved}).
+		Count(&count).Error
+	return count, err
+}
+
+// Approve pasa una solicitud abierta a aprobada; quantity, si no es nil,
+// corrige la cantidad pedida.
+func (r *RestockRepository) Approve(id uint, quantity *float64, actor string) (*models.RestockRequest, error) {
+	return r.transition(id, actor, func(tx *gorm.DB, request *models.RestockRequest) error {
+		if request.Status != models.RestockStatusOpen {
+			return ErrInvalidRestockStatus
+		}
+		request.Status = models.RestockStatusApproved
+		if quantity != nil {
+			request.Quantity = *quantity
+		}
+		return nil
+	})
+}
+
+// Dismiss descarta una solicitud pendiente. Si el material sigue bajo su
+// punto de pedido, la siguiente bajada abrirá otra.
+func (r *RestockRepository) Dismiss(id uint, actor, note string) (*models.RestockRequest, error) {
+	return r.transition(id, actor, func(tx *gorm.DB, request *models.RestockRequest) error {
+		if !request.IsPending() {
+			return ErrInvalidRestockStatus
+		}
+		now := time.Now()
+		request.Status = models.RestockStatusDismissed
+		request.Note = note
+		request.ClosedAt = &now
+		return nil
+	})
+}
+
+// Receive cierra una solicitud aprobada sumando quantity a las existencias
+// del material en locationID (0 = la predeterminada), como lote si lot no es
+// nil, con su entrada en el libro.
+func (r *RestockRepository) Receive(id uint, quantity float64, lot *models.MaterialLot, locationID uint, actor string) (*models.RestockRequest, error) {
+	return r.transition(id, actor, func(tx *gorm.DB, request *models.RestockRequest) error {
+		if request.Status != models.RestockStatusApproved {
+			return ErrInvalidRestockStatus
+		}
+		material, err := lockMaterial(tx, request.MaterialID)
+		if err != nil {
+			return err
+		}
+		ref := stockRef{Actor: actor, Reason: fmt.Sprintf("restock request #%d", request.ID), LocationID: locationID}
+		if err := receiveStock(tx, material, quantity, lot, ref); err != nil {
+			return err
+		}
+		now := time.Now()
+		request.Status = models.RestockStatusReceived
+		request.ReceivedBy = actor
+		request.ReceivedQuantity = quantity
+		request.ClosedAt = &now
+		return nil
+	})
+}
+
+// transition aplica apply a la solicitud bloqueada y la guarda. ReviewedBy
+// queda con el último supervisor que la aprobó o descartó.
+func (r *RestockRepository) transition(id uint, actor string, apply func(tx *gorm.DB, request *models.RestockRequest) error) (*models.RestockRequest, error) {
+	var request models.RestockRequest
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&request, id).Error
+		if err == gorm.ErrRecordNotFound {
+			return ErrRestockNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if err := apply(tx, &request); err != nil {
+			return err
+		}
+		if request.Status != models.RestockStatusReceived {
+			request.ReviewedBy = actor
+		}
+		return tx.Omit("Material").Save(&request).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r.FindById(int(request.ID))
+}
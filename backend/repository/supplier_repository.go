@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"backend-avanzada/models"
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrSupplierNotFound = errors.New("supplier not found")
+	ErrSupplierInUse    = errors.New("supplier has open purchase orders")
+)
+
+type SupplierRepository struct{ db *gorm.DB }
+
+func NewSupplierRepository(db *gorm.DB) *SupplierRepository { return &SupplierRepository{db: db} }
+
+func (r *SupplierRepository) Save(s *models.Supplier) (*models.Supplier, error) {
+	return s, r.db.Save(s).Error
+}
+
+func (r *SupplierRepository) FindAll() ([]*models.Supplier, error) {
+	var xs []*models.Supplier
+	return xs, r.db.Order("name, id").Find(&xs).Error
+}
+
+func (r *SupplierRepository) FindById(id int) (*models.Supplier, error) {
+	var s models.Supplier
+	if err := r.db.First(&s, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &s, nil
+}
+
+// Delete borra el proveedor si no tiene órdenes sin cerrar; las cerradas
+// conservan la referencia para la trazabilidad.
+func (r *SupplierRepository) Delete(s *models.Supplier) error {
+	var open int64
+	err := r.db.Model(&models.PurchaseOrder{}).
+		Where("supplier_id = ? AND status NOT IN ?", s.ID, []string{models.PurchaseOrderStatusReceived, models.PurchaseOrderStatusCancelled}).
+		Count(&open).Error
+	if err != nil {
+		return err
+	}
+	if open > 0 {
+		return ErrSupplierInUse
+	}
+	return r.db.Delete(s).Error
+}
@@ -1,8 +1,12 @@
 package repository
 
 import (
+	"backend-avanzada/formula"
 	"backend-avanzada/models"
 	"errors"
+	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
@@ -10,33 +14,66 @@ import (
 )
 
 var (
-	ErrMaterialNotFound     = errors.New("material not found")
-	ErrInsufficientMaterial = errors.New("insufficient material quantity")
+	ErrMaterialNotFound          = errors.New("material not found")
+	ErrInsufficientMaterial      = errors.New("insufficient material quantity")
+	ErrTransmutationNotFound     = errors.New("transmutation not found")
+	ErrInvalidTransmutationState = errors.New("transmutation cannot change from its current status")
+	ErrRetryLimitReached         = errors.New("transmutation retry limit reached")
+	ErrNotScheduled              = errors.New("transmutation is not scheduled or its time has already arrived")
+	ErrNotStuck                  = errors.New("transmutation made progress after the deadline cutoff")
+	ErrTransmutationChanged      = errors.New("transmutation changed status while it was being edited")
 )
 
 type TransmutationRepository struct {
-	db *gorm.DB
+	db     *gorm.DB
+	quotas *QuotaPolicy
+}
+
+// WithQuotas activa las cuotas por alquimista y rango al crear transmutaciones.
+func (r *TransmutationRepository) WithQuotas(quotas *QuotaPolicy) {
+	r.quotas = quotas
+}
+
+// QuotaUsage devuelve el rango del usuario y su consumo frente a cada cuota.
+func (r *TransmutationRepository) QuotaUsage(userID uint) (string, []QuotaUsage, error) {
+	return r.quotas.Usage(r.db, userID, time.Now())
+}
+
+func (r *TransmutationRepository) withDetails(db *gorm.DB) *gorm.DB {
+	return db.Preload("Inputs").Preload("Outputs").Preload("LotDraws").Preload("Recipe.Inputs.Material").Preload("Recipe.Outputs.Material")
 }
 
 func (r *TransmutationRepository) FindPendingBefore(threshold time.Time) ([]*models.Transmutation, error) {
 	var ts []*models.Transmutation
-	err := r.db.Where("status IN ? AND created_at < ?",
-		[]string{models.TransmutationStatusPending, models.TransmutationStatusProcessing}, threshold).
+	err := r.db.Where("status IN ? AND created_at < ? AND (scheduled_at IS NULL OR scheduled_at < ?)",
+		[]string{models.TransmutationStatusPending, models.TransmutationStatusProcessing}, threshold, time.Now()).
 		Find(&ts).Error
 	return ts, err
 }
 
 func (r *TransmutationRepository) FindById(id int) (*models.Transmutation, error) {
 	var t models.Transmutation
-	err := r.db.First(&t, id).Error
+	err := r.withDetails(r.db).First(&t, id).Error
 	if err == gorm.ErrRecordNotFound {
 		return nil, nil
 	}
 	return &t, err
 }
 
-func (r *TransmutationRepository) Delete(t *models.Transmutation) error {
-	return r.db.Delete(t).Error
+// Delete elimina la transmutación devolviendo al inventario lo reservado si aún no había terminado.
+func (r *TransmutationRepository) Delete(t *models.Transmutation, actor string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		current, err := lockTransmutation(tx, t.ID)
+		if err != nil {
+			return err
+		}
+		if isActiveStatus(current.Status) {
+			if err := refundInputs(tx, current, actor, "transmutation deleted"); err != nil {
+				return err
+			}
+		}
+		return tx.Delete(current).Error
+	})
 }
 
 func NewTransmutationRepository(db *gorm.DB) *TransmutationRepository {
@@ -45,50 +82,893 @@ func NewTransmutationRepository(db *gorm.DB) *TransmutationRepository {
 
 func (r *TransmutationRepository) FindAll() ([]*models.Transmutation, error) {
 	var ts []*models.Transmutation
-	err := r.db.Find(&ts).Error
+	err := r.db.Preload("Inputs").Find(&ts).Error
 	return ts, err
 }
 
 func (r *TransmutationRepository) FindAllByUser(userID uint) ([]*models.Transmutation, error) {
 	var ts []*models.Transmutation
-	err := r.db.Where("user_id = ?", userID).Find(&ts).Error
+	err := r.db.Preload("Inputs").Where("user_id = ?", userID).Find(&ts).Error
 	return ts, err
 }
 
-func (r *TransmutationRepository) Create(t *models.Transmutation) (*models.Transmutation, error) {
+// Create reserva los reactivos y registra la transmutación en una sola transacción.
+// Con receta, Quantity es el número de lotes y se reservan todas sus entradas;
+// sin receta se reserva Quantity de MaterialID. El stock se descuenta al completarse.
+func (r *TransmutationRepository) Create(t *models.Transmutation, actor string) (*models.Transmutation, error) {
 	err := r.db.Transaction(func(tx *gorm.DB) error {
+		return r.create(tx, t, actor)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (r *TransmutationRepository) create(tx *gorm.DB, t *models.Transmutation, actor string) error {
+	inputs, err := resolveInputs(tx, t)
+	if err != nil {
+		return err
+	}
+	inputs = mergeAmounts(inputs)
+	if err := r.quotas.check(tx, t.UserID, inputs, 1, time.Now()); err != nil {
+		return err
+	}
+	locationID, err := reserveMaterials(tx, inputs, locationOf(t))
+	if err != nil {
+		return err
+	}
+	t.LocationID = &locationID
+	return insertTransmutation(tx, t, inputs, actor)
+}
+
+// BatchItemError indica qué elemento de un lote impidió crearlo.
+type BatchItemError struct {
+	Index int
+	Err   error
+}
+
+func (e *BatchItemError) Error() string {
+	return fmt.Sprintf("item %d: %v", e.Index, e.Err)
+}
+
+func (e *BatchItemError) Unwrap() error {
+	return e.Err
+}
+
+// CreateInBatch crea t dentro de batch en su propia transacción. La cabecera
+// del lote se registra junto a la primera transmutación que se crea, así un
+// lote best_effort en el que no se crea ninguna no deja rastro.
+func (r *TransmutationRepository) CreateInBatch(batch *models.TransmutationBatch, t *models.Transmutation, actor string) error {
+	isNew := batch.ID == 0
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if isNew {
+			if err := tx.Omit(clause.Associations).Create(batch).Error; err != nil {
+				return err
+			}
+		}
+		t.BatchID = &batch.ID
+		return r.create(tx, t, actor)
+	})
+	if err != nil && isNew {
+		batch.ID = 0
+		t.BatchID = nil
+	}
+	return err
+}
+
+// CreateBatch registra un lote completo en una sola transacción. Suma los
+// reactivos de las transmutaciones que piden la misma ubicación (o ninguna) y
+// los reserva juntos, tras bloquear todos los materiales del lote en orden de
+// ID, de modo que si falta stock para cualquiera no se crea ninguna.
+func (r *TransmutationRepository) CreateBatch(batch *models.TransmutationBatch, ts []*models.Transmutation, actor string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit(clause.Associations).Create(batch).Error; err != nil {
+			return err
+		}
+		inputs := make([][]materialAmount, len(ts))
+		var all []materialAmount
+		byLocation := map[uint][]materialAmount{}
+		byUser := map[uint][]materialAmount{}
+		counts := map[uint]int{}
+		for i, t := range ts {
+			resolved, err := resolveInputs(tx, t)
+			if err != nil {
+				return &BatchItemError{Index: i, Err: err}
+			}
+			inputs[i] = mergeAmounts(resolved)
+			all = append(all, inputs[i]...)
+			byLocation[locationOf(t)] = append(byLocation[locationOf(t)], inputs[i]...)
+			byUser[t.UserID] = append(byUser[t.UserID], inputs[i]...)
+			counts[t.UserID]++
+		}
+		// Las cuotas se comprueban con el total del lote de cada usuario.
+		userIDs := make([]uint, 0, len(byUser))
+		for id := range byUser {
+			userIDs = append(userIDs, id)
+		}
+		sort.Slice(userIDs, func(i, j int) bool { return userIDs[i] < userIDs[j] })
+		now := time.Now()
+		for _, id := range userIDs {
+			if err := r.quotas.check(tx, id, byUser[id], counts[id], now); err != nil {
+				return err
+			}
+		}
+		// Cada ubicación reserva sus materiales por separado, así que antes se
+		// bloquean todos los del lote en orden de ID; si no, dos lotes con
+		// ubicaciones distintas podrían tomarlos en orden cruzado.
+		for _, a := range mergeAmounts(all) {
+			if _, err := lockMaterial(tx, a.MaterialID); err != nil {
+				return err
+			}
+		}
+		// Las ubicaciones pedidas primero y las que se eligen solas al final.
+		requested := make([]uint, 0, len(byLocation))
+		for id := range byLocation {
+			requested = append(requested, id)
+		}
+		sort.Slice(requested, func(i, j int) bool {
+			return requested[j] == 0 || (requested[i] != 0 && requested[i] < requested[j])
+		})
+		picked := map[uint]uint{}
+		for _, id := range requested {
+			locationID, err := reserveMaterials(tx, byLocation[id], id)
+			if err != nil {
+				return err
+			}
+			picked[id] = locationID
+		}
+		for i, t := range ts {
+			locationID := picked[locationOf(t)]
+			t.LocationID = &locationID
+			t.BatchID = &batch.ID
+			if err := insertTransmutation(tx, t, inputs[i], actor); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// FindBatch devuelve un lote con sus transmutaciones.
+func (r *TransmutationRepository) FindBatch(id int) (*models.TransmutationBatch, error) {
+	var batch models.TransmutationBatch
+	err := r.db.Preload("Transmutations", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id")
+	}).Preload("Transmutations.Inputs").First(&batch, id).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	return &batch, err
+}
+
+// insertTransmutation guarda una transmutación PENDING (o AWAITING_APPROVAL si
+// ya viene así) con lo que se le reservó.
+func insertTransmutation(tx *gorm.DB, t *models.Transmutation, inputs []materialAmount, actor string) error {
+	t.Inputs = make([]models.TransmutationInput, 0, len(inputs))
+	for _, in := range inputs {
+		t.Inputs = append(t.Inputs, models.TransmutationInput{MaterialID: in.MaterialID, Quantity: in.Quantity})
+	}
+	if t.Status != models.TransmutationStatusAwaitingApproval {
+		t.Status = models.TransmutationStatusPending
+	}
+	t.Attempts = 1
+	if err := tx.Omit("Recipe").Create(t).Error; err != nil {
+		return err
+	}
+	if err := recordReservations(tx, t, inputs); err != nil {
+		return err
+	}
+	return recordTransition(tx, t.ID, "", t.Status, actor, "created")
+}
+
+// StockProjection describe cómo quedaría un material en la ubicación de la
+// que se reservaría si se reservara lo requerido.
+type StockProjection struct {
+	MaterialID uint
+	Material   string
+	LocationID uint
+	Available  float64
+	Required   float64
+	Remaining  float64
+}
+
+// ProjectInputs calcula, sin modificar nada, lo que Create reservaría para t y
+// cuánto quedaría de cada material. Sin ubicación en t usa la que elegiría
+// Create o, si ninguna tiene todo, la predeterminada.
+func (r *TransmutationRepository) ProjectInputs(t *models.Transmutation) ([]StockProjection, error) {
+	inputs, err := resolveInputs(r.db, t)
+	if err != nil {
+		return nil, err
+	}
+	inputs = mergeAmounts(inputs)
+	projections := []StockProjection{}
+	now := time.Now()
+	locationID := locationOf(t)
+	if locationID == 0 {
+		locationID, err = pickLocation(r.db, inputs, now)
+		if errors.Is(err, ErrInsufficientMaterial) {
+			locationID, err = defaultLocation(r.db)
+		}
+	} else {
+		locationID, err = resolveLocation(r.db, locationID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, in := range inputs {
 		var material models.Material
-		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&material, t.MaterialID).Error; err != nil {
+		if err := r.db.First(&material, in.MaterialID).Error; err != nil {
 			if err == gorm.ErrRecordNotFound {
-				return ErrMaterialNotFound
+				return nil, ErrMaterialNotFound
 			}
+			return nil, err
+		}
+		// Igual que al reservar, no está disponible lo ya reservado ni lo que
+		// está en lotes caducados.
+		available, err := availableAt(r.db, material.ID, locationID, now)
+		if err != nil {
+			return nil, err
+		}
+		projections = append(projections, StockProjection{
+			MaterialID: material.ID,
+			Material:   material.Name,
+			LocationID: locationID,
+			Available:  available,
+			Required:   in.Quantity,
+			Remaining:  available - in.Quantity,
+		})
+	}
+	return projections, nil
+}
+
+// AverageProcessingDuration devuelve cuánto tardó de media el worker entre
+// PROCESSING y COMPLETED en las últimas transmutaciones completadas, y cuántas
+// se usaron para calcularlo.
+func (r *TransmutationRepository) AverageProcessingDuration(sample int) (time.Duration, int, error) {
+	var completed []models.TransmutationTransition
+	err := r.db.Where("to_status = ?", models.TransmutationStatusCompleted).
+		Order("created_at DESC").Limit(sample).Find(&completed).Error
+	if err != nil || len(completed) == 0 {
+		return 0, 0, err
+	}
+	ids := make([]uint, 0, len(completed))
+	for _, c := range completed {
+		ids = append(ids, c.TransmutationID)
+	}
+	var started []models.TransmutationTransition
+	err = r.db.Where("to_status = ? AND transmutation_id IN ?", models.TransmutationStatusProcessing, ids).
+		Order("created_at").Find(&started).Error
+	if err != nil {
+		return 0, 0, err
+	}
+	// Con reintentos cuenta el último inicio anterior a la finalización.
+	startedAt := map[uint][]time.Time{}
+	for _, s := range started {
+		startedAt[s.TransmutationID] = append(startedAt[s.TransmutationID], s.CreatedAt)
+	}
+	var total time.Duration
+	count := 0
+	for _, c := range completed {
+		var last time.Time
+		for _, at := range startedAt[c.TransmutationID] {
+			if !at.After(c.CreatedAt) {
+				last = at
+			}
+		}
+		if last.IsZero() {
+			continue
+		}
+		total += c.CreatedAt.Sub(last)
+		count++
+	}
+	if count == 0 {
+		return 0, 0, nil
+	}
+	return total / time.Duration(count), count, nil
+}
+
+// resolveInputs calcula las cantidades a consumir a partir de la receta, de
+// los reactivos de la fórmula o del material directo. Con receta deja además
+// sus productos copiados en t.Outputs.
+func resolveInputs(tx *gorm.DB, t *models.Transmutation) ([]materialAmount, error) {
+	if t.RecipeID == nil && strings.TrimSpace(t.Formula) != "" {
+		return formulaInputs(tx, t)
+	}
+	if t.RecipeID == nil {
+		return []materialAmount{{MaterialID: t.MaterialID, Quantity: t.Quantity}}, nil
+	}
+	var recipe models.Recipe
+	if err := tx.Preload("Inputs").Preload("Outputs").First(&recipe, *t.RecipeID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrRecipeNotFound
+		}
+		return nil, err
+	}
+	if len(recipe.Inputs) == 0 {
+		return nil, ErrRecipeNotFound
+	}
+	inputs := make([]materialAmount, 0, len(recipe.Inputs))
+	for _, in := range recipe.Inputs {
+		inputs = append(inputs, materialAmount{MaterialID: in.MaterialID, Quantity: in.Quantity * t.Quantity})
+	}
+	t.Outputs = make([]models.TransmutationOutput, 0, len(recipe.Outputs))
+	for _, out := range recipe.Outputs {
+		t.Outputs = append(t.Outputs, models.TransmutationOutput{MaterialID: out.MaterialID, Quantity: out.Quantity * t.Quantity})
+	}
+	t.MaterialID = recipe.Inputs[0].MaterialID
+	return inputs, nil
+}
+
+// formulaInputs reparte Quantity entre todos los reactivos de la fórmula
+// según sus coeficientes, como hace la evaluación del motor.
+func formulaInputs(tx *gorm.DB, t *models.Transmutation) ([]materialAmount, error) {
+	parsed, err := formula.Parse(t.Formula)
+	if err != nil {
+		return nil, err
+	}
+	evaluation, err := parsed.Evaluate(t.Quantity)
+	if err != nil {
+		return nil, err
+	}
+	inputs := make([]materialAmount, 0, len(evaluation.Inputs))
+	for _, in := range evaluation.Inputs {
+		material, err := materialByName(tx, strings.TrimSpace(in.Material))
+		if err != nil {
+			return nil, err
+		}
+		if material == nil {
+			return nil, fmt.Errorf("%w: %s", ErrMaterialNotFound, in.Material)
+		}
+		inputs = append(inputs, materialAmount{MaterialID: material.ID, Quantity: in.Quantity})
+	}
+	return inputs, nil
+}
+
+// TransitionError describe un cambio de estado que la tabla de transiciones no permite.
+type TransitionError struct {
+	From string
+	To   string
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("cannot change transmutation status from %s to %s", e.From, e.To)
+}
+
+func (e *TransitionError) Unwrap() error {
+	return ErrInvalidTransmutationState
+}
+
+// transition aplica un cambio de estado bajo bloqueo de fila: valida la
+// transición contra models.CanTransitionTransmutation, ejecuta apply dentro de
+// la misma transacción y registra la entrada en el historial.
+func (r *TransmutationRepository) transition(id uint, to, actor, reason string, apply func(tx *gorm.DB, current *models.Transmutation) error) (*models.Transmutation, error) {
+	var updated *models.Transmutation
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		current, err := lockTransmutation(tx, id)
+		if err != nil {
 			return err
 		}
-		if material.Quantity < t.Quantity {
-			return ErrInsufficientMaterial
+		from := current.Status
+		if !models.CanTransitionTransmutation(from, to) {
+			return &TransitionError{From: from, To: to}
+		}
+		if apply != nil {
+			if err := apply(tx, current); err != nil {
+				return err
+			}
 		}
-		material.Quantity -= t.Quantity
-		if err := tx.Save(&material).Error; err != nil {
+		current.Status = to
+		if err := tx.Omit(clause.Associations).Save(current).Error; err != nil {
 			return err
 		}
-		t.Status = models.TransmutationStatusPending
-		if err := tx.Create(t).Error; err != nil {
+		if err := recordTransition(tx, id, from, to, actor, reason); err != nil {
 			return err
 		}
+		updated = current
 		return nil
 	})
-	if errors.Is(err, ErrMaterialNotFound) || errors.Is(err, ErrInsufficientMaterial) {
+	if err != nil {
 		return nil, err
 	}
+	return updated, nil
+}
+
+func recordTransition(tx *gorm.DB, id uint, from, to, actor, reason string) error {
+	return tx.Create(&models.TransmutationTransition{
+		TransmutationID: id,
+		FromStatus:      from,
+		ToStatus:        to,
+		Actor:           actor,
+		Reason:          reason,
+	}).Error
+}
+
+// syncStatus copia en t el estado persistido tras una transición.
+func syncStatus(t, updated *models.Transmutation) *models.Transmutation {
+	t.Status = updated.Status
+	t.Result = updated.Result
+	t.Outcome = updated.Outcome
+	t.Progress = updated.Progress
+	t.UpdatedAt = updated.UpdatedAt
+	return t
+}
+
+// StartProcessing pasa una transmutación PENDING a PROCESSING. Devuelve
+// ErrInvalidTransmutationState si entretanto cambió de estado (p. ej. se canceló).
+func (r *TransmutationRepository) StartProcessing(t *models.Transmutation, actor string) (*models.Transmutation, error) {
+	updated, err := r.transition(t.ID, models.TransmutationStatusProcessing, actor, "processing started", func(tx *gorm.DB, current *models.Transmutation) error {
+		current.Result = t.Result
+		current.Progress = t.Progress
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
-	return t, nil
+	return syncStatus(t, updated), nil
+}
+
+// UpdateProgress guarda el avance de t mientras siga en PROCESSING. Devuelve
+// false si la transmutación ya no está en curso (p. ej. se canceló).
+func (r *TransmutationRepository) UpdateProgress(t *models.Transmutation) (bool, error) {
+	res := r.db.Model(&models.Transmutation{}).
+		Where("id = ? AND status = ?", t.ID, models.TransmutationStatusProcessing).
+		Updates(map[string]interface{}{
+			"progress_stage":       t.Progress.Stage,
+			"progress_percent":     t.Progress.Percent,
+			"progress_message":     t.Progress.Message,
+			"progress_reported_at": t.Progress.ReportedAt,
+		})
+	return res.RowsAffected > 0, res.Error
+}
+
+// FindStuckProcessing devuelve las transmutaciones en PROCESSING que no han
+// cambiado (ni informado avance) desde before.
+func (r *TransmutationRepository) FindStuckProcessing(before time.Time) ([]*models.Transmutation, error) {
+	var ts []*models.Transmutation
+	err := r.db.Where("status = ? AND updated_at < ?", models.TransmutationStatusProcessing, before).
+		Order("id").Find(&ts).Error
+	return ts, err
+}
+
+// TimeOut marca como FAILED una transmutación que superó su plazo en
+// PROCESSING y, como no llegó a producir nada, devuelve lo reservado. Si
+// stuckBefore no es cero solo actúa cuando la fila no ha cambiado desde
+// entonces; si avanzó entretanto devuelve ErrNotStuck.
+func (r *TransmutationRepository) TimeOut(id uint, actor, reason string, stuckBefore time.Time) (*models.Transmutation, error) {
+	return r.transition(id, models.TransmutationStatusFailed, actor, reason, func(tx *gorm.DB, current *models.Transmutation) error {
+		if current.Status != models.TransmutationStatusProcessing {
+			return &TransitionError{From: current.Status, To: models.TransmutationStatusFailed}
+		}
+		if !stuckBefore.IsZero() && !current.UpdatedAt.Before(stuckBefore) {
+			return ErrNotStuck
+		}
+		if err := refundInputs(tx, current, actor, reason); err != nil {
+			return err
+		}
+		now := time.Now().UTC()
+		current.Outcome = nil
+		current.Result = "Timed out: " + reason
+		current.Progress = models.TransmutationProgress{
+			Stage:      models.ProgressStageFailed,
+			Percent:    current.Progress.Percent,
+			Message:    reason,
+			ReportedAt: &now,
+		}
+		return nil
+	})
+}
+
+// Fail marca como FAILED una transmutación que sigue activa y libera lo que
+// tenía reservado; un reintento vuelve a reservarlo.
+func (r *TransmutationRepository) Fail(t *models.Transmutation, actor, reason string) (*models.Transmutation, error) {
+	updated, err := r.transition(t.ID, models.TransmutationStatusFailed, actor, reason, func(tx *gorm.DB, current *models.Transmutation) error {
+		if _, err := releaseReservations(tx, current); err != nil {
+			return err
+		}
+		current.Result = t.Result
+		current.Outcome = t.Outcome
+		current.Progress = t.Progress
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return syncStatus(t, updated), nil
+}
+
+// Cancel cancela una transmutación PENDING o PROCESSING y libera todo lo que
+// reservó, en una sola transacción.
+func (r *TransmutationRepository) Cancel(id uint, actor, reason string) (*models.Transmutation, error) {
+	return r.transition(id, models.TransmutationStatusCancelled, actor, reason, func(tx *gorm.DB, current *models.Transmutation) error {
+		if err := refundInputs(tx, current, actor, reason); err != nil {
+			return err
+		}
+		current.Result = "Cancelled"
+		if reason != "" {
+			current.Result = "Cancelled: " + reason
+		}
+		return nil
+	})
 }
 
-func (r *TransmutationRepository) Save(t *models.Transmutation) (*models.Transmutation, error) {
-	if err := r.db.Save(t).Error; err != nil {
+// Complete guarda la transmutación completada, convierte sus reservas en
+// consumo y acredita en inventario sus productos en la misma transacción. Los
+// productos de fórmula sin material registrado se dan de alta con la categoría
+// del material de origen; el resultado queda enlazado al ID de cada material
+// acreditado. Solo aplica si la transmutación sigue en PROCESSING.
+func (r *TransmutationRepository) Complete(t *models.Transmutation, actor string) (*models.Transmutation, error) {
+	updated, err := r.transition(t.ID, models.TransmutationStatusCompleted, actor, "processing finished", func(tx *gorm.DB, current *models.Transmutation) error {
+		if err := consumeReservations(tx, current, actor); err != nil {
+			return err
+		}
+		current.Result = t.Result
+		if t.Outcome != nil {
+			outcome := *t.Outcome
+			outcome.Outputs = append([]models.TransmutationComponent{}, t.Outcome.Outputs...)
+			outputs := []materialAmount{}
+			var source *models.Material
+			for i := range outcome.Outputs {
+				out := &outcome.Outputs[i]
+				if out.Quantity <= 0 {
+					continue
+				}
+				if out.MaterialID == 0 {
+					if source == nil {
+						var err error
+						if source, err = sourceMaterial(tx, current); err != nil {
+							return err
+						}
+					}
+					material, created, err := productMaterial(tx, out.Material, source, out.EnergyValue)
+					if err != nil {
+						return err
+					}
+					out.MaterialID = material.ID
+					out.Material = material.Name
+					out.Created = created
+				}
+				outputs = append(outputs, materialAmount{MaterialID: out.MaterialID, Quantity: out.Quantity})
+			}
+			if err := creditMaterials(tx, outputs, transmutationRef(current, actor, "produced")); err != nil {
+				return err
+			}
+			current.Outcome = &outcome
+			current.Result = outcome.Summary()
+		}
+		current.Progress = t.Progress
+		return nil
+	})
+	if err != nil {
 		return nil, err
 	}
-	return t, nil
+	return syncStatus(t, updated), nil
+}
+
+// Retry devuelve a PENDING una transmutación FAILED: vuelve a reservar sus
+// reactivos (al fallar se liberaron) e incrementa Attempts,
+// siempre que no se hayan agotado los maxRetries reintentos.
+func (r *TransmutationRepository) Retry(id uint, actor string, maxRetries int) (*models.Transmutation, error) {
+	return r.transition(id, models.TransmutationStatusPending, actor, "retry", func(tx *gorm.DB, current *models.Transmutation) error {
+		if current.Status != models.TransmutationStatusFailed {
+			return &TransitionError{From: current.Status, To: models.TransmutationStatusPending}
+		}
+		if current.Attempts < 1 {
+			current.Attempts = 1
+		}
+		if current.Attempts-1 >= maxRetries {
+			return ErrRetryLimitReached
+		}
+		reserved := reservedAmounts(current)
+		// Al fallar dejó de contar para las cuotas; el reintento vuelve a hacerlo.
+		if err := r.quotas.check(tx, current.UserID, reserved, 1, time.Now()); err != nil {
+			return err
+		}
+		locationID, err := reserveMaterials(tx, reserved, locationOf(current))
+		if err != nil {
+			return err
+		}
+		current.LocationID = &locationID
+		current.Attempts++
+		if err := recordReservations(tx, current, reserved); err != nil {
+			return err
+		}
+		current.Outcome = nil
+		current.Progress = models.TransmutationProgress{}
+		current.Result = fmt.Sprintf("Retry %d of %d queued", current.Attempts-1, maxRetries)
+		return nil
+	})
+}
+
+// Reschedule cambia la hora de una transmutación PENDING cuya ejecución
+// programada aún no ha llegado; con at nil queda lista para ejecutarse ya.
+func (r *TransmutationRepository) Reschedule(id uint, at *time.Time) (*models.Transmutation, error) {
+	var updated *models.Transmutation
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		current, err := lockTransmutation(tx, id)
+		if err != nil {
+			return err
+		}
+		if current.Status != models.TransmutationStatusPending || current.ScheduledAt == nil || !current.ScheduledAt.After(time.Now()) {
+			return ErrNotScheduled
+		}
+		current.ScheduledAt = at
+		if err := tx.Omit(clause.Associations).Save(current).Error; err != nil {
+			return err
+		}
+		updated = current
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// Approve libera una transmutación AWAITING_APPROVAL para que el worker la procese.
+func (r *TransmutationRepository) Approve(id uint, actor, comment string) (*models.Transmutation, error) {
+	return r.transition(id, models.TransmutationStatusPending, actor, ReviewReason("approved", comment), func(tx *gorm.DB, current *models.Transmutation) error {
+		if current.Status != models.TransmutationStatusAwaitingApproval {
+			return &TransitionError{From: current.Status, To: models.TransmutationStatusPending}
+		}
+		current.ReviewedBy = actor
+		current.ReviewComment = comment
+		return nil
+	})
+}
+
+// Reject rechaza una transmutación AWAITING_APPROVAL y devuelve al inventario lo reservado.
+func (r *TransmutationRepository) Reject(id uint, actor, comment string) (*models.Transmutation, error) {
+	return r.transition(id, models.TransmutationStatusRejected, actor, ReviewReason("rejected", comment), func(tx *gorm.DB, current *models.Transmutation) error {
+		if err := refundInputs(tx, current, actor, ReviewReason("rejected", comment)); err != nil {
+			return err
+		}
+		current.ReviewedBy = actor
+		current.ReviewComment = comment
+		current.Result = "Rejected: " + comment
+		return nil
+	})
+}
+
+// ReviewReason es el motivo que se guarda en el historial y la auditoría de
+// una aprobación o un rechazo.
+func ReviewReason(decision, comment string) string {
+	if comment == "" {
+		return decision
+	}
+	return decision + ": " + comment
+}
+
+// FindByStatus devuelve las transmutaciones en un estado, de la más antigua a la más reciente.
+func (r *TransmutationRepository) FindByStatus(status string) ([]*models.Transmutation, error) {
+	var ts []*models.Transmutation
+	err := r.db.Preload("Inputs").Where("status = ?", status).Order("created_at, id").Find(&ts).Error
+	return ts, err
+}
+
+// UpdateStatus aplica un cambio de estado manual guardando también los
+// demás campos editados de t. La cancelación debe pasar por Cancel.
+// PROCESSING y COMPLETED solo los asigna el worker, que es quien procesa y
+// acredita los productos. Al salir de un estado activo se liberan las reservas.
+func (r *TransmutationRepository) UpdateStatus(t *models.Transmutation, to, actor, reason string) (*models.Transmutation, error) {
+	if to == models.TransmutationStatusProcessing || to == models.TransmutationStatusCompleted {
+		return nil, fmt.Errorf("%w: %s is only set by the worker", ErrInvalidTransmutationState, to)
+	}
+	updated, err := r.transition(t.ID, to, actor, reason, func(tx *gorm.DB, current *models.Transmutation) error {
+		if isActiveStatus(current.Status) && !isActiveStatus(to) {
+			if _, err := releaseReservations(tx, current); err != nil {
+				return err
+			}
+		}
+		current.Formula = t.Formula
+		current.Result = t.Result
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	t.Formula = updated.Formula
+	return syncStatus(t, updated), nil
+}
+
+// FindHistory devuelve las transiciones de estado de una transmutación en orden cronológico.
+func (r *TransmutationRepository) FindHistory(id uint) ([]*models.TransmutationTransition, error) {
+	var history []*models.TransmutationTransition
+	err := r.db.Where("transmutation_id = ?", id).Order("created_at, id").Find(&history).Error
+	return history, err
+}
+
+// sourceMaterial es el material del que un producto nuevo toma categoría y
+// unidad: el de origen de la transmutación o, si no tiene categoría, el
+// primero que reservó que la tenga. Devuelve nil si no encuentra ninguno.
+func sourceMaterial(tx *gorm.DB, t *models.Transmutation) (*models.Material, error) {
+	ids := []uint{}
+	if t.MaterialID != 0 {
+		ids = append(ids, t.MaterialID)
+	}
+	for _, in := range t.Inputs {
+		ids = append(ids, in.MaterialID)
+	}
+	var first *models.Material
+	for _, id := range ids {
+		var ms []models.Material
+		if err := tx.Where("id = ?", id).Limit(1).Find(&ms).Error; err != nil {
+			return nil, err
+		}
+		if len(ms) == 0 {
+			continue
+		}
+		if ms[0].Category != "" {
+			return &ms[0], nil
+		}
+		if first == nil {
+			first = &ms[0]
+		}
+	}
+	return first, nil
+}
+
+// lockTransmutation obtiene la transmutación con bloqueo de escritura junto a sus entradas reservadas.
+func lockTransmutation(tx *gorm.DB, id uint) (*models.Transmutation, error) {
+	var t models.Transmutation
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Inputs").First(&t, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrTransmutationNotFound
+		}
+		return nil, err
+	}
+	return &t, nil
+}
+
+func isActiveStatus(status string) bool {
+	return status == models.TransmutationStatusPending ||
+		status == models.TransmutationStatusProcessing ||
+		status == models.TransmutationStatusAwaitingApproval
+}
+
+// reservedAmounts devuelve lo que la transmutación reserva del inventario en cada intento.
+func reservedAmounts(t *models.Transmutation) []materialAmount {
+	amounts := make([]materialAmount, 0, len(t.Inputs))
+	for _, in := range t.Inputs {
+		amounts = append(amounts, materialAmount{MaterialID: in.MaterialID, Quantity: in.Quantity})
+	}
+	// Transmutaciones anteriores a las recetas no guardaban sus entradas.
+	if len(amounts) == 0 && t.MaterialID != 0 && t.Quantity > 0 {
+		amounts = append(amounts, materialAmount{MaterialID: t.MaterialID, Quantity: t.Quantity})
+	}
+	return mergeAmounts(amounts)
+}
+
+// refundInputs libera lo que la transmutación tiene reservado. Si es anterior
+// a las reservas, devuelve al inventario (y a sus lotes) lo que descontó al
+// crearse y lo anota en el libro como devolución.
+func refundInputs(tx *gorm.DB, t *models.Transmutation, actor, reason string) error {
+	released, err := releaseReservations(tx, t)
+	if err != nil || released {
+		return err
+	}
+	// Sin reservas activas es una transmutación anterior a las reservas, que
+	// descontó el stock al crearse: se devuelve como antes.
+	if err := returnLotDraws(tx, t); err != nil {
+		return err
+	}
+	ref := transmutationRef(t, actor, reason)
+	locationID, err := orDefault(tx, ref.LocationID)
+	if err != nil {
+		return err
+	}
+	ref.LocationID = locationID
+	for _, a := range reservedAmounts(t) {
+		material, err := lockMaterial(tx, a.MaterialID)
+		if errors.Is(err, ErrMaterialNotFound) {
+			// El material se eliminó después de reservarse: no hay dónde devolverlo.
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		material.Quantity += a.Quantity
+		if err := tx.Save(material).Error; err != nil {
+			return err
+		}
+		if _, err := adjustStock(tx, a.MaterialID, locationID, a.Quantity, 0); err != nil {
+			return err
+		}
+		if err := recordMovement(tx, a.MaterialID, models.StockMovementRefund, a.Quantity, ref); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TransmutationChanges son los campos que PUT /transmutations/{id} edita sin
+// cambiar de estado; nil deja el campo como está.
+type TransmutationChanges struct {
+	Formula *string
+	Result  *string
+}
+
+// Edit aplica changes a la transmutación bloqueada si sigue en status; si
+// entretanto cambió (p. ej. el worker la pasó a PROCESSING) devuelve
+// ErrTransmutationChanged sin tocarla. Cambiar la fórmula cambia lo que se
+// reserva, así que solo se admite antes de procesarla o tras fallar: en
+// PENDING y AWAITING_APPROVAL se libera la reserva anterior y se reservan los
+// reactivos nuevos en la misma ubicación; en FAILED se guardan para el
+// reintento.
+func (r *TransmutationRepository) Edit(id uint, status string, changes TransmutationChanges) (*models.Transmutation, error) {
+	var updated *models.Transmutation
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		current, err := lockTransmutation(tx, id)
+		if err != nil {
+			return err
+		}
+		if current.Status != status {
+			return fmt.Errorf("%w: it is now %s", ErrTransmutationChanged, current.Status)
+		}
+		if changes.Formula != nil && *changes.Formula != current.Formula {
+			current.Formula = *changes.Formula
+			if current.RecipeID == nil {
+				if err := r.replaceInputs(tx, current); err != nil {
+					return err
+				}
+			}
+		}
+		if changes.Result != nil {
+			current.Result = *changes.Result
+		}
+		if err := tx.Model(current).Omit(clause.Associations).
+			Updates(map[string]interface{}{"formula": current.Formula, "result": current.Result, "location_id": current.LocationID}).Error; err != nil {
+			return err
+		}
+		updated = current
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// replaceInputs recalcula los reactivos de t tras cambiar su fórmula y, si
+// está reservando, cambia la reserva por la de los nuevos.
+func (r *TransmutationRepository) replaceInputs(tx *gorm.DB, t *models.Transmutation) error {
+	reserving := t.Status == models.TransmutationStatusPending || t.Status == models.TransmutationStatusAwaitingApproval
+	if !reserving && t.Status != models.TransmutationStatusFailed {
+		return fmt.Errorf("%w: the formula of a %s transmutation cannot change", ErrInvalidTransmutationState, t.Status)
+	}
+	inputs, err := resolveInputs(tx, t)
+	if err != nil {
+		return err
+	}
+	inputs = mergeAmounts(inputs)
+	if reserving {
+		if _, err := releaseReservations(tx, t); err != nil {
+			return err
+		}
+	}
+	// Las entradas anteriores se sustituyen por las de la fórmula nueva.
+	if err := tx.Where("transmutation_id = ?", t.ID).Delete(&models.TransmutationInput{}).Error; err != nil {
+		return err
+	}
+	if reserving {
+		if err := r.quotas.check(tx, t.UserID, inputs, 0, time.Now()); err != nil {
+			return err
+		}
+		locationID, err := reserveMaterials(tx, inputs, locationOf(t))
+		if err != nil {
+			return err
+		}
+		t.LocationID = &locationID
+		if err := recordReservations(tx, t, inputs); err != nil {
+			return err
+		}
+	}
+	t.Inputs = make([]models.TransmutationInput, 0, len(inputs))
+	for _, in := range inputs {
+		t.Inputs = append(t.Inputs, models.TransmutationInput{TransmutationID: t.ID, MaterialID: in.MaterialID, Quantity: in.Quantity})
+	}
+	if len(t.Inputs) == 0 {
+		return nil
+	}
+	return tx.Create(&t.Inputs).Error
 }
@@ -0,0 +1,189 @@
+package repository
+
+import (
+	"backend-avanzada/models"
+	"errors"
+	"testing"
+)
+
+func TestFormulaTransmutationReservesEveryReactant(t *testing.T) {
+	db := newTestDB(t)
+	mercury := createMaterial(t, db, &models.Material{Name: "Mercury", Quantity: 10, EnergyValue: 2})
+	sulfur := createMaterial(t, db, &models.Material{Name: "Sulfur", Quantity: 10, EnergyValue: 1})
+	createMaterial(t, db, &models.Material{Name: "Cinnabar", EnergyValue: 1})
+	repo := NewTransmutationRepository(db)
+
+	tm, err := repo.Create(&models.Transmutation{
+		UserID:     1,
+		MaterialID: mercury.ID,
+		Formula:    "2 Mercury + Sulfur -> 3 Cinnabar",
+		Quantity:   3,
+	}, "test")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	for _, want := range []struct {
+		material *models.Material
+		reserved float64
+	}{{mercury, 2}, {sulfur, 1}} {
+		if got := reloadMaterial(t, db, want.material.ID); got.Reserved != want.reserved || got.Quantity != 10 {
+			t.Errorf("%s after Create: quantity %v reserved %v, want 10 and %v", got.Name, got.Quantity, got.Reserved, want.reserved)
+		}
+	}
+
+	if _, err := repo.StartProcessing(tm, "worker"); err != nil {
+		t.Fatalf("StartProcessing: %v", err)
+	}
+	if _, err := repo.Complete(tm, "worker"); err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	for _, want := range []struct {
+		material *models.Material
+		quantity float64
+	}{{mercury, 8}, {sulfur, 9}} {
+		if got := reloadMaterial(t, db, want.material.ID); got.Quantity != want.quantity || got.Reserved != 0 {
+			t.Errorf("%s after Complete: quantity %v reserved %v, want %v and 0", got.Name, got.Quantity, got.Reserved, want.quantity)
+		}
+	}
+}
+
+// newFormulaTransmutation crea una transmutación PENDING de quantity Mercury
+// que reserva Mercury y Sulfur.
+func newFormulaTransmutation(t *testing.T, repo *TransmutationRepository, mercury *models.Material, quantity float64) *models.Transmutation {
+	t.Helper()
+	tm, err := repo.Create(&models.Transmutation{
+		UserID:     1,
+		MaterialID: mercury.ID,
+		Formula:    "2 Mercury + Sulfur -> 3 Cinnabar",
+		Quantity:   quantity,
+	}, "test")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	return tm
+}
+
+func TestEditDoesNotOverwriteWorkerTransition(t *testing.T) {
+	db := newTestDB(t)
+	mercury := createMaterial(t, db, &models.Material{Name: "Mercury", Quantity: 10, EnergyValue: 2})
+	createMaterial(t, db, &models.Material{Name: "Sulfur", Quantity: 10, EnergyValue: 1})
+	createMaterial(t, db, &models.Material{Name: "Cinnabar", EnergyValue: 1})
+	repo := NewTransmutationRepository(db)
+	tm := newFormulaTransmutation(t, repo, mercury, 3)
+
+	// El worker la toma después de que el handler la leyera en PENDING.
+	if _, err := repo.StartProcessing(&models.Transmutation{Model: tm.Model}, "worker"); err != nil {
+		t.Fatalf("StartProcessing: %v", err)
+	}
+	result := "edited"
+	if _, err := repo.Edit(tm.ID, models.TransmutationStatusPending, TransmutationChanges{Result: &result}); !errors.Is(err, ErrTransmutationChanged) {
+		t.Fatalf("Edit = %v, want %v", err, ErrTransmutationChanged)
+	}
+	stored, err := repo.FindById(int(tm.ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != models.TransmutationStatusProcessing || stored.Result == result {
+		t.Errorf("after stale Edit: status %s result %q, want PROCESSING and unchanged", stored.Status, stored.Result)
+	}
+}
+
+func TestEditFormulaReplacesReservation(t *testing.T) {
+	db := newTestDB(t)
+	mercury := createMaterial(t, db, &models.Material{Name: "Mercury", Quantity: 10, EnergyValue: 2})
+	sulfur := createMaterial(t, db, &models.Material{Name: "Sulfur", Quantity: 10, EnergyValue: 1})
+	createMaterial(t, db, &models.Material{Name: "Cinnabar", EnergyValue: 1})
+	repo := NewTransmutationRepository(db)
+	tm := newFormulaTransmutation(t, repo, mercury, 3)
+
+	edited := "Mercury -> Cinnabar"
+	updated, err := repo.Edit(tm.ID, models.TransmutationStatusPending, TransmutationChanges{Formula: &edited})
+	if err != nil {
+		t.Fatalf("Edit: %v", err)
+	}
+	if updated.Formula != edited || len(updated.Inputs) != 1 || updated.Inputs[0].Quantity != 3 {
+		t.Errorf("Edit: formula %q inputs %+v, want %q reserving 3 Mercury", updated.Formula, updated.Inputs, edited)
+	}
+	if got := reloadMaterial(t, db, mercury.ID); got.Reserved != 3 {
+		t.Errorf("Mercury reserved = %v, want 3", got.Reserved)
+	}
+	if got := reloadMaterial(t, db, sulfur.ID); got.Reserved != 0 {
+		t.Errorf("Sulfur reserved = %v, want 0", got.Reserved)
+	}
+
+	if _, err := repo.StartProcessing(updated, "worker"); err != nil {
+		t.Fatalf("StartProcessing: %v", err)
+	}
+	if _, err := repo.Edit(tm.ID, models.TransmutationStatusProcessing, TransmutationChanges{Formula: &edited}); err != nil {
+		t.Errorf("Edit with the same formula while PROCESSING: %v", err)
+	}
+	other := "2 Mercury + Sulfur -> 3 Cinnabar"
+	if _, err := repo.Edit(tm.ID, models.TransmutationStatusProcessing, TransmutationChanges{Formula: &other}); !errors.Is(err, ErrInvalidTransmutationState) {
+		t.Errorf("Edit formula while PROCESSING = %v, want %v", err, ErrInvalidTransmutationState)
+	}
+}
+
+func TestTransmutationStateMachine(t *testing.T) {
+	db := newTestDB(t)
+	mercury := createMaterial(t, db, &models.Material{Name: "Mercury", Quantity: 10, EnergyValue: 2})
+	sulfur := createMaterial(t, db, &models.Material{Name: "Sulfur", Quantity: 10, EnergyValue: 1})
+	createMaterial(t, db, &models.Material{Name: "Cinnabar", EnergyValue: 1})
+	repo := NewTransmutationRepository(db)
+	tm := newFormulaTransmutation(t, repo, mercury, 3)
+
+	for _, to := range []string{models.TransmutationStatusProcessing, models.TransmutationStatusCompleted} {
+		if _, err := repo.UpdateStatus(tm, to, "supervisor", ""); !errors.Is(err, ErrInvalidTransmutationState) {
+			t.Errorf("UpdateStatus(%s) = %v, want %v", to, err, ErrInvalidTransmutationState)
+		}
+	}
+	if _, err := repo.Retry(tm.ID, "test", 3); !errors.Is(err, ErrInvalidTransmutationState) {
+		t.Errorf("Retry of a PENDING transmutation = %v, want %v", err, ErrInvalidTransmutationState)
+	}
+
+	if _, err := repo.StartProcessing(tm, "worker"); err != nil {
+		t.Fatalf("StartProcessing: %v", err)
+	}
+	if _, err := repo.Fail(tm, "worker", "boom"); err != nil {
+		t.Fatalf("Fail: %v", err)
+	}
+	for _, m := range []*models.Material{mercury, sulfur} {
+		if got := reloadMaterial(t, db, m.ID); got.Reserved != 0 || got.Quantity != 10 {
+			t.Errorf("%s after Fail: quantity %v reserved %v, want 10 and 0", got.Name, got.Quantity, got.Reserved)
+		}
+	}
+
+	retried, err := repo.Retry(tm.ID, "test", 1)
+	if err != nil {
+		t.Fatalf("Retry: %v", err)
+	}
+	if retried.Status != models.TransmutationStatusPending || retried.Attempts != 2 {
+		t.Errorf("Retry: status %s attempts %d, want PENDING and 2", retried.Status, retried.Attempts)
+	}
+	if got := reloadMaterial(t, db, sulfur.ID); got.Reserved != 1 {
+		t.Errorf("Sulfur reserved after Retry = %v, want 1", got.Reserved)
+	}
+
+	if _, err := repo.Cancel(tm.ID, "test", "no longer needed"); err != nil {
+		t.Fatalf("Cancel: %v", err)
+	}
+	if got := reloadMaterial(t, db, sulfur.ID); got.Reserved != 0 {
+		t.Errorf("Sulfur reserved after Cancel = %v, want 0", got.Reserved)
+	}
+	if _, err := repo.Cancel(tm.ID, "test", ""); !errors.Is(err, ErrInvalidTransmutationState) {
+		t.Errorf("second Cancel = %v, want %v", err, ErrInvalidTransmutationState)
+	}
+
+	history, err := repo.FindHistory(tm.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"PENDING", "PROCESSING", "FAILED", "PENDING", "CANCELLED"}
+	if len(history) != len(want) {
+		t.Fatalf("history has %d entries, want %d", len(history), len(want))
+	}
+	for i, h := range history {
+		if h.ToStatus != want[i] {
+			t.Errorf("history[%d] = %s, want %s", i, h.ToStatus, want[i])
+		}
+	}
+}
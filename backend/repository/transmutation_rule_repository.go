@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"backend-avanzada/models"
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+var ErrRuleNameTaken = errors.New("a transmutation rule with that name already exists")
+
+type TransmutationRuleRepository struct {
+	db *gorm.DB
+}
+
+func NewTransmutationRuleRepository(db *gorm.DB) *TransmutationRuleRepository {
+	return &TransmutationRuleRepository{db: db}
+}
+
+func (r *TransmutationRuleRepository) FindAll() ([]*models.TransmutationRule, error) {
+	var rules []*models.TransmutationRule
+	err := r.db.Order("id").Find(&rules).Error
+	return rules, err
+}
+
+// FindEnabled devuelve las reglas activas en orden de creación.
+func (r *TransmutationRuleRepository) FindEnabled() ([]*models.TransmutationRule, error) {
+	var rules []*models.TransmutationRule
+	err := r.db.Where("enabled = ?", true).Order("id").Find(&rules).Error
+	return rules, err
+}
+
+func (r *TransmutationRuleRepository) FindById(id int) (*models.TransmutationRule, error) {
+	var rule models.TransmutationRule
+	err := r.db.First(&rule, id).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+// Save crea o actualiza la regla; el nombre debe ser único entre las reglas vigentes.
+func (r *TransmutationRuleRepository) Save(rule *models.TransmutationRule) (*models.TransmutationRule, error) {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&models.TransmutationRule{}).
+			Where("LOWER(name) = LOWER(?) AND id <> ?", rule.Name, rule.ID).
+			Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrRuleNameTaken
+		}
+		return tx.Save(rule).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
+
+func (r *TransmutationRuleRepository) Delete(rule *models.TransmutationRule) error {
+	return r.db.Delete(rule).Error
+}
+
+// SeedMissing inserta las reglas del fichero de configuración que nunca se
+// han guardado. Las editadas o borradas desde la API no se tocan: el borrado
+// es lógico, así que una regla borrada no vuelve al reiniciar.
+func (r *TransmutationRuleRepository) SeedMissing(rules []*models.TransmutationRule) (int, error) {
+	inserted := 0
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		for _, rule := range rules {
+			var count int64
+			if err := tx.Unscoped().Model(&models.TransmutationRule{}).
+				Where("LOWER(name) = LOWER(?)", rule.Name).
+				Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				continue
+			}
+			if err := tx.Create(rule).Error; err != nil {
+				return err
+			}
+			inserted++
+		}
+		return nil
+	})
+	return inserted, err
+}
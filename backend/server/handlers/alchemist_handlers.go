@@ -49,6 +49,18 @@ func (h *AlchemistHandler) userEmail(r *http.Request) string {
 	return ""
 }
 
+// alchemistSaveStatus traduce los errores al enlazar el usuario del alquimista.
+func alchemistSaveStatus(err error) int {
+	switch {
+	case errors.Is(err, repository.ErrUserNotFound):
+		return http.StatusBadRequest
+	case errors.Is(err, repository.ErrUserAlreadyLinked):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
 func (h *AlchemistHandler) GetAll(w http.ResponseWriter, r *http.Request) {
 	start := time.Now()
 	alchs, err := h.Repo.FindAll()
@@ -64,6 +76,7 @@ func (h *AlchemistHandler) GetAll(w http.ResponseWriter, r *http.Request) {
 			Age:       a.Age,
 			Specialty: a.Specialty,
 			Rank:      a.Rank,
+			UserID:    a.UserID,
 			CreatedAt: a.CreatedAt.Format(time.RFC3339),
 		})
 	}
@@ -94,6 +107,7 @@ func (h *AlchemistHandler) GetByID(w http.ResponseWriter, r *http.Request) {
 		Age:       a.Age,
 		Specialty: a.Specialty,
 		Rank:      a.Rank,
+		UserID:    a.UserID,
 		CreatedAt: a.CreatedAt.Format(time.RFC3339),
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -117,10 +131,11 @@ func (h *AlchemistHandler) Create(w http.ResponseWriter, r *http.Request) {
 		Age:       int(req.Age),
 		Specialty: req.Specialty,
 		Rank:      req.Rank,
+		UserID:    req.UserID,
 	}
 	a, err := h.Repo.Save(a)
 	if err != nil {
-		h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
+		h.HandleErr(w, alchemistSaveStatus(err), r.URL.Path, err)
 		return
 	}
 	if h.Dispatcher != nil {
@@ -134,6 +149,7 @@ func (h *AlchemistHandler) Create(w http.ResponseWriter, r *http.Request) {
 		Age:       a.Age,
 		Specialty: a.Specialty,
 		Rank:      a.Rank,
+		UserID:    a.UserID,
 		CreatedAt: a.CreatedAt.Format(time.RFC3339),
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -201,9 +217,15 @@ func (h *AlchemistHandler) Edit(w http.ResponseWriter, r *http.Request) {
 	if req.Rank != nil {
 		a.Rank = *req.Rank
 	}
+	if req.UserID != nil {
+		a.UserID = req.UserID
+		if *req.UserID == 0 {
+			a.UserID = nil
+		}
+	}
 
 	if _, err := h.Repo.Save(a); err != nil {
-		h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
+		h.HandleErr(w, alchemistSaveStatus(err), r.URL.Path, err)
 		return
 	}
 	if h.Dispatcher != nil {
@@ -218,6 +240,7 @@ func (h *AlchemistHandler) Edit(w http.ResponseWriter, r *http.Request) {
 		Age:       a.Age,
 		Specialty: a.Specialty,
 		Rank:      a.Rank,
+		UserID:    a.UserID,
 		CreatedAt: a.CreatedAt.Format(time.RFC3339),
 	}
 	w.Header().Set("Content-Type", "application/json")
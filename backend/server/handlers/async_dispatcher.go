@@ -1,9 +1,14 @@
 package handlers
 
+import "time"
+
 // AsyncDispatcher representa el contrato mínimo necesitan para
 // enviar eventos al sistema asíncrono sin acoplarse a una implementación
 // específica.
 type AsyncDispatcher interface {
 	EnqueueTransmutationProcessing(transmutationID uint, requestedBy string) error
+	ScheduleTransmutationProcessing(transmutationID uint, requestedBy string, at time.Time) error
 	EnqueueAudit(action, entity string, entityID uint, userEmail, details string) error
+	CancelTransmutationProcessing(transmutationID uint)
+	EnqueuePipelineAdvance(pipelineID uint, requestedBy string) error
 }
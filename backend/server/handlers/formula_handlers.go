@@ -0,0 +1,316 @@
+package handlers
+
+import (
+	"backend-avanzada/api"
+	"backend-avanzada/formula"
+	"backend-avanzada/models"
+	"backend-avanzada/repository"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+type FormulaHandler struct {
+	Repo             *repository.FormulaRepository
+	Dispatcher       AsyncDispatcher
+	CurrentUser      func(*http.Request) *api.AuthenticatedUser
+	ReportAsyncError func(string, error)
+	HandleErr        func(http.ResponseWriter, int, string, error)
+	Log              func(int, string, time.Time)
+}
+
+func NewFormulaHandler(
+	repo *repository.FormulaRepository,
+	dispatcher AsyncDispatcher,
+	currentUser func(*http.Request) *api.AuthenticatedUser,
+	reportAsyncError func(string, error),
+	handleErr func(http.ResponseWriter, int, string, error),
+	log func(int, string, time.Time),
+) *FormulaHandler {
+	return &FormulaHandler{
+		Repo:             repo,
+		Dispatcher:       dispatcher,
+		CurrentUser:      currentUser,
+		ReportAsyncError: reportAsyncError,
+		HandleErr:        handleErr,
+		Log:              log,
+	}
+}
+
+func (h *FormulaHandler) currentUser(r *http.Request) *api.AuthenticatedUser {
+	if h.CurrentUser != nil {
+		return h.CurrentUser(r)
+	}
+	return nil
+}
+
+func formulaVersionToResponse(v *models.FormulaVersion) api.FormulaVersionResponseDto {
+	return api.FormulaVersionResponseDto{
+		FormulaID: v.FormulaID,
+		Version:   v.Version,
+		Body:      v.Body,
+		Author:    v.Author,
+		Notes:     v.Notes,
+		CreatedAt: v.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+func latestFormulaVersion(f *models.Formula) *models.FormulaVersion {
+	for i := range f.Versions {
+		if f.Versions[i].Version == f.LatestVersion {
+			return &f.Versions[i]
+		}
+	}
+	return nil
+}
+
+// formulaToResponse incluye el historial de versiones solo si withVersions.
+func formulaToResponse(f *models.Formula, withVersions bool) *api.FormulaResponseDto {
+	resp := &api.FormulaResponseDto{
+		ID:                f.ID,
+		Name:              f.Name,
+		Description:       f.Description,
+		Author:            f.Author,
+		LatestVersion:     f.LatestVersion,
+		Deprecated:        f.Deprecated,
+		DeprecationReason: f.DeprecationReason,
+		CreatedAt:         f.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:         f.UpdatedAt.Format(time.RFC3339),
+	}
+	if latest := latestFormulaVersion(f); latest != nil {
+		resp.Body = latest.Body
+	}
+	if withVersions {
+		for i := range f.Versions {
+			resp.Versions = append(resp.Versions, formulaVersionToResponse(&f.Versions[i]))
+		}
+	}
+	return resp
+}
+
+// formulaBody normaliza el cuerpo y comprueba que es una fórmula válida.
+func formulaBody(body string) (string, error) {
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return "", errors.New("body required")
+	}
+	if _, err := formula.Parse(body); err != nil {
+		return "", err
+	}
+	return body, nil
+}
+
+func (h *FormulaHandler) GetAll(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	formulas, err := h.Repo.FindAll()
+	if err != nil {
+		h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
+		return
+	}
+	resp := make([]*api.FormulaResponseDto, 0, len(formulas))
+	for _, f := range formulas {
+		resp = append(resp, formulaToResponse(f, false))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": resp})
+	h.Log(http.StatusOK, r.URL.Path, start)
+}
+
+func (h *FormulaHandler) GetByID(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, err)
+		return
+	}
+	f, err := h.Repo.FindById(id)
+	if err != nil {
+		h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
+		return
+	}
+	if f == nil {
+		h.HandleErr(w, http.StatusNotFound, r.URL.Path, repository.ErrFormulaNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": formulaToResponse(f, true)})
+	h.Log(http.StatusOK, r.URL.Path, start)
+}
+
+// GetVersion devuelve una versión concreta, también de fórmulas obsoletas,
+// para consultar con qué cuerpo se creó una transmutación antigua.
+func (h *FormulaHandler) GetVersion(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, err)
+		return
+	}
+	version, err := strconv.Atoi(mux.Vars(r)["version"])
+	if err != nil || version <= 0 {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, errors.New("invalid version"))
+		return
+	}
+	_, v, err := h.Repo.FindVersion(uint(id), version)
+	if err != nil {
+		if errors.Is(err, repository.ErrFormulaNotFound) || errors.Is(err, repository.ErrFormulaVersionNotFound) {
+			h.HandleErr(w, http.StatusNotFound, r.URL.Path, err)
+			return
+		}
+		h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": formulaVersionToResponse(v)})
+	h.Log(http.StatusOK, r.URL.Path, start)
+}
+
+func (h *FormulaHandler) Create(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	user := h.currentUser(r)
+	if user == nil {
+		h.HandleErr(w, http.StatusUnauthorized, r.URL.Path, errors.New("unauthorized"))
+		return
+	}
+	var req api.FormulaRequestDto
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, err)
+		return
+	}
+	if strings.TrimSpace(req.Name) == "" {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, errors.New("name required"))
+		return
+	}
+	body, err := formulaBody(req.Body)
+	if err != nil {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, err)
+		return
+	}
+
+	f := &models.Formula{
+		Name:        strings.TrimSpace(req.Name),
+		Description: req.Description,
+		Author:      user.Email,
+	}
+	f, err = h.Repo.Create(f, body, strings.TrimSpace(req.Notes))
+	if err != nil {
+		h.handleSaveErr(w, r, err)
+		return
+	}
+	if h.Dispatcher != nil {
+		if err := h.Dispatcher.EnqueueAudit("formula_created", "formula", f.ID, user.Email, f.Name+" v1"); err != nil {
+			h.ReportAsyncError(r.URL.Path, err)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": formulaToResponse(f, true)})
+	h.Log(http.StatusCreated, r.URL.Path, start)
+}
+
+// Edit cambia los datos de la fórmula. Un cuerpo nuevo se publica como otra
+// versión; las transmutaciones existentes siguen apuntando a la suya.
+func (h *FormulaHandler) Edit(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, err)
+		return
+	}
+	user := h.currentUser(r)
+	if user == nil {
+		h.HandleErr(w, http.StatusUnauthorized, r.URL.Path, errors.New("unauthorized"))
+		return
+	}
+	f, err := h.Repo.FindById(id)
+	if err != nil {
+		h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
+		return
+	}
+	if f == nil {
+		h.HandleErr(w, http.StatusNotFound, r.URL.Path, repository.ErrFormulaNotFound)
+		return
+	}
+	if user.Role != "supervisor" && f.Author != user.Email {
+		h.HandleErr(w, http.StatusForbidden, r.URL.Path, errors.New("only the author or a supervisor can edit this formula"))
+		return
+	}
+
+	var req api.FormulaEditRequestDto
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, err)
+		return
+	}
+	changes := repository.FormulaChanges{
+		Description: req.Description,
+		Deprecated:  req.Deprecated,
+		Author:      user.Email,
+		Notes:       strings.TrimSpace(req.Notes),
+	}
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" {
+			h.HandleErr(w, http.StatusBadRequest, r.URL.Path, errors.New("name required"))
+			return
+		}
+		changes.Name = &name
+	}
+	if req.Body != nil {
+		normalized, err := formulaBody(*req.Body)
+		if err != nil {
+			h.HandleErr(w, http.StatusBadRequest, r.URL.Path, err)
+			return
+		}
+		changes.Body = &normalized
+	}
+	if req.DeprecationReason != nil {
+		reason := strings.TrimSpace(*req.DeprecationReason)
+		changes.DeprecationReason = &reason
+	}
+
+	f, previous, err := h.Repo.Update(f.ID, changes)
+	if err != nil {
+		h.handleSaveErr(w, r, err)
+		return
+	}
+	wasDeprecated := previous.Deprecated
+	if h.Dispatcher != nil {
+		action := "formula_updated"
+		details := fmt.Sprintf("%s v%d", f.Name, f.LatestVersion)
+		switch {
+		case f.LatestVersion != previous.LatestVersion:
+			action = "formula_versioned"
+		case f.Deprecated && !wasDeprecated:
+			action = "formula_deprecated"
+			if f.DeprecationReason != "" {
+				details += ": " + f.DeprecationReason
+			}
+		case !f.Deprecated && wasDeprecated:
+			action = "formula_restored"
+		}
+		if err := h.Dispatcher.EnqueueAudit(action, "formula", f.ID, user.Email, details); err != nil {
+			h.ReportAsyncError(r.URL.Path, err)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": formulaToResponse(f, true)})
+	h.Log(http.StatusAccepted, r.URL.Path, start)
+}
+
+func (h *FormulaHandler) handleSaveErr(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, repository.ErrFormulaNameTaken):
+		h.HandleErr(w, http.StatusConflict, r.URL.Path, err)
+	case errors.Is(err, repository.ErrFormulaNotFound):
+		h.HandleErr(w, http.StatusNotFound, r.URL.Path, err)
+	default:
+		h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
+	}
+}
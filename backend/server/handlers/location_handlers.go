@@ -0,0 +1,360 @@
+package handlers
+
+import (
+	"backend-avanzada/alchemy"
+	"backend-avanzada/api"
+	"backend-avanzada/models"
+	"backend-avanzada/repository"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+type LocationHandler struct {
+	Repo             *repository.LocationRepository
+	Engine           *alchemy.Engine
+	Dispatcher       AsyncDispatcher
+	CurrentUser      func(*http.Request) *api.AuthenticatedUser
+	ReportAsyncError func(string, error)
+	HandleErr        func(http.ResponseWriter, int, string, error)
+	Log              func(int, string, time.Time)
+}
+
+func NewLocationHandler(
+	repo *repository.LocationRepository,
+	engine *alchemy.Engine,
+	dispatcher AsyncDispatcher,
+	currentUser func(*http.Request) *api.AuthenticatedUser,
+	reportAsyncError func(string, error),
+	handleErr func(http.ResponseWriter, int, string, error),
+	log func(int, string, time.Time),
+) *LocationHandler {
+	return &LocationHandler{
+		Repo:             repo,
+		Engine:           engine,
+		Dispatcher:       dispatcher,
+		CurrentUser:      currentUser,
+		ReportAsyncError: reportAsyncError,
+		HandleErr:        handleErr,
+		Log:              log,
+	}
+}
+
+func (h *LocationHandler) userEmail(r *http.Request) string {
+	if h.CurrentUser != nil {
+		if user := h.CurrentUser(r); user != nil {
+			return user.Email
+		}
+	}
+	return ""
+}
+
+func locationToResponse(l *models.Location) *api.LocationResponseDto {
+	return &api.LocationResponseDto{
+		ID:          l.ID,
+		Name:        l.Name,
+		Description: l.Description,
+		IsDefault:   l.IsDefault,
+		CreatedAt:   l.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+// materialStockToResponse construye el DTO de s. Available no descuenta los
+// lotes caducados: es la existencia libre de reservas en la ubicación.
+func materialStockToResponse(s *models.MaterialStock) api.MaterialStockDto {
+	resp := api.MaterialStockDto{
+		MaterialID: s.MaterialID,
+		LocationID: s.LocationID,
+		Quantity:   s.Quantity,
+		Reserved:   s.Reserved,
+		Available:  s.Quantity - s.Reserved,
+	}
+	if s.Material != nil {
+		resp.Material = s.Material.Name
+		resp.Unit = s.Material.Unit
+	}
+	if s.Location != nil {
+		resp.Location = s.Location.Name
+	}
+	return resp
+}
+
+func stockTransferToResponse(t *models.StockTransfer) *api.StockTransferResponseDto {
+	resp := &api.StockTransferResponseDto{
+		ID:             t.ID,
+		MaterialID:     t.MaterialID,
+		FromLocationID: t.FromLocationID,
+		ToLocationID:   t.ToLocationID,
+		LotID:          t.LotID,
+		Quantity:       t.Quantity,
+		Actor:          t.Actor,
+		Reason:         t.Reason,
+		CreatedAt:      t.CreatedAt.Format(time.RFC3339),
+	}
+	if t.Material != nil {
+		resp.Material = t.Material.Name
+	}
+	if t.FromLocation != nil {
+		resp.FromLocation = t.FromLocation.Name
+	}
+	if t.ToLocation != nil {
+		resp.ToLocation = t.ToLocation.Name
+	}
+	return resp
+}
+
+// find resuelve la ubicación del path; escribe el error y devuelve nil si no existe.
+func (h *LocationHandler) find(w http.ResponseWriter, r *http.Request) *models.Location {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, err)
+		return nil
+	}
+	l, err := h.Repo.FindById(id)
+	if err != nil {
+		h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
+		return nil
+	}
+	if l == nil {
+		h.HandleErr(w, http.StatusNotFound, r.URL.Path, errors.New("location not found"))
+		return nil
+	}
+	return l
+}
+
+func (h *LocationHandler) audit(r *http.Request, action, entity string, id uint, details string) {
+	if h.Dispatcher == nil {
+		return
+	}
+	if err := h.Dispatcher.EnqueueAudit(action, entity, id, h.userEmail(r), details); err != nil {
+		h.ReportAsyncError(r.URL.Path, err)
+	}
+}
+
+func (h *LocationHandler) GetAll(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	locations, err := h.Repo.FindAll()
+	if err != nil {
+		h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
+		return
+	}
+	resp := make([]*api.LocationResponseDto, 0, len(locations))
+	for _, l := range locations {
+		resp = append(resp, locationToResponse(l))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": resp})
+	h.Log(http.StatusOK, r.URL.Path, start)
+}
+
+func (h *LocationHandler) GetByID(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	l := h.find(w, r)
+	if l == nil {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": locationToResponse(l)})
+	h.Log(http.StatusOK, r.URL.Path, start)
+}
+
+func (h *LocationHandler) Create(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	var req api.LocationRequestDto
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, err)
+		return
+	}
+	l := &models.Location{
+		Name:        strings.TrimSpace(req.Name),
+		Description: req.Description,
+		IsDefault:   req.IsDefault,
+	}
+	if l.Name == "" {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, errors.New("name required"))
+		return
+	}
+	l, err := h.Repo.Save(l)
+	if err != nil {
+		h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
+		return
+	}
+	h.audit(r, "location_created", "location", l.ID, "Location created")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": locationToResponse(l)})
+	h.Log(http.StatusCreated, r.URL.Path, start)
+}
+
+func (h *LocationHandler) Edit(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	l := h.find(w, r)
+	if l == nil {
+		return
+	}
+	var req api.LocationEditRequestDto
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, err)
+		return
+	}
+	if req.Name != nil {
+		l.Name = strings.TrimSpace(*req.Name)
+		if l.Name == "" {
+			h.HandleErr(w, http.StatusBadRequest, r.URL.Path, errors.New("name required"))
+			return
+		}
+	}
+	if req.Description != nil {
+		l.Description = *req.Description
+	}
+	if req.IsDefault != nil {
+		if !*req.IsDefault && l.IsDefault {
+			h.HandleErr(w, http.StatusConflict, r.URL.Path, errors.New("mark another location as default instead"))
+			return
+		}
+		l.IsDefault = *req.IsDefault
+	}
+	l, err := h.Repo.Save(l)
+	if err != nil {
+		h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
+		return
+	}
+	h.audit(r, "location_updated", "location", l.ID, "Location updated")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": locationToResponse(l)})
+	h.Log(http.StatusAccepted, r.URL.Path, start)
+}
+
+func (h *LocationHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	l := h.find(w, r)
+	if l == nil {
+		return
+	}
+	if err := h.Repo.Delete(l); err != nil {
+		if errors.Is(err, repository.ErrLocationInUse) || errors.Is(err, repository.ErrDefaultLocation) {
+			h.HandleErr(w, http.StatusConflict, r.URL.Path, err)
+			return
+		}
+		h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
+		return
+	}
+	h.audit(r, "location_deleted", "location", l.ID, "Location deleted")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Stock devuelve lo que guarda la ubicación, material a material.
+func (h *LocationHandler) Stock(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	l := h.find(w, r)
+	if l == nil {
+		return
+	}
+	stocks, err := h.Repo.Stock(l.ID)
+	if err != nil {
+		h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
+		return
+	}
+	resp := make([]api.MaterialStockDto, 0, len(stocks))
+	for _, s := range stocks {
+		s.Location = l
+		resp = append(resp, materialStockToResponse(s))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": resp})
+	h.Log(http.StatusOK, r.URL.Path, start)
+}
+
+// Transfers lista los traslados; ?material_id=N filtra por material.
+func (h *LocationHandler) Transfers(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	var materialID uint
+	if raw := r.URL.Query().Get("material_id"); raw != "" {
+		id, err := strconv.Atoi(raw)
+		if err != nil || id <= 0 {
+			h.HandleErr(w, http.StatusBadRequest, r.URL.Path, errors.New("invalid material_id"))
+			return
+		}
+		materialID = uint(id)
+	}
+	transfers, err := h.Repo.Transfers(materialID)
+	if err != nil {
+		h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
+		return
+	}
+	resp := make([]*api.StockTransferResponseDto, 0, len(transfers))
+	for _, t := range transfers {
+		resp = append(resp, stockTransferToResponse(t))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": resp})
+	h.Log(http.StatusOK, r.URL.Path, start)
+}
+
+// Transfer traslada existencias de un material entre dos ubicaciones.
+func (h *LocationHandler) Transfer(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	var req api.StockTransferRequestDto
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, err)
+		return
+	}
+	if req.MaterialID == 0 || req.FromLocationID == 0 || req.ToLocationID == 0 {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, errors.New("material_id, from_location_id and to_location_id required"))
+		return
+	}
+	if req.Quantity <= 0 {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, errors.New("quantity must be greater than zero"))
+		return
+	}
+	quantity := req.Quantity
+	if h.Engine != nil {
+		var err error
+		quantity, _, err = h.Engine.ToBaseUnit(req.MaterialID, req.Quantity, req.QuantityUnit)
+		if errors.Is(err, repository.ErrMaterialNotFound) {
+			h.HandleErr(w, http.StatusBadRequest, r.URL.Path, err)
+			return
+		}
+		if err != nil {
+			h.HandleErr(w, unitErrorStatus(err), r.URL.Path, err)
+			return
+		}
+	}
+	transfer, err := h.Repo.Transfer(&models.StockTransfer{
+		MaterialID:     req.MaterialID,
+		FromLocationID: req.FromLocationID,
+		ToLocationID:   req.ToLocationID,
+		LotID:          req.LotID,
+		Quantity:       quantity,
+		Actor:          h.userEmail(r),
+		Reason:         strings.TrimSpace(req.Reason),
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrMaterialNotFound),
+			errors.Is(err, repository.ErrLocationNotFound),
+			errors.Is(err, repository.ErrLotNotFound),
+			errors.Is(err, repository.ErrSameLocation),
+			errors.Is(err, repository.ErrLotNotAtLocation):
+			h.HandleErr(w, http.StatusBadRequest, r.URL.Path, err)
+		case errors.Is(err, repository.ErrInsufficientMaterial):
+			h.HandleErr(w, http.StatusConflict, r.URL.Path, errors.New("insufficient material quantity at the source location"))
+		default:
+			h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
+		}
+		return
+	}
+	details := fmt.Sprintf("%s: %s from %s to %s", transfer.Material.Name,
+		strconv.FormatFloat(transfer.Quantity, 'f', -1, 64), transfer.FromLocation.Name, transfer.ToLocation.Name)
+	h.audit(r, "stock_transferred", "material", transfer.MaterialID, details)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": stockTransferToResponse(transfer)})
+	h.Log(http.StatusCreated, r.URL.Path, start)
+}
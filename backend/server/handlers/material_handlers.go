@@ -4,10 +4,14 @@ import (
 	"backend-avanzada/api"
 	"backend-avanzada/models"
 	"backend-avanzada/repository"
+	"backend-avanzada/units"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"math"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
@@ -49,6 +53,56 @@ func (h *MaterialHandler) userEmail(r *http.Request) string {
 	return ""
 }
 
+// materialToResponse construye el DTO de m; expired es lo que tiene en lotes
+// caducados, que no cuenta como disponible.
+func materialToResponse(m *models.Material, expired float64) *api.MaterialResponseDto {
+	return &api.MaterialResponseDto{
+		ID:              int(m.ID),
+		Name:            m.Name,
+		Category:        m.Category,
+		Quantity:        m.Quantity,
+		EnergyValue:     m.EnergyValue,
+		Unit:            m.Unit,
+		Density:         m.Density,
+		OnHand:          m.Quantity,
+		Reserved:        m.Reserved,
+		Available:       math.Max(0, m.Quantity-m.Reserved-expired),
+		CreatedAt:       m.CreatedAt.Format(time.RFC3339),
+		ReorderLevel:    m.ReorderLevel,
+		ReorderQuantity: m.ReorderQuantity,
+	}
+}
+
+// materialResponse es materialToResponse con lo caducado de m consultado al repositorio.
+func (h *MaterialHandler) materialResponse(m *models.Material) (*api.MaterialResponseDto, error) {
+	expired, err := h.Repo.ExpiredLotStock(time.Now(), m.ID)
+	if err != nil {
+		return nil, err
+	}
+	return materialToResponse(m, expired[m.ID]), nil
+}
+
+// unitErrorStatus distingue una unidad desconocida (400) de una cantidad que
+// no puede expresarse en la unidad base del material (422).
+func unitErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, units.ErrUnknownUnit):
+		return http.StatusBadRequest
+	case errors.Is(err, units.ErrIncompatibleUnit), errors.Is(err, units.ErrNoBaseUnit):
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// materialQuantity expresa quantity, medida en unit, en la unidad base de m.
+func materialQuantity(m *models.Material, quantity float64, unit string) (float64, error) {
+	if units.Normalize(unit) == "" {
+		return quantity, nil
+	}
+	return units.Convert(quantity, unit, m.Unit, m.Density)
+}
+
 func (h *MaterialHandler) GetAll(w http.ResponseWriter, r *http.Request) {
 	start := time.Now()
 	materials, err := h.Repo.FindAll()
@@ -56,15 +110,14 @@ func (h *MaterialHandler) GetAll(w http.ResponseWriter, r *http.Request) {
 		h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
 		return
 	}
+	expired, err := h.Repo.ExpiredLotStock(time.Now())
+	if err != nil {
+		h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
+		return
+	}
 	resp := make([]*api.MaterialResponseDto, 0, len(materials))
 	for _, m := range materials {
-		resp = append(resp, &api.MaterialResponseDto{
-			ID:        int(m.ID),
-			Name:      m.Name,
-			Category:  m.Category,
-			Quantity:  m.Quantity,
-			CreatedAt: m.CreatedAt.Format(time.RFC3339),
-		})
+		resp = append(resp, materialToResponse(m, expired[m.ID]))
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{"data": resp})
@@ -87,12 +140,10 @@ func (h *MaterialHandler) GetByID(w http.ResponseWriter, r *http.Request) {
 		h.HandleErr(w, http.StatusNotFound, r.URL.Path, errors.New("material not found"))
 		return
 	}
-	resp := &api.MaterialResponseDto{
-		ID:        int(m.ID),
-		Name:      m.Name,
-		Category:  m.Category,
-		Quantity:  m.Quantity,
-		CreatedAt: m.CreatedAt.Format(time.RFC3339),
+	resp, err := h.materialResponse(m)
+	if err != nil {
+		h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
+		return
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{"data": resp})
@@ -114,14 +165,49 @@ func (h *MaterialHandler) Create(w http.ResponseWriter, r *http.Request) {
 		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, errors.New("quantity must be positive"))
 		return
 	}
+	if req.EnergyValue < 0 {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, errors.New("energy value must be positive"))
+		return
+	}
+	if req.Density < 0 {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, errors.New("density must be positive"))
+		return
+	}
+	if req.ReorderLevel < 0 || req.ReorderQuantity < 0 {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, errors.New("reorder level and quantity must be positive"))
+		return
+	}
 	m := &models.Material{
-		Name:     req.Name,
-		Category: req.Category,
-		Quantity: req.Quantity,
+		Name:            req.Name,
+		Category:        req.Category,
+		EnergyValue:     req.EnergyValue,
+		Unit:            units.Normalize(req.Unit),
+		Density:         req.Density,
+		ReorderLevel:    req.ReorderLevel,
+		ReorderQuantity: req.ReorderQuantity,
 	}
-	m, err := h.Repo.Save(m)
+	if m.Unit != "" {
+		if _, err := units.Lookup(m.Unit); err != nil {
+			h.HandleErr(w, http.StatusBadRequest, r.URL.Path, err)
+			return
+		}
+	}
+	quantity, err := materialQuantity(m, req.Quantity, req.QuantityUnit)
 	if err != nil {
-		h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
+		h.HandleErr(w, unitErrorStatus(err), r.URL.Path, err)
+		return
+	}
+	m.Quantity = quantity
+	m, err = h.Repo.Create(m, req.LocationID, h.userEmail(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrLocationNotFound):
+			h.HandleErr(w, http.StatusBadRequest, r.URL.Path, err)
+		case errors.Is(err, repository.ErrMaterialNameTaken):
+			h.HandleErr(w, http.StatusConflict, r.URL.Path, err)
+		default:
+			h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
+		}
 		return
 	}
 	if h.Dispatcher != nil {
@@ -129,13 +215,8 @@ func (h *MaterialHandler) Create(w http.ResponseWriter, r *http.Request) {
 			h.ReportAsyncError(r.URL.Path, err)
 		}
 	}
-	resp := &api.MaterialResponseDto{
-		ID:        int(m.ID),
-		Name:      m.Name,
-		Category:  m.Category,
-		Quantity:  m.Quantity,
-		CreatedAt: m.CreatedAt.Format(time.RFC3339),
-	}
+	// Un material recién creado no tiene lotes ni reservas.
+	resp := materialToResponse(m, 0)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(map[string]interface{}{"data": resp})
@@ -194,6 +275,10 @@ func (h *MaterialHandler) Edit(w http.ResponseWriter, r *http.Request) {
 		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, err)
 		return
 	}
+	if req.Quantity == nil && units.Normalize(req.QuantityUnit) != "" {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, errors.New("quantity_unit requires quantity"))
+		return
+	}
 
 	if req.Name != nil {
 		m.Name = *req.Name
@@ -201,17 +286,75 @@ func (h *MaterialHandler) Edit(w http.ResponseWriter, r *http.Request) {
 	if req.Category != nil {
 		m.Category = *req.Category
 	}
+	if req.Quantity != nil && *req.Quantity < 0 {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, errors.New("quantity must be positive"))
+		return
+	}
+	if req.EnergyValue != nil {
+		if *req.EnergyValue < 0 {
+			h.HandleErr(w, http.StatusBadRequest, r.URL.Path, errors.New("energy value must be positive"))
+			return
+		}
+		m.EnergyValue = *req.EnergyValue
+	}
+	if req.Unit != nil {
+		unit := units.Normalize(*req.Unit)
+		if _, err := units.Lookup(unit); err != nil {
+			h.HandleErr(w, http.StatusBadRequest, r.URL.Path, err)
+			return
+		}
+		// Las existencias, reservas y recetas ya están en la unidad declarada,
+		// así que solo los materiales sin unidad pueden declararla.
+		if m.Unit != "" && m.Unit != unit {
+			h.HandleErr(w, http.StatusConflict, r.URL.Path, errors.New("the unit of a material cannot be changed once declared"))
+			return
+		}
+		m.Unit = unit
+	}
+	if req.Density != nil {
+		if *req.Density < 0 {
+			h.HandleErr(w, http.StatusBadRequest, r.URL.Path, errors.New("density must be positive"))
+			return
+		}
+		m.Density = *req.Density
+	}
+	if req.ReorderLevel != nil {
+		if *req.ReorderLevel < 0 {
+			h.HandleErr(w, http.StatusBadRequest, r.URL.Path, errors.New("reorder level must be positive"))
+			return
+		}
+		m.ReorderLevel = *req.ReorderLevel
+	}
+	if req.ReorderQuantity != nil {
+		if *req.ReorderQuantity < 0 {
+			h.HandleErr(w, http.StatusBadRequest, r.URL.Path, errors.New("reorder quantity must be positive"))
+			return
+		}
+		m.ReorderQuantity = *req.ReorderQuantity
+	}
 	if req.Quantity != nil {
-		if *req.Quantity < 0 {
-			h.HandleErr(w, http.StatusBadRequest, r.URL.Path, errors.New("quantity must be positive"))
+		quantity, err := materialQuantity(m, *req.Quantity, req.QuantityUnit)
+		if err != nil {
+			h.HandleErr(w, unitErrorStatus(err), r.URL.Path, err)
 			return
 		}
-		m.Quantity = *req.Quantity
+		req.Quantity = &quantity
 	}
 
-	m, err = h.Repo.Save(m)
+	// La cantidad no se sobrescribe sin más: el repositorio anota la diferencia como ajuste.
+	m, err = h.Repo.Update(m, req.Quantity, req.LocationID, h.userEmail(r), strings.TrimSpace(req.Reason))
 	if err != nil {
-		h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
+		switch {
+		case errors.Is(err, repository.ErrMaterialNotFound):
+			h.HandleErr(w, http.StatusNotFound, r.URL.Path, err)
+		case errors.Is(err, repository.ErrLocationNotFound):
+			h.HandleErr(w, http.StatusBadRequest, r.URL.Path, err)
+		case errors.Is(err, repository.ErrBelowLotStock), errors.Is(err, repository.ErrBelowReserved), errors.Is(err, repository.ErrBelowLocationStock),
+			errors.Is(err, repository.ErrMaterialNameTaken):
+			h.HandleErr(w, http.StatusConflict, r.URL.Path, err)
+		default:
+			h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
+		}
 		return
 	}
 	if h.Dispatcher != nil {
@@ -220,13 +363,300 @@ func (h *MaterialHandler) Edit(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	resp := &api.MaterialResponseDto{
-		ID:        int(m.ID),
-		Name:      m.Name,
-		Category:  m.Category,
-		Quantity:  m.Quantity,
-		CreatedAt: m.CreatedAt.Format(time.RFC3339),
+	resp, err := h.materialResponse(m)
+	if err != nil {
+		h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": resp})
+	h.Log(http.StatusAccepted, r.URL.Path, start)
+}
+
+// Movements devuelve el libro de movimientos del material con el saldo tras
+// cada apunte y si la existencia actual cuadra con él.
+func (h *MaterialHandler) Movements(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, err)
+		return
+	}
+	m, err := h.Repo.FindById(id)
+	if err != nil {
+		h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
+		return
+	}
+	if m == nil {
+		h.HandleErr(w, http.StatusNotFound, r.URL.Path, errors.New("material not found"))
+		return
+	}
+	movements, err := h.Repo.Movements(m.ID)
+	if err != nil {
+		h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
+		return
+	}
+	rec, err := h.Repo.Reconcile(m)
+	if err != nil {
+		h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
+		return
+	}
+	resp := &api.MaterialMovementsDto{
+		MaterialID:     m.ID,
+		Material:       m.Name,
+		Quantity:       m.Quantity,
+		Unit:           m.Unit,
+		LedgerQuantity: rec.Ledger,
+		Discrepancy:    rec.Discrepancy(),
+		Reconciled:     rec.Reconciled(),
+		Movements:      make([]api.StockMovementDto, 0, len(movements)),
+	}
+	balance := 0.0
+	for _, mv := range movements {
+		balance += mv.Quantity
+		resp.Movements = append(resp.Movements, api.StockMovementDto{
+			ID:              mv.ID,
+			Kind:            mv.Kind,
+			Quantity:        mv.Quantity,
+			Balance:         balance,
+			TransmutationID: mv.TransmutationID,
+			LocationID:      mv.LocationID,
+			Actor:           mv.Actor,
+			Reason:          mv.Reason,
+			CreatedAt:       mv.CreatedAt.Format(time.RFC3339),
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": resp})
+	h.Log(http.StatusOK, r.URL.Path, start)
+}
+
+// Stock devuelve la existencia del material en cada ubicación.
+func (h *MaterialHandler) Stock(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, err)
+		return
+	}
+	m, err := h.Repo.FindById(id)
+	if err != nil {
+		h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
+		return
+	}
+	if m == nil {
+		h.HandleErr(w, http.StatusNotFound, r.URL.Path, errors.New("material not found"))
+		return
+	}
+	stocks, err := h.Repo.Stock(m.ID)
+	if err != nil {
+		h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
+		return
+	}
+	resp := make([]api.MaterialStockDto, 0, len(stocks))
+	for _, s := range stocks {
+		s.Material = m
+		resp = append(resp, materialStockToResponse(s))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": resp})
+	h.Log(http.StatusOK, r.URL.Path, start)
+}
+
+// Units devuelve la tabla de conversión de unidades.
+func (h *MaterialHandler) Units(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	all := units.All()
+	resp := make([]api.UnitDto, 0, len(all))
+	for _, u := range all {
+		resp = append(resp, api.UnitDto{Symbol: u.Symbol, Dimension: string(u.Dimension), Factor: u.Factor})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": resp})
+	h.Log(http.StatusOK, r.URL.Path, start)
+}
+
+func materialLotToResponse(l *models.MaterialLot, at time.Time) api.MaterialLotResponseDto {
+	resp := api.MaterialLotResponseDto{
+		ID:         l.ID,
+		MaterialID: l.MaterialID,
+		LotNumber:  l.LotNumber,
+		ReceivedAt: l.ReceivedAt.Format(time.RFC3339),
+		Quantity:   l.Quantity,
+		LocationID: l.LocationID,
+		Expired:    l.Expired(at),
+		CreatedAt:  l.CreatedAt.Format(time.RFC3339),
+	}
+	if l.ExpiresAt != nil {
+		resp.ExpiresAt = l.ExpiresAt.Format(time.RFC3339)
+	}
+	return resp
+}
+
+// Lots devuelve los lotes del material en orden de consumo (FEFO).
+func (h *MaterialHandler) Lots(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, err)
+		return
+	}
+	m, err := h.Repo.FindById(id)
+	if err != nil {
+		h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
+		return
+	}
+	if m == nil {
+		h.HandleErr(w, http.StatusNotFound, r.URL.Path, errors.New("material not found"))
+		return
+	}
+	lots, err := h.Repo.Lots(m.ID)
+	if err != nil {
+		h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
+		return
+	}
+	now := time.Now()
+	resp := make([]api.MaterialLotResponseDto, 0, len(lots))
+	for _, l := range lots {
+		resp = append(resp, materialLotToResponse(l, now))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": resp})
+	h.Log(http.StatusOK, r.URL.Path, start)
+}
+
+// ReceiveLot registra la entrada de un lote del material.
+func (h *MaterialHandler) ReceiveLot(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, err)
+		return
+	}
+	m, err := h.Repo.FindById(id)
+	if err != nil {
+		h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
+		return
+	}
+	if m == nil {
+		h.HandleErr(w, http.StatusNotFound, r.URL.Path, errors.New("material not found"))
+		return
+	}
+	var req api.MaterialLotRequestDto
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, err)
+		return
+	}
+	lot := &models.MaterialLot{
+		MaterialID: m.ID,
+		LotNumber:  strings.TrimSpace(req.LotNumber),
+		ReceivedAt: start.UTC(),
+	}
+	if lot.LotNumber == "" {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, errors.New("lot_number required"))
+		return
+	}
+	if req.Quantity <= 0 {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, errors.New("quantity must be greater than zero"))
+		return
+	}
+	if req.ReceivedAt != nil {
+		lot.ReceivedAt = req.ReceivedAt.UTC()
+	}
+	if req.ExpiresAt != nil {
+		if !req.ExpiresAt.After(lot.ReceivedAt) {
+			h.HandleErr(w, http.StatusBadRequest, r.URL.Path, errors.New("expires_at must be after received_at"))
+			return
+		}
+		expiresAt := req.ExpiresAt.UTC()
+		lot.ExpiresAt = &expiresAt
+	}
+	lot.Quantity, err = materialQuantity(m, req.Quantity, req.QuantityUnit)
+	if err != nil {
+		h.HandleErr(w, unitErrorStatus(err), r.URL.Path, err)
+		return
+	}
+	lot.LocationID = req.LocationID
+	lot, err = h.Repo.ReceiveLot(lot, h.userEmail(r))
+	if err != nil {
+		if errors.Is(err, repository.ErrMaterialNotFound) {
+			h.HandleErr(w, http.StatusNotFound, r.URL.Path, err)
+			return
+		}
+		if errors.Is(err, repository.ErrLocationNotFound) {
+			h.HandleErr(w, http.StatusBadRequest, r.URL.Path, err)
+			return
+		}
+		h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
+		return
+	}
+	if h.Dispatcher != nil {
+		details := fmt.Sprintf("lot %s of %s: %s", lot.LotNumber, m.Name, strconv.FormatFloat(lot.Quantity, 'f', -1, 64))
+		if err := h.Dispatcher.EnqueueAudit("material_lot_received", "material", m.ID, h.userEmail(r), details); err != nil {
+			h.ReportAsyncError(r.URL.Path, err)
+		}
+	}
+	resp := materialLotToResponse(lot, time.Now())
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": resp})
+	h.Log(http.StatusCreated, r.URL.Path, start)
+}
+
+// AdjustLot corrige la cantidad de un lote; con 0 se retira, p. ej. al caducar.
+func (h *MaterialHandler) AdjustLot(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, err)
+		return
+	}
+	lotID, err := strconv.Atoi(mux.Vars(r)["lotId"])
+	if err != nil {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, err)
+		return
+	}
+	m, err := h.Repo.FindById(id)
+	if err != nil {
+		h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
+		return
+	}
+	if m == nil {
+		h.HandleErr(w, http.StatusNotFound, r.URL.Path, errors.New("material not found"))
+		return
+	}
+	var req api.MaterialLotEditRequestDto
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, err)
+		return
+	}
+	if req.Quantity < 0 {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, errors.New("quantity must be positive"))
+		return
+	}
+	quantity, err := materialQuantity(m, req.Quantity, req.QuantityUnit)
+	if err != nil {
+		h.HandleErr(w, unitErrorStatus(err), r.URL.Path, err)
+		return
+	}
+	lot, err := h.Repo.AdjustLot(m.ID, uint(lotID), quantity, h.userEmail(r), strings.TrimSpace(req.Reason))
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrMaterialNotFound), errors.Is(err, repository.ErrLotNotFound):
+			h.HandleErr(w, http.StatusNotFound, r.URL.Path, err)
+		default:
+			h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
+		}
+		return
+	}
+	if h.Dispatcher != nil {
+		details := fmt.Sprintf("lot %s of %s set to %s", lot.LotNumber, m.Name, strconv.FormatFloat(lot.Quantity, 'f', -1, 64))
+		if err := h.Dispatcher.EnqueueAudit("material_lot_adjusted", "material", m.ID, h.userEmail(r), details); err != nil {
+			h.ReportAsyncError(r.URL.Path, err)
+		}
 	}
+	resp := materialLotToResponse(lot, time.Now())
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusAccepted)
 	json.NewEncoder(w).Encode(map[string]interface{}{"data": resp})
@@ -0,0 +1,351 @@
+package handlers
+
+import (
+	"backend-avanzada/alchemy"
+	"backend-avanzada/api"
+	"backend-avanzada/models"
+	"backend-avanzada/repository"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// maxPipelineSteps limita el tamaño de un pipeline.
+const maxPipelineSteps = 50
+
+type PipelineHandler struct {
+	Repo             *repository.PipelineRepository
+	Engine           *alchemy.Engine
+	Dispatcher       AsyncDispatcher
+	CurrentUser      func(*http.Request) *api.AuthenticatedUser
+	ReportAsyncError func(string, error)
+	Broadcast        func(string, interface{})
+	HandleErr        func(http.ResponseWriter, int, string, error)
+	Log              func(int, string, time.Time)
+}
+
+func NewPipelineHandler(
+	repo *repository.PipelineRepository,
+	engine *alchemy.Engine,
+	dispatcher AsyncDispatcher,
+	currentUser func(*http.Request) *api.AuthenticatedUser,
+	reportAsyncError func(string, error),
+	broadcast func(string, interface{}),
+	handleErr func(http.ResponseWriter, int, string, error),
+	log func(int, string, time.Time),
+) *PipelineHandler {
+	return &PipelineHandler{
+		Repo:             repo,
+		Engine:           engine,
+		Dispatcher:       dispatcher,
+		CurrentUser:      currentUser,
+		ReportAsyncError: reportAsyncError,
+		Broadcast:        broadcast,
+		HandleErr:        handleErr,
+		Log:              log,
+	}
+}
+
+func (h *PipelineHandler) currentUser(r *http.Request) *api.AuthenticatedUser {
+	if h.CurrentUser != nil {
+		return h.CurrentUser(r)
+	}
+	return nil
+}
+
+// PipelineToResponse construye el DTO público de un pipeline.
+func PipelineToResponse(p *models.Pipeline) *api.PipelineResponseDto {
+	resp := &api.PipelineResponseDto{
+		ID:        p.ID,
+		Name:      p.Name,
+		UserID:    p.UserID,
+		Status:    p.Status,
+		Steps:     []api.PipelineStepResponseDto{},
+		CreatedAt: p.CreatedAt.Format(time.RFC3339),
+		UpdatedAt: p.UpdatedAt.Format(time.RFC3339),
+	}
+	for _, step := range p.Steps {
+		dependsOn := step.DependsOn
+		if dependsOn == nil {
+			dependsOn = []string{}
+		}
+		resp.Steps = append(resp.Steps, api.PipelineStepResponseDto{
+			Key:             step.Key,
+			DependsOn:       dependsOn,
+			MaterialID:      step.MaterialID,
+			RecipeID:        step.RecipeID,
+			Formula:         step.Formula,
+			FormulaID:       step.FormulaID,
+			FormulaVersion:  step.FormulaVersion,
+			Quantity:        step.Quantity,
+			Unit:            step.Unit,
+			Status:          step.Status,
+			TransmutationID: step.TransmutationID,
+			Error:           step.Error,
+		})
+	}
+	return resp
+}
+
+// sortPipelineSteps valida claves y dependencias y devuelve los pasos en orden
+// topológico, respetando el orden de la petición entre pasos independientes.
+func sortPipelineSteps(steps []api.PipelineStepRequestDto) ([]api.PipelineStepRequestDto, error) {
+	index := map[string]int{}
+	for i, step := range steps {
+		key := strings.TrimSpace(step.Key)
+		if key == "" {
+			return nil, fmt.Errorf("step %d: key is required", i)
+		}
+		if _, dup := index[key]; dup {
+			return nil, fmt.Errorf("duplicate step key %q", key)
+		}
+		index[key] = i
+		steps[i].Key = key
+	}
+	pending := make([]int, len(steps))
+	children := make([][]int, len(steps))
+	for i, step := range steps {
+		seen := map[string]bool{}
+		for j, dep := range step.DependsOn {
+			dep = strings.TrimSpace(dep)
+			steps[i].DependsOn[j] = dep
+			parent, ok := index[dep]
+			if !ok {
+				return nil, fmt.Errorf("step %q depends on unknown step %q", step.Key, dep)
+			}
+			if parent == i {
+				return nil, fmt.Errorf("step %q depends on itself", step.Key)
+			}
+			if seen[dep] {
+				continue
+			}
+			seen[dep] = true
+			pending[i]++
+			children[parent] = append(children[parent], i)
+		}
+	}
+
+	sorted := make([]api.PipelineStepRequestDto, 0, len(steps))
+	done := make([]bool, len(steps))
+	for len(sorted) < len(steps) {
+		progressed := false
+		for i := range steps {
+			if done[i] || pending[i] > 0 {
+				continue
+			}
+			done[i] = true
+			progressed = true
+			sorted = append(sorted, steps[i])
+			for _, child := range children[i] {
+				pending[child]--
+			}
+		}
+		if !progressed {
+			return nil, errors.New("pipeline steps contain a dependency cycle")
+		}
+	}
+	return sorted, nil
+}
+
+// stepRuleHits guarda las reglas que coincidieron con un paso para auditarlas
+// una vez creado el pipeline.
+type stepRuleHits struct {
+	key  string
+	hits []models.RuleHit
+}
+
+// publish encola las transmutaciones lanzadas y emite el estado del pipeline.
+func (h *PipelineHandler) publish(r *http.Request, p *models.Pipeline, created []*models.Transmutation, email string) {
+	for _, t := range created {
+		awaiting := t.Status == models.TransmutationStatusAwaitingApproval
+		if h.Dispatcher != nil && !awaiting {
+			if err := h.Dispatcher.EnqueueTransmutationProcessing(t.ID, email); err != nil {
+				h.ReportAsyncError(r.URL.Path, err)
+			}
+		}
+		if h.Broadcast != nil {
+			h.Broadcast("transmutation.updated", TransmutationToResponse(t))
+			if awaiting {
+				h.Broadcast("transmutation.approval_requested", TransmutationToResponse(t))
+			}
+		}
+	}
+	if h.Broadcast != nil {
+		h.Broadcast("pipeline.updated", PipelineToResponse(p))
+	}
+}
+
+func (h *PipelineHandler) GetAll(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	user := h.currentUser(r)
+	if user == nil {
+		h.HandleErr(w, http.StatusUnauthorized, r.URL.Path, errors.New("unauthorized"))
+		return
+	}
+	var (
+		pipelines []*models.Pipeline
+		err       error
+	)
+	if user.Role == "supervisor" {
+		pipelines, err = h.Repo.FindAll()
+	} else {
+		pipelines, err = h.Repo.FindAllByUser(user.ID)
+	}
+	if err != nil {
+		h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
+		return
+	}
+	resp := make([]*api.PipelineResponseDto, 0, len(pipelines))
+	for _, p := range pipelines {
+		resp = append(resp, PipelineToResponse(p))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": resp})
+	h.Log(http.StatusOK, r.URL.Path, start)
+}
+
+func (h *PipelineHandler) GetByID(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, err)
+		return
+	}
+	user := h.currentUser(r)
+	if user == nil {
+		h.HandleErr(w, http.StatusUnauthorized, r.URL.Path, errors.New("unauthorized"))
+		return
+	}
+	p, err := h.Repo.FindById(id)
+	if err != nil {
+		h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
+		return
+	}
+	if p == nil {
+		h.HandleErr(w, http.StatusNotFound, r.URL.Path, errors.New("pipeline not found"))
+		return
+	}
+	if user.Role != "supervisor" && p.UserID != user.ID {
+		h.HandleErr(w, http.StatusForbidden, r.URL.Path, errors.New("forbidden"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": PipelineToResponse(p)})
+	h.Log(http.StatusOK, r.URL.Path, start)
+}
+
+func (h *PipelineHandler) Create(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	var req api.PipelineRequestDto
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, err)
+		return
+	}
+	user := h.currentUser(r)
+	if user == nil {
+		h.HandleErr(w, http.StatusUnauthorized, r.URL.Path, errors.New("unauthorized"))
+		return
+	}
+	if strings.TrimSpace(req.Name) == "" {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, errors.New("name required"))
+		return
+	}
+	if len(req.Steps) == 0 {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, errors.New("at least one step is required"))
+		return
+	}
+	if len(req.Steps) > maxPipelineSteps {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, fmt.Errorf("a pipeline accepts at most %d steps", maxPipelineSteps))
+		return
+	}
+	steps, err := sortPipelineSteps(req.Steps)
+	if err != nil {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, err)
+		return
+	}
+
+	pipeline := &models.Pipeline{Name: strings.TrimSpace(req.Name)}
+	hits := []stepRuleHits{}
+	for _, step := range steps {
+		// Cada paso pasa la misma validación que una transmutación suelta;
+		// el stock se comprueba al lanzarlo, cuando sus dependencias ya produjeron.
+		stepReq := api.TransmutationRequestDto{
+			UserID:         req.UserID,
+			MaterialID:     step.MaterialID,
+			RecipeID:       step.RecipeID,
+			Formula:        step.Formula,
+			FormulaID:      step.FormulaID,
+			FormulaVersion: step.FormulaVersion,
+			Quantity:       step.Quantity,
+			Unit:           step.Unit,
+		}
+		t, outcome, status, err := prepareTransmutation(h.Engine, stepReq, user)
+		if err == nil {
+			if err = h.Engine.CheckExchange(outcome); err != nil {
+				status = http.StatusUnprocessableEntity
+			} else if err = h.Engine.CheckRules(outcome); err != nil {
+				if h.Dispatcher != nil {
+					entity, entityID := rejectionSubject(stepReq)
+					if auditErr := auditRuleHits(h.Dispatcher, entity, entityID, user.Email, "rejected step "+step.Key, outcome.Rules); auditErr != nil {
+						h.ReportAsyncError(r.URL.Path, auditErr)
+					}
+				}
+				status = http.StatusUnprocessableEntity
+			}
+		}
+		if err != nil {
+			h.HandleErr(w, status, r.URL.Path, fmt.Errorf("step %q: %w", step.Key, err))
+			return
+		}
+		hits = append(hits, stepRuleHits{key: step.Key, hits: outcome.Rules})
+		pipeline.UserID = t.UserID
+		pipeline.Steps = append(pipeline.Steps, models.PipelineStep{
+			Key:        step.Key,
+			DependsOn:  step.DependsOn,
+			MaterialID: t.MaterialID,
+			RecipeID:   t.RecipeID,
+			Formula:    t.Formula,
+			Quantity:   t.Quantity,
+			Unit:       t.Unit,
+			// La versión del catálogo se fija al crear el pipeline.
+			FormulaID:      t.FormulaID,
+			FormulaVersion: t.FormulaVersion,
+			// La aprobación se decide al crear el pipeline y se aplica al lanzar el paso.
+			ApprovalReason: t.ApprovalReason,
+		})
+	}
+
+	pipeline, err = h.Repo.Create(pipeline)
+	if err != nil {
+		h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
+		return
+	}
+	pipeline, created, err := h.Repo.Advance(pipeline.ID, user.Email)
+	if err != nil {
+		h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
+		return
+	}
+	if h.Dispatcher != nil {
+		details := fmt.Sprintf("%s: %d steps", pipeline.Name, len(pipeline.Steps))
+		if err := h.Dispatcher.EnqueueAudit("pipeline_created", "pipeline", pipeline.ID, user.Email, details); err != nil {
+			h.ReportAsyncError(r.URL.Path, err)
+		}
+		for _, step := range hits {
+			if err := auditRuleHits(h.Dispatcher, "pipeline", pipeline.ID, user.Email, "matched step "+step.key, step.hits); err != nil {
+				h.ReportAsyncError(r.URL.Path, err)
+			}
+		}
+	}
+	h.publish(r, pipeline, created, user.Email)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": PipelineToResponse(pipeline)})
+	h.Log(http.StatusCreated, r.URL.Path, start)
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"backend-avanzada/api"
+	"strings"
+	"testing"
+)
+
+func TestSortPipelineSteps(t *testing.T) {
+	steps := []api.PipelineStepRequestDto{
+		{Key: "c", DependsOn: []string{" b", "a "}},
+		{Key: " a"},
+		{Key: "b ", DependsOn: []string{"a", " a"}},
+	}
+	sorted, err := sortPipelineSteps(steps)
+	if err != nil {
+		t.Fatalf("sortPipelineSteps: %v", err)
+	}
+	keys := make([]string, 0, len(sorted))
+	for _, step := range sorted {
+		keys = append(keys, step.Key)
+	}
+	if got := strings.Join(keys, ","); got != "a,b,c" {
+		t.Errorf("order = %s, want a,b,c", got)
+	}
+	if deps := sorted[2].DependsOn; deps[0] != "b" || deps[1] != "a" {
+		t.Errorf("depends_on of c = %q, want trimmed keys", deps)
+	}
+}
+
+func TestSortPipelineStepsErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []api.PipelineStepRequestDto
+		want  string
+	}{
+		{name: "missing key", steps: []api.PipelineStepRequestDto{{Key: " "}}, want: "key is required"},
+		{name: "duplicate key", steps: []api.PipelineStepRequestDto{{Key: "a"}, {Key: " a"}}, want: "duplicate step key"},
+		{name: "unknown dependency", steps: []api.PipelineStepRequestDto{{Key: "a", DependsOn: []string{"z"}}}, want: "unknown step"},
+		{name: "self dependency", steps: []api.PipelineStepRequestDto{{Key: "a", DependsOn: []string{" a"}}}, want: "depends on itself"},
+		{name: "cycle", steps: []api.PipelineStepRequestDto{{Key: "a", DependsOn: []string{"b"}}, {Key: "b", DependsOn: []string{"a"}}}, want: "cycle"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := sortPipelineSteps(tt.steps); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("sortPipelineSteps error = %v, want it to mention %q", err, tt.want)
+			}
+		})
+	}
+}
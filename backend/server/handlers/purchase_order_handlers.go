@@ -0,0 +1,398 @@
+package handlers
+
+import (
+	"backend-avanzada/alchemy"
+	"backend-avanzada/api"
+	"backend-avanzada/models"
+	"backend-avanzada/repository"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+type PurchaseOrderHandler struct {
+	Repo             *repository.PurchaseOrderRepository
+	Engine           *alchemy.Engine
+	Dispatcher       AsyncDispatcher
+	CurrentUser      func(*http.Request) *api.AuthenticatedUser
+	ReportAsyncError func(string, error)
+	HandleErr        func(http.ResponseWriter, int, string, error)
+	Log              func(int, string, time.Time)
+}
+
+func NewPurchaseOrderHandler(
+	repo *repository.PurchaseOrderRepository,
+	engine *alchemy.Engine,
+	dispatcher AsyncDispatcher,
+	currentUser func(*http.Request) *api.AuthenticatedUser,
+	reportAsyncError func(string, error),
+	handleErr func(http.ResponseWriter, int, string, error),
+	log func(int, string, time.Time),
+) *PurchaseOrderHandler {
+	return &PurchaseOrderHandler{
+		Repo:             repo,
+		Engine:           engine,
+		Dispatcher:       dispatcher,
+		CurrentUser:      currentUser,
+		ReportAsyncError: reportAsyncError,
+		HandleErr:        handleErr,
+		Log:              log,
+	}
+}
+
+func (h *PurchaseOrderHandler) userEmail(r *http.Request) string {
+	if h.CurrentUser != nil {
+		if user := h.CurrentUser(r); user != nil {
+			return user.Email
+		}
+	}
+	return ""
+}
+
+func purchaseOrderToResponse(o *models.PurchaseOrder) *api.PurchaseOrderResponseDto {
+	resp := &api.PurchaseOrderResponseDto{
+		ID:         o.ID,
+		SupplierID: o.SupplierID,
+		Reference:  o.Reference,
+		Status:     o.Status,
+		Notes:      o.Notes,
+		CreatedBy:  o.CreatedBy,
+		LocationID: o.LocationID,
+		Lines:      make([]api.PurchaseOrderLineResponseDto, 0, len(o.Lines)),
+		CreatedAt:  o.CreatedAt.Format(time.RFC3339),
+	}
+	if o.Supplier != nil {
+		resp.Supplier = o.Supplier.Name
+	}
+	for i := range o.Lines {
+		line := &o.Lines[i]
+		dto := api.PurchaseOrderLineResponseDto{
+			ID:               line.ID,
+			MaterialID:       line.MaterialID,
+			Quantity:         line.Quantity,
+			ReceivedQuantity: line.ReceivedQuantity,
+			Pending:          line.Pending(),
+			UnitPrice:        line.UnitPrice,
+		}
+		if line.Material != nil {
+			dto.Material = line.Material.Name
+			dto.Unit = line.Material.Unit
+		}
+		resp.Total += line.Quantity * line.UnitPrice
+		resp.Lines = append(resp.Lines, dto)
+	}
+	if o.SentAt != nil {
+		resp.SentAt = o.SentAt.Format(time.RFC3339)
+	}
+	if o.ClosedAt != nil {
+		resp.ClosedAt = o.ClosedAt.Format(time.RFC3339)
+	}
+	return resp
+}
+
+// buildLines valida las líneas y expresa cada cantidad en la unidad base de
+// su material. Devuelve el estado HTTP del primer error.
+func (h *PurchaseOrderHandler) buildLines(reqs []api.PurchaseOrderLineRequestDto) ([]models.PurchaseOrderLine, int, error) {
+	lines := make([]models.PurchaseOrderLine, 0, len(reqs))
+	for i, req := range reqs {
+		if req.MaterialID == 0 {
+			return nil, http.StatusBadRequest, fmt.Errorf("lines[%d]: material_id required", i)
+		}
+		if req.Quantity <= 0 {
+			return nil, http.StatusBadRequest, fmt.Errorf("lines[%d]: quantity must be greater than zero", i)
+		}
+		if req.UnitPrice < 0 {
+			return nil, http.StatusBadRequest, fmt.Errorf("lines[%d]: unit_price must be positive", i)
+		}
+		quantity := req.Quantity
+		if h.Engine != nil {
+			var err error
+			quantity, _, err = h.Engine.ToBaseUnit(req.MaterialID, req.Quantity, req.QuantityUnit)
+			if errors.Is(err, repository.ErrMaterialNotFound) {
+				return nil, http.StatusBadRequest, fmt.Errorf("lines[%d]: %w", i, err)
+			}
+			if err != nil {
+				return nil, unitErrorStatus(err), fmt.Errorf("lines[%d]: %w", i, err)
+			}
+		}
+		lines = append(lines, models.PurchaseOrderLine{
+			MaterialID: req.MaterialID,
+			Quantity:   quantity,
+			UnitPrice:  req.UnitPrice,
+		})
+	}
+	return lines, 0, nil
+}
+
+// writeRepoError traduce los errores del repositorio de órdenes.
+func (h *PurchaseOrderHandler) writeRepoError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, repository.ErrPurchaseOrderNotFound):
+		h.HandleErr(w, http.StatusNotFound, r.URL.Path, err)
+	case errors.Is(err, repository.ErrSupplierNotFound),
+		errors.Is(err, repository.ErrMaterialNotFound),
+		errors.Is(err, repository.ErrPurchaseOrderLineNotFound),
+		errors.Is(err, repository.ErrLocationNotFound):
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, err)
+	case errors.Is(err, repository.ErrInvalidPurchaseOrderStatus),
+		errors.Is(err, repository.ErrEmptyPurchaseOrder),
+		errors.Is(err, repository.ErrOverReceipt):
+		h.HandleErr(w, http.StatusConflict, r.URL.Path, err)
+	default:
+		h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
+	}
+}
+
+func (h *PurchaseOrderHandler) audit(r *http.Request, action string, o *models.PurchaseOrder, details string) {
+	if h.Dispatcher == nil {
+		return
+	}
+	if err := h.Dispatcher.EnqueueAudit(action, "purchase_order", o.ID, h.userEmail(r), details); err != nil {
+		h.ReportAsyncError(r.URL.Path, err)
+	}
+}
+
+// find resuelve la orden del path; escribe el error y devuelve nil si no existe.
+func (h *PurchaseOrderHandler) find(w http.ResponseWriter, r *http.Request) *models.PurchaseOrder {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, err)
+		return nil
+	}
+	o, err := h.Repo.FindById(id)
+	if err != nil {
+		h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
+		return nil
+	}
+	if o == nil {
+		h.HandleErr(w, http.StatusNotFound, r.URL.Path, errors.New("purchase order not found"))
+		return nil
+	}
+	return o
+}
+
+func (h *PurchaseOrderHandler) write(w http.ResponseWriter, r *http.Request, status int, o *models.PurchaseOrder, start time.Time) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": purchaseOrderToResponse(o)})
+	h.Log(status, r.URL.Path, start)
+}
+
+// GetAll lista las órdenes; ?status=SENT filtra por estado.
+func (h *PurchaseOrderHandler) GetAll(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	status := strings.ToUpper(strings.TrimSpace(r.URL.Query().Get("status")))
+	orders, err := h.Repo.FindAll(status)
+	if err != nil {
+		h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
+		return
+	}
+	resp := make([]*api.PurchaseOrderResponseDto, 0, len(orders))
+	for _, o := range orders {
+		resp = append(resp, purchaseOrderToResponse(o))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": resp})
+	h.Log(http.StatusOK, r.URL.Path, start)
+}
+
+func (h *PurchaseOrderHandler) GetByID(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	o := h.find(w, r)
+	if o == nil {
+		return
+	}
+	h.write(w, r, http.StatusOK, o, start)
+}
+
+func (h *PurchaseOrderHandler) Create(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	var req api.PurchaseOrderRequestDto
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, err)
+		return
+	}
+	if req.SupplierID == 0 {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, errors.New("supplier_id required"))
+		return
+	}
+	lines, status, err := h.buildLines(req.Lines)
+	if err != nil {
+		h.HandleErr(w, status, r.URL.Path, err)
+		return
+	}
+	order := &models.PurchaseOrder{
+		SupplierID: req.SupplierID,
+		Reference:  strings.TrimSpace(req.Reference),
+		Notes:      req.Notes,
+		CreatedBy:  h.userEmail(r),
+		Lines:      lines,
+	}
+	if req.LocationID != 0 {
+		order.LocationID = &req.LocationID
+	}
+	o, err := h.Repo.Create(order)
+	if err != nil {
+		h.writeRepoError(w, r, err)
+		return
+	}
+	h.audit(r, "purchase_order_created", o, fmt.Sprintf("%d lines for %s", len(o.Lines), o.Supplier.Name))
+	h.write(w, r, http.StatusCreated, o, start)
+}
+
+// Edit modifica una orden en DRAFT; lines, si se envía, sustituye todas las líneas.
+func (h *PurchaseOrderHandler) Edit(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	o := h.find(w, r)
+	if o == nil {
+		return
+	}
+	var req api.PurchaseOrderEditRequestDto
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, err)
+		return
+	}
+	if req.SupplierID != nil {
+		o.SupplierID = *req.SupplierID
+	}
+	if req.Reference != nil {
+		o.Reference = strings.TrimSpace(*req.Reference)
+	}
+	if req.Notes != nil {
+		o.Notes = *req.Notes
+	}
+	if req.LocationID != nil {
+		o.LocationID = req.LocationID
+		if *req.LocationID == 0 {
+			o.LocationID = nil
+		}
+	}
+	var lines []models.PurchaseOrderLine
+	if req.Lines != nil {
+		var (
+			status int
+			err    error
+		)
+		lines, status, err = h.buildLines(req.Lines)
+		if err != nil {
+			h.HandleErr(w, status, r.URL.Path, err)
+			return
+		}
+	}
+	o, err := h.Repo.UpdateDraft(o.ID, o, lines)
+	if err != nil {
+		h.writeRepoError(w, r, err)
+		return
+	}
+	h.audit(r, "purchase_order_updated", o, "Purchase order updated")
+	h.write(w, r, http.StatusAccepted, o, start)
+}
+
+func (h *PurchaseOrderHandler) Send(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	o := h.find(w, r)
+	if o == nil {
+		return
+	}
+	o, err := h.Repo.Send(o.ID)
+	if err != nil {
+		h.writeRepoError(w, r, err)
+		return
+	}
+	h.audit(r, "purchase_order_sent", o, "Purchase order sent to "+o.Supplier.Name)
+	h.write(w, r, http.StatusOK, o, start)
+}
+
+func (h *PurchaseOrderHandler) Cancel(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	o := h.find(w, r)
+	if o == nil {
+		return
+	}
+	o, err := h.Repo.Cancel(o.ID)
+	if err != nil {
+		h.writeRepoError(w, r, err)
+		return
+	}
+	h.audit(r, "purchase_order_cancelled", o, "Purchase order cancelled")
+	h.write(w, r, http.StatusOK, o, start)
+}
+
+// Receive registra la llegada de mercancía por líneas (todo lo pendiente si
+// no se indican) y audita cada línea recibida.
+func (h *PurchaseOrderHandler) Receive(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	o := h.find(w, r)
+	if o == nil {
+		return
+	}
+	// Un cuerpo vacío, aunque llegue chunked, recibe todo lo pendiente.
+	var req api.PurchaseOrderReceiveRequestDto
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, err)
+		return
+	}
+	lines := make(map[uint]*models.PurchaseOrderLine, len(o.Lines))
+	for i := range o.Lines {
+		lines[o.Lines[i].ID] = &o.Lines[i]
+	}
+	receipts := make([]repository.LineReceipt, 0, len(req.Lines))
+	for i, rl := range req.Lines {
+		line, ok := lines[rl.LineID]
+		if !ok {
+			h.HandleErr(w, http.StatusBadRequest, r.URL.Path, fmt.Errorf("lines[%d]: %w", i, repository.ErrPurchaseOrderLineNotFound))
+			return
+		}
+		if rl.Quantity < 0 {
+			h.HandleErr(w, http.StatusBadRequest, r.URL.Path, fmt.Errorf("lines[%d]: quantity must be positive", i))
+			return
+		}
+		receipt := repository.LineReceipt{LineID: line.ID, Quantity: rl.Quantity}
+		if rl.Quantity > 0 && line.Material != nil {
+			quantity, err := materialQuantity(line.Material, rl.Quantity, rl.QuantityUnit)
+			if err != nil {
+				h.HandleErr(w, unitErrorStatus(err), r.URL.Path, fmt.Errorf("lines[%d]: %w", i, err))
+				return
+			}
+			receipt.Quantity = quantity
+		}
+		if number := strings.TrimSpace(rl.LotNumber); number != "" {
+			receipt.Lot = &models.MaterialLot{LotNumber: number, ReceivedAt: start.UTC()}
+			if rl.ExpiresAt != nil {
+				if !rl.ExpiresAt.After(receipt.Lot.ReceivedAt) {
+					h.HandleErr(w, http.StatusBadRequest, r.URL.Path, fmt.Errorf("lines[%d]: expires_at must be in the future", i))
+					return
+				}
+				expiresAt := rl.ExpiresAt.UTC()
+				receipt.Lot.ExpiresAt = &expiresAt
+			}
+		} else if rl.ExpiresAt != nil {
+			h.HandleErr(w, http.StatusBadRequest, r.URL.Path, fmt.Errorf("lines[%d]: expires_at requires lot_number", i))
+			return
+		}
+		receipts = append(receipts, receipt)
+	}
+	o, applied, err := h.Repo.Receive(o.ID, receipts, h.userEmail(r))
+	if err != nil {
+		h.writeRepoError(w, r, err)
+		return
+	}
+	for _, rc := range applied {
+		details := fmt.Sprintf("line #%d: %s of material %d", rc.LineID, strconv.FormatFloat(rc.Quantity, 'f', -1, 64), rc.MaterialID)
+		if line, ok := lines[rc.LineID]; ok && line.Material != nil {
+			details = fmt.Sprintf("line #%d: %s of %s", rc.LineID, strconv.FormatFloat(rc.Quantity, 'f', -1, 64), line.Material.Name)
+		}
+		if rc.Lot != nil {
+			details += " as lot " + rc.Lot.LotNumber
+		}
+		h.audit(r, "purchase_order_line_received", o, details)
+	}
+	h.write(w, r, http.StatusOK, o, start)
+}
@@ -0,0 +1,292 @@
+package handlers
+
+import (
+	"backend-avanzada/api"
+	"backend-avanzada/models"
+	"backend-avanzada/repository"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+type RecipeHandler struct {
+	Repo             *repository.RecipeRepository
+	Dispatcher       AsyncDispatcher
+	CurrentUser      func(*http.Request) *api.AuthenticatedUser
+	ReportAsyncError func(string, error)
+	HandleErr        func(http.ResponseWriter, int, string, error)
+	Log              func(int, string, time.Time)
+}
+
+func NewRecipeHandler(
+	repo *repository.RecipeRepository,
+	dispatcher AsyncDispatcher,
+	currentUser func(*http.Request) *api.AuthenticatedUser,
+	reportAsyncError func(string, error),
+	handleErr func(http.ResponseWriter, int, string, error),
+	log func(int, string, time.Time),
+) *RecipeHandler {
+	return &RecipeHandler{
+		Repo:             repo,
+		Dispatcher:       dispatcher,
+		CurrentUser:      currentUser,
+		ReportAsyncError: reportAsyncError,
+		HandleErr:        handleErr,
+		Log:              log,
+	}
+}
+
+func (h *RecipeHandler) userEmail(r *http.Request) string {
+	if h.CurrentUser != nil {
+		if user := h.CurrentUser(r); user != nil {
+			return user.Email
+		}
+	}
+	return ""
+}
+
+func recipeToResponse(recipe *models.Recipe) *api.RecipeResponseDto {
+	resp := &api.RecipeResponseDto{
+		ID:          int(recipe.ID),
+		Name:        recipe.Name,
+		Description: recipe.Description,
+		Inputs:      []api.RecipeComponentResponseDto{},
+		Outputs:     []api.RecipeComponentResponseDto{},
+		CreatedAt:   recipe.CreatedAt.Format(time.RFC3339),
+	}
+	for _, in := range recipe.Inputs {
+		resp.Inputs = append(resp.Inputs, api.RecipeComponentResponseDto{
+			MaterialID:   in.MaterialID,
+			MaterialName: materialName(in.Material),
+			Quantity:     in.Quantity,
+		})
+	}
+	for _, out := range recipe.Outputs {
+		resp.Outputs = append(resp.Outputs, api.RecipeComponentResponseDto{
+			MaterialID:   out.MaterialID,
+			MaterialName: materialName(out.Material),
+			Quantity:     out.Quantity,
+		})
+	}
+	return resp
+}
+
+func materialName(m *models.Material) string {
+	if m == nil {
+		return ""
+	}
+	return m.Name
+}
+
+func validateRecipeComponents(kind string, components []api.RecipeComponentDto) error {
+	if len(components) == 0 {
+		return errors.New("at least one " + kind + " is required")
+	}
+	for _, c := range components {
+		if c.MaterialID == 0 {
+			return errors.New(kind + " material is required")
+		}
+		if c.Quantity <= 0 {
+			return errors.New(kind + " quantity must be greater than zero")
+		}
+	}
+	return nil
+}
+
+func recipeInputsFromDto(components []api.RecipeComponentDto) []models.RecipeInput {
+	inputs := make([]models.RecipeInput, 0, len(components))
+	for _, c := range components {
+		inputs = append(inputs, models.RecipeInput{MaterialID: c.MaterialID, Quantity: c.Quantity})
+	}
+	return inputs
+}
+
+func recipeOutputsFromDto(components []api.RecipeComponentDto) []models.RecipeOutput {
+	outputs := make([]models.RecipeOutput, 0, len(components))
+	for _, c := range components {
+		outputs = append(outputs, models.RecipeOutput{MaterialID: c.MaterialID, Quantity: c.Quantity})
+	}
+	return outputs
+}
+
+func (h *RecipeHandler) GetAll(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	recipes, err := h.Repo.FindAll()
+	if err != nil {
+		h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
+		return
+	}
+	resp := make([]*api.RecipeResponseDto, 0, len(recipes))
+	for _, recipe := range recipes {
+		resp = append(resp, recipeToResponse(recipe))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": resp})
+	h.Log(http.StatusOK, r.URL.Path, start)
+}
+
+func (h *RecipeHandler) GetByID(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, err)
+		return
+	}
+	recipe, err := h.Repo.FindById(id)
+	if err != nil {
+		h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
+		return
+	}
+	if recipe == nil {
+		h.HandleErr(w, http.StatusNotFound, r.URL.Path, errors.New("recipe not found"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": recipeToResponse(recipe)})
+	h.Log(http.StatusOK, r.URL.Path, start)
+}
+
+func (h *RecipeHandler) Create(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	var req api.RecipeRequestDto
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, err)
+		return
+	}
+	if strings.TrimSpace(req.Name) == "" {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, errors.New("name required"))
+		return
+	}
+	if err := validateRecipeComponents("input", req.Inputs); err != nil {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, err)
+		return
+	}
+	if err := validateRecipeComponents("output", req.Outputs); err != nil {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, err)
+		return
+	}
+
+	recipe := &models.Recipe{
+		Name:        strings.TrimSpace(req.Name),
+		Description: req.Description,
+		Inputs:      recipeInputsFromDto(req.Inputs),
+		Outputs:     recipeOutputsFromDto(req.Outputs),
+	}
+	recipe, err := h.Repo.Save(recipe)
+	if err != nil {
+		if errors.Is(err, repository.ErrMaterialNotFound) {
+			h.HandleErr(w, http.StatusBadRequest, r.URL.Path, errors.New("material not found"))
+			return
+		}
+		h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
+		return
+	}
+	if h.Dispatcher != nil {
+		if err := h.Dispatcher.EnqueueAudit("recipe_created", "recipe", recipe.ID, h.userEmail(r), "Recipe created"); err != nil {
+			h.ReportAsyncError(r.URL.Path, err)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": recipeToResponse(recipe)})
+	h.Log(http.StatusCreated, r.URL.Path, start)
+}
+
+func (h *RecipeHandler) Edit(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, err)
+		return
+	}
+	recipe, err := h.Repo.FindById(id)
+	if err != nil {
+		h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
+		return
+	}
+	if recipe == nil {
+		h.HandleErr(w, http.StatusNotFound, r.URL.Path, errors.New("recipe not found"))
+		return
+	}
+
+	var req api.RecipeEditRequestDto
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, err)
+		return
+	}
+	if req.Name != nil {
+		if strings.TrimSpace(*req.Name) == "" {
+			h.HandleErr(w, http.StatusBadRequest, r.URL.Path, errors.New("name required"))
+			return
+		}
+		recipe.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.Description != nil {
+		recipe.Description = *req.Description
+	}
+	if req.Inputs != nil {
+		if err := validateRecipeComponents("input", *req.Inputs); err != nil {
+			h.HandleErr(w, http.StatusBadRequest, r.URL.Path, err)
+			return
+		}
+		recipe.Inputs = recipeInputsFromDto(*req.Inputs)
+	}
+	if req.Outputs != nil {
+		if err := validateRecipeComponents("output", *req.Outputs); err != nil {
+			h.HandleErr(w, http.StatusBadRequest, r.URL.Path, err)
+			return
+		}
+		recipe.Outputs = recipeOutputsFromDto(*req.Outputs)
+	}
+
+	recipe, err = h.Repo.Save(recipe)
+	if err != nil {
+		if errors.Is(err, repository.ErrMaterialNotFound) {
+			h.HandleErr(w, http.StatusBadRequest, r.URL.Path, errors.New("material not found"))
+			return
+		}
+		h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
+		return
+	}
+	if h.Dispatcher != nil {
+		if err := h.Dispatcher.EnqueueAudit("recipe_updated", "recipe", recipe.ID, h.userEmail(r), "Recipe updated"); err != nil {
+			h.ReportAsyncError(r.URL.Path, err)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": recipeToResponse(recipe)})
+	h.Log(http.StatusAccepted, r.URL.Path, start)
+}
+
+func (h *RecipeHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, err)
+		return
+	}
+	recipe, err := h.Repo.FindById(id)
+	if err != nil {
+		h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
+		return
+	}
+	if recipe == nil {
+		h.HandleErr(w, http.StatusNotFound, r.URL.Path, errors.New("recipe not found"))
+		return
+	}
+	if err := h.Repo.Delete(recipe); err != nil {
+		h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
+		return
+	}
+	if h.Dispatcher != nil {
+		if err := h.Dispatcher.EnqueueAudit("recipe_deleted", "recipe", recipe.ID, h.userEmail(r), "Recipe deleted"); err != nil {
+			h.ReportAsyncError(r.URL.Path, err)
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,280 @@
+package handlers
+
+import (
+	"backend-avanzada/api"
+	"backend-avanzada/models"
+	"backend-avanzada/repository"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+type RestockHandler struct {
+	Repo             *repository.RestockRepository
+	Dispatcher       AsyncDispatcher
+	CurrentUser      func(*http.Request) *api.AuthenticatedUser
+	ReportAsyncError func(string, error)
+	HandleErr        func(http.ResponseWriter, int, string, error)
+	Log              func(int, string, time.Time)
+}
+
+func NewRestockHandler(
+	repo *repository.RestockRepository,
+	dispatcher AsyncDispatcher,
+	currentUser func(*http.Request) *api.AuthenticatedUser,
+	reportAsyncError func(string, error),
+	handleErr func(http.ResponseWriter, int, string, error),
+	log func(int, string, time.Time),
+) *RestockHandler {
+	return &RestockHandler{
+		Repo:             repo,
+		Dispatcher:       dispatcher,
+		CurrentUser:      currentUser,
+		ReportAsyncError: reportAsyncError,
+		HandleErr:        handleErr,
+		Log:              log,
+	}
+}
+
+func (h *RestockHandler) userEmail(r *http.Request) string {
+	if h.CurrentUser != nil {
+		if user := h.CurrentUser(r); user != nil {
+			return user.Email
+		}
+	}
+	return ""
+}
+
+func restockToResponse(req *models.RestockRequest) *api.RestockRequestResponseDto {
+	resp := &api.RestockRequestResponseDto{
+		ID:               req.ID,
+		MaterialID:       req.MaterialID,
+		Quantity:         req.Quantity,
+		Status:           req.Status,
+		Available:        req.Available,
+		Trigger:          req.Trigger,
+		ReviewedBy:       req.ReviewedBy,
+		Note:             req.Note,
+		ReceivedBy:       req.ReceivedBy,
+		ReceivedQuantity: req.ReceivedQuantity,
+		CreatedAt:        req.CreatedAt.Format(time.RFC3339),
+	}
+	if req.Material != nil {
+		resp.Material = req.Material.Name
+		resp.Unit = req.Material.Unit
+	}
+	if req.ClosedAt != nil {
+		resp.ClosedAt = req.ClosedAt.Format(time.RFC3339)
+	}
+	return resp
+}
+
+// restockMaterialName nombra el material de req para la auditoría; si ya no se puede
+// cargar (p. ej. fue borrado) se usa su id.
+func restockMaterialName(req *models.RestockRequest) string {
+	if req.Material != nil {
+		return req.Material.Name
+	}
+	return fmt.Sprintf("material #%d", req.MaterialID)
+}
+
+// find resuelve la solicitud del path; escribe el error y devuelve nil si no existe.
+func (h *RestockHandler) find(w http.ResponseWriter, r *http.Request) *models.RestockRequest {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, err)
+		return nil
+	}
+	req, err := h.Repo.FindById(id)
+	if err != nil {
+		h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
+		return nil
+	}
+	if req == nil {
+		h.HandleErr(w, http.StatusNotFound, r.URL.Path, errors.New("restock request not found"))
+		return nil
+	}
+	return req
+}
+
+// transitionError traduce los errores de Approve, Receive y Dismiss.
+func (h *RestockHandler) transitionError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, repository.ErrRestockNotFound), errors.Is(err, repository.ErrMaterialNotFound):
+		h.HandleErr(w, http.StatusNotFound, r.URL.Path, err)
+	case errors.Is(err, repository.ErrInvalidRestockStatus):
+		h.HandleErr(w, http.StatusConflict, r.URL.Path, err)
+	case errors.Is(err, repository.ErrLocationNotFound):
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, err)
+	default:
+		h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
+	}
+}
+
+func (h *RestockHandler) audit(r *http.Request, action string, req *models.RestockRequest, details string) {
+	if h.Dispatcher == nil {
+		return
+	}
+	if err := h.Dispatcher.EnqueueAudit(action, "restock_request", req.ID, h.userEmail(r), details); err != nil {
+		h.ReportAsyncError(r.URL.Path, err)
+	}
+}
+
+// GetAll lista las solicitudes; ?status=OPEN filtra por estado.
+func (h *RestockHandler) GetAll(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	status := strings.ToUpper(strings.TrimSpace(r.URL.Query().Get("status")))
+	requests, err := h.Repo.FindAll(status)
+	if err != nil {
+		h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
+		return
+	}
+	resp := make([]*api.RestockRequestResponseDto, 0, len(requests))
+	for _, req := range requests {
+		resp = append(resp, restockToResponse(req))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": resp})
+	h.Log(http.StatusOK, r.URL.Path, start)
+}
+
+func (h *RestockHandler) GetByID(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	req := h.find(w, r)
+	if req == nil {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": restockToResponse(req)})
+	h.Log(http.StatusOK, r.URL.Path, start)
+}
+
+func (h *RestockHandler) Approve(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	req := h.find(w, r)
+	if req == nil {
+		return
+	}
+	// El cuerpo es opcional: uno vacío, aunque llegue chunked, aprueba la cantidad propuesta.
+	var body api.RestockApproveRequestDto
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, err)
+		return
+	}
+	if body.Quantity != nil {
+		if *body.Quantity <= 0 {
+			h.HandleErr(w, http.StatusBadRequest, r.URL.Path, errors.New("quantity must be greater than zero"))
+			return
+		}
+		if req.Material == nil {
+			h.HandleErr(w, http.StatusNotFound, r.URL.Path, repository.ErrMaterialNotFound)
+			return
+		}
+		quantity, err := materialQuantity(req.Material, *body.Quantity, body.QuantityUnit)
+		if err != nil {
+			h.HandleErr(w, unitErrorStatus(err), r.URL.Path, err)
+			return
+		}
+		body.Quantity = &quantity
+	}
+	req, err := h.Repo.Approve(req.ID, body.Quantity, h.userEmail(r))
+	if err != nil {
+		h.transitionError(w, r, err)
+		return
+	}
+	h.audit(r, "restock_approved", req, fmt.Sprintf("%s: %s", restockMaterialName(req), strconv.FormatFloat(req.Quantity, 'f', -1, 64)))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": restockToResponse(req)})
+	h.Log(http.StatusOK, r.URL.Path, start)
+}
+
+// Receive registra la llegada de una solicitud aprobada y suma lo recibido a
+// las existencias, como lote si se indica lot_number.
+func (h *RestockHandler) Receive(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	req := h.find(w, r)
+	if req == nil {
+		return
+	}
+	// El cuerpo es opcional: uno vacío, aunque llegue chunked, recibe la cantidad aprobada.
+	var body api.RestockReceiveRequestDto
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, err)
+		return
+	}
+	quantity := req.Quantity
+	if body.Quantity != nil {
+		if *body.Quantity <= 0 {
+			h.HandleErr(w, http.StatusBadRequest, r.URL.Path, errors.New("quantity must be greater than zero"))
+			return
+		}
+		if req.Material == nil {
+			h.HandleErr(w, http.StatusNotFound, r.URL.Path, repository.ErrMaterialNotFound)
+			return
+		}
+		var err error
+		quantity, err = materialQuantity(req.Material, *body.Quantity, body.QuantityUnit)
+		if err != nil {
+			h.HandleErr(w, unitErrorStatus(err), r.URL.Path, err)
+			return
+		}
+	}
+	var lot *models.MaterialLot
+	if number := strings.TrimSpace(body.LotNumber); number != "" {
+		lot = &models.MaterialLot{LotNumber: number, ReceivedAt: start.UTC()}
+		if body.ExpiresAt != nil {
+			if !body.ExpiresAt.After(lot.ReceivedAt) {
+				h.HandleErr(w, http.StatusBadRequest, r.URL.Path, errors.New("expires_at must be in the future"))
+				return
+			}
+			expiresAt := body.ExpiresAt.UTC()
+			lot.ExpiresAt = &expiresAt
+		}
+	} else if body.ExpiresAt != nil {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, errors.New("expires_at requires lot_number"))
+		return
+	}
+	req, err := h.Repo.Receive(req.ID, quantity, lot, body.LocationID, h.userEmail(r))
+	if err != nil {
+		h.transitionError(w, r, err)
+		return
+	}
+	details := fmt.Sprintf("%s: %s received", restockMaterialName(req), strconv.FormatFloat(quantity, 'f', -1, 64))
+	if lot != nil {
+		details += " as lot " + lot.LotNumber
+	}
+	h.audit(r, "restock_received", req, details)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": restockToResponse(req)})
+	h.Log(http.StatusOK, r.URL.Path, start)
+}
+
+func (h *RestockHandler) Dismiss(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	req := h.find(w, r)
+	if req == nil {
+		return
+	}
+	// El cuerpo es opcional: uno vacío, aunque llegue chunked, descarta sin motivo.
+	var body api.RestockDismissRequestDto
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, err)
+		return
+	}
+	req, err := h.Repo.Dismiss(req.ID, h.userEmail(r), strings.TrimSpace(body.Reason))
+	if err != nil {
+		h.transitionError(w, r, err)
+		return
+	}
+	h.audit(r, "restock_dismissed", req, restockMaterialName(req)+": "+req.Note)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": restockToResponse(req)})
+	h.Log(http.StatusOK, r.URL.Path, start)
+}
@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"backend-avanzada/api"
+	"backend-avanzada/models"
+	"backend-avanzada/repository"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+type SupplierHandler struct {
+	Repo             *repository.SupplierRepository
+	Dispatcher       AsyncDispatcher
+	CurrentUser      func(*http.Request) *api.AuthenticatedUser
+	ReportAsyncError func(string, error)
+	HandleErr        func(http.ResponseWriter, int, string, error)
+	Log              func(int, string, time.Time)
+}
+
+func NewSupplierHandler(
+	repo *repository.SupplierRepository,
+	dispatcher AsyncDispatcher,
+	currentUser func(*http.Request) *api.AuthenticatedUser,
+	reportAsyncError func(string, error),
+	handleErr func(http.ResponseWriter, int, string, error),
+	log func(int, string, time.Time),
+) *SupplierHandler {
+	return &SupplierHandler{
+		Repo:             repo,
+		Dispatcher:       dispatcher,
+		CurrentUser:      currentUser,
+		ReportAsyncError: reportAsyncError,
+		HandleErr:        handleErr,
+		Log:              log,
+	}
+}
+
+func (h *SupplierHandler) userEmail(r *http.Request) string {
+	if h.CurrentUser != nil {
+		if user := h.CurrentUser(r); user != nil {
+			return user.Email
+		}
+	}
+	return ""
+}
+
+func supplierToResponse(s *models.Supplier) *api.SupplierResponseDto {
+	return &api.SupplierResponseDto{
+		ID:        s.ID,
+		Name:      s.Name,
+		Email:     s.Email,
+		Phone:     s.Phone,
+		Address:   s.Address,
+		Notes:     s.Notes,
+		CreatedAt: s.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+func (h *SupplierHandler) GetAll(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	suppliers, err := h.Repo.FindAll()
+	if err != nil {
+		h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
+		return
+	}
+	resp := make([]*api.SupplierResponseDto, 0, len(suppliers))
+	for _, s := range suppliers {
+		resp = append(resp, supplierToResponse(s))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": resp})
+	h.Log(http.StatusOK, r.URL.Path, start)
+}
+
+func (h *SupplierHandler) GetByID(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, err)
+		return
+	}
+	s, err := h.Repo.FindById(id)
+	if err != nil {
+		h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
+		return
+	}
+	if s == nil {
+		h.HandleErr(w, http.StatusNotFound, r.URL.Path, errors.New("supplier not found"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": supplierToResponse(s)})
+	h.Log(http.StatusOK, r.URL.Path, start)
+}
+
+func (h *SupplierHandler) Create(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	var req api.SupplierRequestDto
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, err)
+		return
+	}
+	s := &models.Supplier{
+		Name:    strings.TrimSpace(req.Name),
+		Email:   strings.TrimSpace(req.Email),
+		Phone:   strings.TrimSpace(req.Phone),
+		Address: req.Address,
+		Notes:   req.Notes,
+	}
+	if s.Name == "" {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, errors.New("name required"))
+		return
+	}
+	s, err := h.Repo.Save(s)
+	if err != nil {
+		h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
+		return
+	}
+	if h.Dispatcher != nil {
+		if err := h.Dispatcher.EnqueueAudit("supplier_created", "supplier", s.ID, h.userEmail(r), "Supplier created"); err != nil {
+			h.ReportAsyncError(r.URL.Path, err)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": supplierToResponse(s)})
+	h.Log(http.StatusCreated, r.URL.Path, start)
+}
+
+func (h *SupplierHandler) Edit(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, err)
+		return
+	}
+	s, err := h.Repo.FindById(id)
+	if err != nil {
+		h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
+		return
+	}
+	if s == nil {
+		h.HandleErr(w, http.StatusNotFound, r.URL.Path, errors.New("supplier not found"))
+		return
+	}
+	var req api.SupplierEditRequestDto
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, err)
+		return
+	}
+	if req.Name != nil {
+		s.Name = strings.TrimSpace(*req.Name)
+		if s.Name == "" {
+			h.HandleErr(w, http.StatusBadRequest, r.URL.Path, errors.New("name required"))
+			return
+		}
+	}
+	if req.Email != nil {
+		s.Email = strings.TrimSpace(*req.Email)
+	}
+	if req.Phone != nil {
+		s.Phone = strings.TrimSpace(*req.Phone)
+	}
+	if req.Address != nil {
+		s.Address = *req.Address
+	}
+	if req.Notes != nil {
+		s.Notes = *req.Notes
+	}
+	s, err = h.Repo.Save(s)
+	if err != nil {
+		h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
+		return
+	}
+	if h.Dispatcher != nil {
+		if err := h.Dispatcher.EnqueueAudit("supplier_updated", "supplier", s.ID, h.userEmail(r), "Supplier updated"); err != nil {
+			h.ReportAsyncError(r.URL.Path, err)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": supplierToResponse(s)})
+	h.Log(http.StatusAccepted, r.URL.Path, start)
+}
+
+func (h *SupplierHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, err)
+		return
+	}
+	s, err := h.Repo.FindById(id)
+	if err != nil {
+		h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
+		return
+	}
+	if s == nil {
+		h.HandleErr(w, http.StatusNotFound, r.URL.Path, errors.New("supplier not found"))
+		return
+	}
+	if err := h.Repo.Delete(s); err != nil {
+		if errors.Is(err, repository.ErrSupplierInUse) {
+			h.HandleErr(w, http.StatusConflict, r.URL.Path, err)
+			return
+		}
+		h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
+		return
+	}
+	if h.Dispatcher != nil {
+		if err := h.Dispatcher.EnqueueAudit("supplier_deleted", "supplier", s.ID, h.userEmail(r), "Supplier deleted"); err != nil {
+			h.ReportAsyncError(r.URL.Path, err)
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
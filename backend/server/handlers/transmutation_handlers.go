@@ -1,11 +1,15 @@
 package handlers
 
 import (
+	"backend-avanzada/alchemy"
 	"backend-avanzada/api"
+	"backend-avanzada/formula"
 	"backend-avanzada/models"
 	"backend-avanzada/repository"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"strconv"
 	"strings"
@@ -16,6 +20,7 @@ import (
 
 type TransmutationHandler struct {
 	Repo             *repository.TransmutationRepository
+	Engine           *alchemy.Engine
 	Dispatcher       AsyncDispatcher
 	CurrentUser      func(*http.Request) *api.AuthenticatedUser
 	ReportAsyncError func(string, error)
@@ -26,6 +31,7 @@ type TransmutationHandler struct {
 
 func NewTransmutationHandler(
 	repo *repository.TransmutationRepository,
+	engine *alchemy.Engine,
 	dispatcher AsyncDispatcher,
 	currentUser func(*http.Request) *api.AuthenticatedUser,
 	reportAsyncError func(string, error),
@@ -35,6 +41,7 @@ func NewTransmutationHandler(
 ) *TransmutationHandler {
 	return &TransmutationHandler{
 		Repo:             repo,
+		Engine:           engine,
 		Dispatcher:       dispatcher,
 		CurrentUser:      currentUser,
 		ReportAsyncError: reportAsyncError,
@@ -51,22 +58,286 @@ func (h *TransmutationHandler) currentUser(r *http.Request) *api.AuthenticatedUs
 	return nil
 }
 
+// TransmutationToResponse construye el DTO público de una transmutación.
+func TransmutationToResponse(t *models.Transmutation) *api.TransmutationResponseDto {
+	resp := &api.TransmutationResponseDto{
+		ID:             int(t.ID),
+		UserID:         t.UserID,
+		MaterialID:     t.MaterialID,
+		RecipeID:       t.RecipeID,
+		BatchID:        t.BatchID,
+		PipelineID:     t.PipelineID,
+		Formula:        t.Formula,
+		FormulaID:      t.FormulaID,
+		FormulaVersion: t.FormulaVersion,
+		Quantity:       t.Quantity,
+		Unit:           t.Unit,
+		LocationID:     t.LocationID,
+		Status:         t.Status,
+		Result:         t.Result,
+		Attempts:       t.Attempts,
+		ApprovalReason: t.ApprovalReason,
+		ReviewedBy:     t.ReviewedBy,
+		ReviewComment:  t.ReviewComment,
+		Inputs:         []api.RecipeComponentDto{},
+		CreatedAt:      t.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:      t.UpdatedAt.Format(time.RFC3339),
+	}
+	if t.ScheduledAt != nil {
+		resp.ScheduledAt = t.ScheduledAt.Format(time.RFC3339)
+	}
+	for _, in := range t.Inputs {
+		resp.Inputs = append(resp.Inputs, api.RecipeComponentDto{MaterialID: in.MaterialID, Quantity: in.Quantity})
+	}
+	for _, d := range t.LotDraws {
+		resp.Lots = append(resp.Lots, api.TransmutationLotDrawDto{LotID: d.LotID, MaterialID: d.MaterialID, Quantity: d.Quantity, Attempt: d.Attempt})
+	}
+	if t.Outcome != nil {
+		resp.Outcome = outcomeToDto(t.Outcome)
+	}
+	if t.Progress.Stage != "" {
+		resp.Progress = TransmutationProgressToResponse(t)
+	}
+	return resp
+}
+
+// TransmutationProgressToResponse construye el DTO del último avance de t.
+func TransmutationProgressToResponse(t *models.Transmutation) *api.TransmutationProgressDto {
+	resp := &api.TransmutationProgressDto{
+		TransmutationID: t.ID,
+		Status:          t.Status,
+		Stage:           t.Progress.Stage,
+		Percent:         t.Progress.Percent,
+		Message:         t.Progress.Message,
+	}
+	if t.Progress.ReportedAt != nil {
+		resp.UpdatedAt = t.Progress.ReportedAt.Format(time.RFC3339)
+	}
+	return resp
+}
+
+func outcomeToDto(o *models.TransmutationOutcome) *api.TransmutationOutcomeDto {
+	outcome := &api.TransmutationOutcomeDto{
+		Batches:     o.Batches,
+		Yield:       o.Yield,
+		Inputs:      []api.TransmutationComponentDto{},
+		Outputs:     []api.TransmutationComponentDto{},
+		CompletedAt: o.CompletedAt.Format(time.RFC3339),
+	}
+	for _, c := range o.Inputs {
+		outcome.Inputs = append(outcome.Inputs, transmutationComponentToDto(c))
+	}
+	for _, c := range o.Outputs {
+		outcome.Outputs = append(outcome.Outputs, transmutationComponentToDto(c))
+	}
+	if o.Exchange != nil {
+		outcome.Exchange = &api.ExchangeBalanceDto{
+			InputValue:  o.Exchange.InputValue,
+			OutputValue: o.Exchange.OutputValue,
+			Imbalance:   o.Exchange.Imbalance,
+			Tolerance:   o.Exchange.Tolerance,
+			Violated:    o.Exchange.Violated,
+		}
+	}
+	return outcome
+}
+
+func transmutationComponentToDto(c models.TransmutationComponent) api.TransmutationComponentDto {
+	return api.TransmutationComponentDto{
+		MaterialID:  c.MaterialID,
+		Material:    c.Material,
+		Quantity:    c.Quantity,
+		Created:     c.Created,
+		EnergyValue: c.EnergyValue,
+	}
+}
+
+// rejectionSubject indica contra qué se audita una petición rechazada antes
+// de existir la transmutación: la fórmula del catálogo, la receta o el material.
+func rejectionSubject(req api.TransmutationRequestDto) (string, uint) {
+	switch {
+	case req.FormulaID != 0:
+		return "formula", req.FormulaID
+	case req.RecipeID != 0:
+		return "recipe", req.RecipeID
+	default:
+		return "material", req.MaterialID
+	}
+}
+
+// auditExchangeViolation registra el desequilibrio para que los supervisores lo revisen.
+func (h *TransmutationHandler) auditExchangeViolation(r *http.Request, entity string, entityID uint, email, details string) {
+	if h.Dispatcher == nil {
+		return
+	}
+	if err := h.Dispatcher.EnqueueAudit("equivalent_exchange_violation", entity, entityID, email, details); err != nil {
+		h.ReportAsyncError(r.URL.Path, err)
+	}
+}
+
+func (h *TransmutationHandler) auditRuleHits(r *http.Request, entity string, entityID uint, email, outcome string, hits []models.RuleHit) {
+	if h.Dispatcher == nil {
+		return
+	}
+	if err := auditRuleHits(h.Dispatcher, entity, entityID, email, outcome, hits); err != nil {
+		h.ReportAsyncError(r.URL.Path, err)
+	}
+}
+
+// checkPrepared aplica a una petición ya evaluada las comprobaciones que la
+// rechazan con 422 y audita el rechazo contra su fórmula, receta o material.
+func (h *TransmutationHandler) checkPrepared(r *http.Request, req api.TransmutationRequestDto, email string, outcome *models.TransmutationOutcome, err error) error {
+	entity, entityID := rejectionSubject(req)
+	if err != nil {
+		if errors.Is(err, alchemy.ErrUnvaluedMaterial) {
+			h.auditExchangeViolation(r, entity, entityID, email, "rejected: "+err.Error())
+		}
+		return err
+	}
+	if err := h.Engine.CheckExchange(outcome); err != nil {
+		h.auditExchangeViolation(r, entity, entityID, email, "rejected: "+alchemy.DescribeBalance(outcome.Exchange))
+		return err
+	}
+	if err := h.Engine.CheckRules(outcome); err != nil {
+		h.auditRuleHits(r, entity, entityID, email, "rejected", outcome.Rules)
+		return err
+	}
+	return nil
+}
+
+// advancePipeline pide revisar el pipeline de t tras un cambio de estado hecho desde la API.
+func (h *TransmutationHandler) advancePipeline(r *http.Request, t *models.Transmutation, email string) {
+	if t.PipelineID == nil || h.Dispatcher == nil {
+		return
+	}
+	if err := h.Dispatcher.EnqueuePipelineAdvance(*t.PipelineID, email); err != nil {
+		h.ReportAsyncError(r.URL.Path, err)
+	}
+}
+
 func (h *TransmutationHandler) emitTransmutationEvent(t *models.Transmutation) {
 	if h.Broadcast == nil {
 		return
 	}
-	payload := &api.TransmutationResponseDto{
-		ID:         int(t.ID),
-		UserID:     t.UserID,
-		MaterialID: t.MaterialID,
-		Formula:    t.Formula,
-		Quantity:   t.Quantity,
-		Status:     t.Status,
-		Result:     t.Result,
-		CreatedAt:  t.CreatedAt.Format(time.RFC3339),
-		UpdatedAt:  t.UpdatedAt.Format(time.RFC3339),
+	h.Broadcast("transmutation.updated", TransmutationToResponse(t))
+}
+
+// prepareTransmutation valida la petición y evalúa la transmutación sin tocar
+// el inventario. Create, Estimate, los lotes y los pipelines comparten este
+// camino para no discrepar; si falla devuelve el código HTTP correspondiente.
+func prepareTransmutation(engine *alchemy.Engine, req api.TransmutationRequestDto, user *api.AuthenticatedUser) (*models.Transmutation, *models.TransmutationOutcome, int, error) {
+	ownerID := user.ID
+	if user.Role == "supervisor" && req.UserID != 0 {
+		ownerID = req.UserID
+	}
+	if ownerID == 0 {
+		return nil, nil, http.StatusBadRequest, errors.New("invalid user")
+	}
+	if req.MaterialID == 0 && req.RecipeID == 0 {
+		return nil, nil, http.StatusBadRequest, errors.New("material or recipe is required")
+	}
+	if req.Quantity <= 0 {
+		return nil, nil, http.StatusBadRequest, errors.New("quantity must be greater than zero")
+	}
+	var catalogue *models.FormulaVersion
+	if req.FormulaID != 0 {
+		if req.RecipeID != 0 || strings.TrimSpace(req.Formula) != "" {
+			return nil, nil, http.StatusBadRequest, errors.New("formula_id cannot be combined with a recipe or a freehand formula")
+		}
+		_, version, err := engine.ResolveFormula(req.FormulaID, req.FormulaVersion)
+		switch {
+		case errors.Is(err, repository.ErrFormulaNotFound), errors.Is(err, repository.ErrFormulaVersionNotFound):
+			return nil, nil, http.StatusBadRequest, err
+		case errors.Is(err, alchemy.ErrFormulaDeprecated):
+			return nil, nil, http.StatusConflict, err
+		case err != nil:
+			return nil, nil, http.StatusInternalServerError, err
+		}
+		catalogue = version
+		req.Formula = version.Body
+	} else if req.FormulaVersion != 0 {
+		return nil, nil, http.StatusBadRequest, errors.New("formula_version requires formula_id")
+	}
+	// Las cantidades se guardan siempre en la unidad base del material.
+	quantity, unit := req.Quantity, ""
+	if req.RecipeID == 0 {
+		var err error
+		quantity, unit, err = engine.ToBaseUnit(req.MaterialID, req.Quantity, req.Unit)
+		if err != nil {
+			if errors.Is(err, repository.ErrMaterialNotFound) {
+				return nil, nil, http.StatusBadRequest, errors.New("material not found")
+			}
+			return nil, nil, unitErrorStatus(err), err
+		}
+	} else if strings.TrimSpace(req.Unit) != "" {
+		return nil, nil, http.StatusBadRequest, errors.New("unit cannot be used with a recipe: quantity is the number of batches")
+	}
+	// Con receta la fórmula es opcional: las salidas las define la receta.
+	if req.RecipeID == 0 || strings.TrimSpace(req.Formula) != "" {
+		if _, err := formula.Parse(req.Formula); err != nil {
+			return nil, nil, http.StatusBadRequest, err
+		}
+	}
+
+	t := &models.Transmutation{
+		UserID:     ownerID,
+		MaterialID: req.MaterialID,
+		Formula:    strings.TrimSpace(req.Formula),
+		Quantity:   quantity,
+		Unit:       unit,
+		Status:     models.TransmutationStatusPending,
+	}
+	if req.RecipeID != 0 {
+		recipeID := req.RecipeID
+		t.RecipeID = &recipeID
+	}
+	if req.LocationID != 0 {
+		locationID := req.LocationID
+		t.LocationID = &locationID
+	}
+	if catalogue != nil {
+		formulaID := catalogue.FormulaID
+		t.FormulaID = &formulaID
+		t.FormulaVersion = catalogue.Version
+	}
+	// Una hora ya pasada equivale a procesarla de inmediato.
+	if req.ScheduledAt != nil && req.ScheduledAt.After(time.Now()) {
+		scheduledAt := req.ScheduledAt.UTC()
+		t.ScheduledAt = &scheduledAt
+	}
+
+	outcome, err := engine.Evaluate(t, time.Now().UTC())
+	if err != nil {
+		var syntaxErr *formula.SyntaxError
+		switch {
+		case errors.Is(err, repository.ErrRecipeNotFound):
+			return nil, nil, http.StatusBadRequest, errors.New("recipe not found")
+		case errors.As(err, &syntaxErr), errors.Is(err, alchemy.ErrReactantMismatch):
+			return nil, nil, http.StatusBadRequest, err
+		case errors.Is(err, alchemy.ErrUnvaluedMaterial):
+			return nil, nil, http.StatusUnprocessableEntity, err
+		default:
+			return nil, nil, http.StatusInternalServerError, err
+		}
+	}
+	outcome.Rules, err = engine.MatchRules(t, outcome, user.Role)
+	if err != nil {
+		return nil, nil, http.StatusInternalServerError, err
+	}
+	reasons, err := engine.ApprovalReasons(t)
+	if err != nil {
+		return nil, nil, http.StatusInternalServerError, err
+	}
+	for _, hit := range outcome.Rules {
+		if hit.Action == models.RuleActionRequireApproval {
+			reasons = append(reasons, fmt.Sprintf("rule %q: %s", hit.Rule, hit.Reason))
+		}
+	}
+	if len(reasons) > 0 {
+		t.Status = models.TransmutationStatusAwaitingApproval
+		t.ApprovalReason = strings.Join(reasons, "; ")
 	}
-	h.Broadcast("transmutation.updated", payload)
+	return t, outcome, 0, nil
 }
 
 func (h *TransmutationHandler) Create(w http.ResponseWriter, r *http.Request) {
@@ -82,74 +353,384 @@ func (h *TransmutationHandler) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ownerID := user.ID
-	if user.Role == "supervisor" && req.UserID != 0 {
-		ownerID = req.UserID
+	t, outcome, status, err := prepareTransmutation(h.Engine, req, user)
+	if err := h.checkPrepared(r, req, user.Email, outcome, err); err != nil {
+		if status == 0 {
+			status = http.StatusUnprocessableEntity
+		}
+		h.HandleErr(w, status, r.URL.Path, err)
+		return
 	}
-	if ownerID == 0 {
-		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, errors.New("invalid user"))
+	flagged := outcome.Exchange != nil && outcome.Exchange.Violated
+
+	t, err = h.Repo.Create(t, user.Email)
+	if err != nil {
+		status, err := storeErrorStatus(err)
+		h.HandleErr(w, status, r.URL.Path, err)
 		return
 	}
-	if req.MaterialID == 0 {
-		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, errors.New("material is required"))
+	h.afterCreate(r, t, user.Email, flagged, outcome)
+
+	resp := TransmutationToResponse(t)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": resp})
+	h.Log(http.StatusCreated, r.URL.Path, start)
+}
+
+// storeErrorStatus traduce los errores de reserva del repositorio a código HTTP y mensaje.
+func storeErrorStatus(err error) (int, error) {
+	switch {
+	case errors.Is(err, repository.ErrMaterialNotFound):
+		return http.StatusBadRequest, errors.New("material not found")
+	case errors.Is(err, repository.ErrRecipeNotFound):
+		return http.StatusBadRequest, errors.New("recipe not found")
+	case errors.Is(err, repository.ErrLocationNotFound):
+		return http.StatusBadRequest, err
+	case errors.Is(err, repository.ErrInsufficientMaterial):
+		return http.StatusBadRequest, errors.New("insufficient material quantity")
+	case errors.Is(err, repository.ErrQuotaExceeded):
+		return http.StatusTooManyRequests, err
+	default:
+		return http.StatusInternalServerError, err
+	}
+}
+
+// afterCreate encola el procesamiento, audita y emite el evento de una transmutación recién creada.
+func (h *TransmutationHandler) afterCreate(r *http.Request, t *models.Transmutation, email string, flagged bool, outcome *models.TransmutationOutcome) {
+	awaiting := t.Status == models.TransmutationStatusAwaitingApproval
+	if h.Dispatcher != nil {
+		if awaiting {
+			// Retenida: se encola cuando un supervisor la apruebe.
+			if err := h.Dispatcher.EnqueueAudit("transmutation_approval_requested", "transmutation", t.ID, email, t.ApprovalReason); err != nil {
+				h.ReportAsyncError(r.URL.Path, err)
+			}
+		} else if err := h.enqueueProcessing(t, email); err != nil {
+			h.ReportAsyncError(r.URL.Path, err)
+		}
+		details := "formula: " + t.Formula
+		if t.FormulaID != nil {
+			details = fmt.Sprintf("formula %d v%d: %s", *t.FormulaID, t.FormulaVersion, t.Formula)
+		}
+		if t.RecipeID != nil {
+			details = fmt.Sprintf("recipe %d x %s", *t.RecipeID, strconv.FormatFloat(t.Quantity, 'f', -1, 64))
+		}
+		if t.BatchID != nil {
+			details += fmt.Sprintf(" (batch %d)", *t.BatchID)
+		}
+		if err := h.Dispatcher.EnqueueAudit("transmutation_created", "transmutation", t.ID, email, details); err != nil {
+			h.ReportAsyncError(r.URL.Path, err)
+		}
+	}
+	if flagged {
+		h.auditExchangeViolation(r, "transmutation", t.ID, email, "flagged: "+alchemy.DescribeBalance(outcome.Exchange))
+	}
+	h.auditRuleHits(r, "transmutation", t.ID, email, "matched", outcome.Rules)
+	h.emitTransmutationEvent(t)
+	if awaiting && h.Broadcast != nil {
+		h.Broadcast("transmutation.approval_requested", TransmutationToResponse(t))
+	}
+}
+
+// enqueueProcessing encola la transmutación o, si está programada, la difiere hasta su hora.
+func (h *TransmutationHandler) enqueueProcessing(t *models.Transmutation, email string) error {
+	if t.ScheduledAt != nil {
+		return h.Dispatcher.ScheduleTransmutationProcessing(t.ID, email, *t.ScheduledAt)
+	}
+	return h.Dispatcher.EnqueueTransmutationProcessing(t.ID, email)
+}
+
+// POST /transmutations/estimate
+func (h *TransmutationHandler) Estimate(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	var req api.TransmutationRequestDto
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, err)
 		return
 	}
-	if req.Quantity <= 0 {
-		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, errors.New("quantity must be greater than zero"))
+	user := h.currentUser(r)
+	if user == nil {
+		h.HandleErr(w, http.StatusUnauthorized, r.URL.Path, errors.New("unauthorized"))
 		return
 	}
 
-	t := &models.Transmutation{
-		UserID:     ownerID,
-		MaterialID: req.MaterialID,
-		Formula:    req.Formula,
-		Quantity:   req.Quantity,
-		Status:     models.TransmutationStatusPending,
+	t, outcome, status, err := prepareTransmutation(h.Engine, req, user)
+	if err != nil {
+		h.HandleErr(w, status, r.URL.Path, err)
+		return
 	}
-	t, err := h.Repo.Create(t)
+	projections, err := h.Repo.ProjectInputs(t)
 	if err != nil {
 		switch {
 		case errors.Is(err, repository.ErrMaterialNotFound):
 			h.HandleErr(w, http.StatusBadRequest, r.URL.Path, errors.New("material not found"))
-		case errors.Is(err, repository.ErrInsufficientMaterial):
-			h.HandleErr(w, http.StatusBadRequest, r.URL.Path, errors.New("insufficient material quantity"))
+		case errors.Is(err, repository.ErrRecipeNotFound):
+			h.HandleErr(w, http.StatusBadRequest, r.URL.Path, errors.New("recipe not found"))
+		case errors.Is(err, repository.ErrLocationNotFound):
+			h.HandleErr(w, http.StatusBadRequest, r.URL.Path, err)
 		default:
 			h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
 		}
 		return
 	}
+	duration, samples, err := h.Repo.AverageProcessingDuration(50)
+	if err != nil {
+		h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
+		return
+	}
 
-	if h.Dispatcher != nil {
-		if err := h.Dispatcher.EnqueueTransmutationProcessing(t.ID, user.Email); err != nil {
-			h.ReportAsyncError(r.URL.Path, err)
+	resp := &api.TransmutationEstimateDto{
+		Sufficient:               true,
+		Materials:                []api.StockProjectionDto{},
+		Outcome:                  outcomeToDto(outcome),
+		EstimatedDurationSeconds: duration.Seconds(),
+		DurationSamples:          samples,
+		Violations:               []api.PolicyViolationDto{},
+	}
+	for _, p := range projections {
+		sufficient := p.Remaining >= 0
+		if !sufficient {
+			resp.Sufficient = false
+		}
+		resp.Materials = append(resp.Materials, api.StockProjectionDto{
+			MaterialID: p.MaterialID,
+			Material:   p.Material,
+			LocationID: p.LocationID,
+			Available:  p.Available,
+			Required:   p.Required,
+			Remaining:  p.Remaining,
+			Sufficient: sufficient,
+		})
+	}
+	if outcome.Exchange != nil && outcome.Exchange.Violated {
+		resp.Violations = append(resp.Violations, api.PolicyViolationDto{
+			Policy:   "equivalent_exchange",
+			Message:  alchemy.DescribeBalance(outcome.Exchange),
+			Blocking: h.Engine.CheckExchange(outcome) != nil,
+		})
+	}
+	for _, hit := range outcome.Rules {
+		resp.Violations = append(resp.Violations, api.PolicyViolationDto{
+			Policy:   "rule",
+			Message:  "rule " + alchemy.DescribeRuleHit(hit),
+			Blocking: hit.Action == models.RuleActionBlock,
+		})
+	}
+	if t.Status == models.TransmutationStatusAwaitingApproval {
+		resp.Violations = append(resp.Violations, api.PolicyViolationDto{
+			Policy:  "approval",
+			Message: "requires supervisor approval: " + t.ApprovalReason,
+		})
+	}
+	resp.Feasible = resp.Sufficient
+	for _, v := range resp.Violations {
+		if v.Blocking {
+			resp.Feasible = false
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": resp})
+	h.Log(http.StatusOK, r.URL.Path, start)
+}
+
+// maxBatchSize limita cuántas transmutaciones admite un solo lote.
+const maxBatchSize = 100
+
+// batchItem es un elemento del lote ya validado y evaluado.
+type batchItem struct {
+	index   int
+	t       *models.Transmutation
+	outcome *models.TransmutationOutcome
+	flagged bool
+}
+
+// POST /transmutations/batch
+func (h *TransmutationHandler) CreateBatch(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	var req api.TransmutationBatchRequestDto
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, err)
+		return
+	}
+	user := h.currentUser(r)
+	if user == nil {
+		h.HandleErr(w, http.StatusUnauthorized, r.URL.Path, errors.New("unauthorized"))
+		return
+	}
+	if req.Mode == "" {
+		req.Mode = models.BatchModeAllOrNothing
+	}
+	if req.Mode != models.BatchModeAllOrNothing && req.Mode != models.BatchModeBestEffort {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, errors.New("mode must be all_or_nothing or best_effort"))
+		return
+	}
+	if len(req.Items) == 0 {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, errors.New("at least one item is required"))
+		return
+	}
+	if len(req.Items) > maxBatchSize {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, fmt.Errorf("a batch accepts at most %d items", maxBatchSize))
+		return
+	}
+
+	results := make([]api.TransmutationBatchItemResultDto, len(req.Items))
+	items := []batchItem{}
+	for i, itemReq := range req.Items {
+		results[i].Index = i
+		t, outcome, status, err := prepareTransmutation(h.Engine, itemReq, user)
+		if err = h.checkPrepared(r, itemReq, user.Email, outcome, err); err != nil && status == 0 {
+			status = http.StatusUnprocessableEntity
+		}
+		if err != nil {
+			if req.Mode == models.BatchModeAllOrNothing {
+				h.HandleErr(w, status, r.URL.Path, fmt.Errorf("item %d: %w", i, err))
+				return
+			}
+			results[i].Status = status
+			results[i].Error = err.Error()
+			continue
+		}
+		items = append(items, batchItem{
+			index:   i,
+			t:       t,
+			outcome: outcome,
+			flagged: outcome.Exchange != nil && outcome.Exchange.Violated,
+		})
+	}
+
+	batch := &models.TransmutationBatch{UserID: user.ID, Mode: req.Mode, RequestedBy: user.Email}
+	if req.Mode == models.BatchModeAllOrNothing {
+		ts := make([]*models.Transmutation, 0, len(items))
+		for _, item := range items {
+			ts = append(ts, item.t)
 		}
-		details := "transmutation queued for processing"
-		if strings.TrimSpace(t.Formula) != "" {
-			details = "formula: " + t.Formula
+		if err := h.Repo.CreateBatch(batch, ts, user.Email); err != nil {
+			status, cause := storeErrorStatus(err)
+			var itemErr *repository.BatchItemError
+			if errors.As(err, &itemErr) {
+				cause = fmt.Errorf("item %d: %w", itemErr.Index, cause)
+			}
+			h.HandleErr(w, status, r.URL.Path, cause)
+			return
 		}
-		if err := h.Dispatcher.EnqueueAudit("transmutation_created", "transmutation", t.ID, user.Email, details); err != nil {
+	} else {
+		created := items[:0]
+		for _, item := range items {
+			if err := h.Repo.CreateInBatch(batch, item.t, user.Email); err != nil {
+				status, cause := storeErrorStatus(err)
+				results[item.index].Status = status
+				results[item.index].Error = cause.Error()
+				continue
+			}
+			created = append(created, item)
+		}
+		items = created
+		// Si no se creó ninguna no hay lote: se responde con el error de los elementos.
+		if len(items) == 0 {
+			h.HandleErr(w, batchFailureStatus(results), r.URL.Path, batchFailure(results))
+			return
+		}
+	}
+
+	progress := map[string]int{}
+	for _, item := range items {
+		h.afterCreate(r, item.t, user.Email, item.flagged, item.outcome)
+		progress[item.t.Status]++
+		results[item.index].Status = http.StatusCreated
+		results[item.index].Transmutation = TransmutationToResponse(item.t)
+	}
+	if h.Dispatcher != nil {
+		details := fmt.Sprintf("%s: %d of %d created", batch.Mode, len(items), len(req.Items))
+		if err := h.Dispatcher.EnqueueAudit("transmutation_batch_created", "transmutation_batch", batch.ID, user.Email, details); err != nil {
 			h.ReportAsyncError(r.URL.Path, err)
 		}
 	}
 
-	resp := &api.TransmutationResponseDto{
-		ID:         int(t.ID),
-		UserID:     t.UserID,
-		MaterialID: t.MaterialID,
-		Formula:    t.Formula,
-		Quantity:   t.Quantity,
-		Status:     t.Status,
-		Result:     t.Result,
-		CreatedAt:  t.CreatedAt.Format(time.RFC3339),
-		UpdatedAt:  t.UpdatedAt.Format(time.RFC3339),
+	resp := &api.TransmutationBatchResponseDto{
+		ID:        batch.ID,
+		UserID:    batch.UserID,
+		Mode:      batch.Mode,
+		Total:     len(items),
+		Progress:  progress,
+		Results:   results,
+		CreatedAt: batch.CreatedAt.Format(time.RFC3339),
+	}
+	if h.Broadcast != nil {
+		h.Broadcast("transmutation.batch", resp)
 	}
-	h.emitTransmutationEvent(t)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(map[string]interface{}{"data": resp})
 	h.Log(http.StatusCreated, r.URL.Path, start)
 }
 
+// batchFailureStatus es el código común a todos los elementos fallidos o,
+// si difieren, 422.
+func batchFailureStatus(results []api.TransmutationBatchItemResultDto) int {
+	status := results[0].Status
+	for _, result := range results[1:] {
+		if result.Status != status {
+			return http.StatusUnprocessableEntity
+		}
+	}
+	return status
+}
+
+func batchFailure(results []api.TransmutationBatchItemResultDto) error {
+	causes := make([]string, 0, len(results))
+	for _, result := range results {
+		causes = append(causes, fmt.Sprintf("item %d: %s", result.Index, result.Error))
+	}
+	return fmt.Errorf("no item could be created: %s", strings.Join(causes, "; "))
+}
+
+// GET /transmutations/batches/{id}
+func (h *TransmutationHandler) GetBatch(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, err)
+		return
+	}
+	user := h.currentUser(r)
+	if user == nil {
+		h.HandleErr(w, http.StatusUnauthorized, r.URL.Path, errors.New("unauthorized"))
+		return
+	}
+	batch, err := h.Repo.FindBatch(id)
+	if err != nil {
+		h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
+		return
+	}
+	if batch == nil {
+		h.HandleErr(w, http.StatusNotFound, r.URL.Path, errors.New("batch not found"))
+		return
+	}
+	if user.Role != "supervisor" && batch.UserID != user.ID {
+		h.HandleErr(w, http.StatusForbidden, r.URL.Path, errors.New("forbidden"))
+		return
+	}
+
+	resp := &api.TransmutationBatchResponseDto{
+		ID:             batch.ID,
+		UserID:         batch.UserID,
+		Mode:           batch.Mode,
+		Total:          len(batch.Transmutations),
+		Progress:       map[string]int{},
+		Transmutations: []*api.TransmutationResponseDto{},
+		CreatedAt:      batch.CreatedAt.Format(time.RFC3339),
+	}
+	for i := range batch.Transmutations {
+		t := &batch.Transmutations[i]
+		resp.Progress[t.Status]++
+		resp.Transmutations = append(resp.Transmutations, TransmutationToResponse(t))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": resp})
+	h.Log(http.StatusOK, r.URL.Path, start)
+}
+
 func (h *TransmutationHandler) GetAll(w http.ResponseWriter, r *http.Request) {
 	start := time.Now()
 	user := h.currentUser(r)
@@ -174,17 +755,7 @@ func (h *TransmutationHandler) GetAll(w http.ResponseWriter, r *http.Request) {
 	}
 	resp := []*api.TransmutationResponseDto{}
 	for _, t := range transmutations {
-		resp = append(resp, &api.TransmutationResponseDto{
-			ID:         int(t.ID),
-			UserID:     t.UserID,
-			MaterialID: t.MaterialID,
-			Formula:    t.Formula,
-			Quantity:   t.Quantity,
-			Status:     t.Status,
-			Result:     t.Result,
-			CreatedAt:  t.CreatedAt.Format(time.RFC3339),
-			UpdatedAt:  t.UpdatedAt.Format(time.RFC3339),
-		})
+		resp = append(resp, TransmutationToResponse(t))
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{"data": resp})
@@ -216,17 +787,7 @@ func (h *TransmutationHandler) GetByID(w http.ResponseWriter, r *http.Request) {
 		h.HandleErr(w, http.StatusForbidden, r.URL.Path, errors.New("forbidden"))
 		return
 	}
-	resp := &api.TransmutationResponseDto{
-		ID:         int(t.ID),
-		UserID:     t.UserID,
-		MaterialID: t.MaterialID,
-		Formula:    t.Formula,
-		Quantity:   t.Quantity,
-		Status:     t.Status,
-		Result:     t.Result,
-		CreatedAt:  t.CreatedAt.Format(time.RFC3339),
-		UpdatedAt:  t.UpdatedAt.Format(time.RFC3339),
-	}
+	resp := TransmutationToResponse(t)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{"data": resp})
 	h.Log(http.StatusOK, r.URL.Path, start)
@@ -249,16 +810,17 @@ func (h *TransmutationHandler) Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.Repo.Delete(t); err != nil {
+	user := h.currentUser(r)
+	email := ""
+	if user != nil {
+		email = user.Email
+	}
+	if err := h.Repo.Delete(t, email); err != nil {
 		h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
 		return
 	}
 	if h.Dispatcher != nil {
-		user := h.currentUser(r)
-		email := ""
-		if user != nil {
-			email = user.Email
-		}
+		h.Dispatcher.CancelTransmutationProcessing(t.ID)
 		if err := h.Dispatcher.EnqueueAudit("transmutation_deleted", "transmutation", t.ID, email, "transmutation removed"); err != nil {
 			h.ReportAsyncError(r.URL.Path, err)
 		}
@@ -267,6 +829,7 @@ func (h *TransmutationHandler) Delete(w http.ResponseWriter, r *http.Request) {
 	if h.Broadcast != nil {
 		h.Broadcast("transmutation.deleted", map[string]interface{}{"id": t.ID})
 	}
+	h.advancePipeline(r, t, email)
 
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -295,47 +858,523 @@ func (h *TransmutationHandler) Edit(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	var changes repository.TransmutationChanges
 	if req.Formula != nil {
-		t.Formula = *req.Formula
+		// La fórmula del catálogo es la de una versión concreta; para cambiarla se publica otra versión.
+		if t.FormulaID != nil && strings.TrimSpace(*req.Formula) != t.Formula {
+			h.HandleErr(w, http.StatusConflict, r.URL.Path, errors.New("formula comes from the catalogue and cannot be edited"))
+			return
+		}
+		if t.RecipeID == nil || strings.TrimSpace(*req.Formula) != "" {
+			if _, err := formula.Parse(*req.Formula); err != nil {
+				h.HandleErr(w, http.StatusBadRequest, r.URL.Path, err)
+				return
+			}
+		}
+		edited := strings.TrimSpace(*req.Formula)
+		check := *t
+		check.Formula = edited
+		if err := h.Engine.CheckReactants(&check); err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, alchemy.ErrReactantMismatch) {
+				status = http.StatusBadRequest
+			}
+			h.HandleErr(w, status, r.URL.Path, err)
+			return
+		}
+		changes.Formula = &edited
 	}
-	if req.Status != nil {
-		t.Status = *req.Status
+	changes.Result = req.Result
+
+	user := h.currentUser(r)
+	email := ""
+	if user != nil {
+		email = user.Email
 	}
-	if req.Result != nil {
-		t.Result = *req.Result
+	reason := ""
+	if req.Reason != nil {
+		reason = strings.TrimSpace(*req.Reason)
 	}
 
-	t, err = h.Repo.Save(t)
-	if err != nil {
-		h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
-		return
-	}
-	if h.Dispatcher != nil {
-		user := h.currentUser(r)
-		email := ""
-		if user != nil {
-			email = user.Email
+	status := t.Status
+	if req.Status != nil {
+		status = strings.ToUpper(strings.TrimSpace(*req.Status))
+		if !models.IsTransmutationStatus(status) {
+			h.HandleErr(w, http.StatusBadRequest, r.URL.Path, errors.New("invalid status value"))
+			return
 		}
-		if err := h.Dispatcher.EnqueueAudit("transmutation_updated", "transmutation", t.ID, email, "manual update"); err != nil {
+	}
+
+	action := "transmutation_updated"
+	details := "manual update"
+	if status != t.Status && !models.CanTransitionTransmutation(t.Status, status) {
+		err = &repository.TransitionError{From: t.Status, To: status}
+	} else if status == t.Status || changes.Formula != nil || changes.Result != nil {
+		// Los campos se editan con la fila bloqueada y solo si sigue en el
+		// estado leído, para no pisar lo que haya hecho el worker entretanto.
+		var edited *models.Transmutation
+		if edited, err = h.Repo.Edit(t.ID, t.Status, changes); err == nil {
+			t = edited
+		}
+	}
+	switch {
+	case err != nil || status == t.Status:
+	case status == models.TransmutationStatusPending && t.Status == models.TransmutationStatusAwaitingApproval:
+		t, err = h.Repo.Approve(t.ID, email, reason)
+		action = "transmutation_approved"
+		details = repository.ReviewReason("approved", reason)
+	case status == models.TransmutationStatusRejected:
+		t, err = h.Repo.Reject(t.ID, email, reason)
+		action = "transmutation_rejected"
+		details = repository.ReviewReason("rejected", reason)
+	case status == models.TransmutationStatusPending:
+		// Volver a PENDING es un reintento: reserva de nuevo y reencola.
+		t, err = h.Repo.Retry(t.ID, email, h.Engine.MaxRetries())
+		action = "transmutation_retried"
+		details = "manual retry"
+	case status == models.TransmutationStatusCancelled:
+		// La cancelación manual también devuelve el material reservado.
+		t, err = h.Repo.Cancel(t.ID, email, reason)
+		action = "transmutation_cancelled"
+		details = "manual cancel; reserved material refunded"
+	default:
+		from := t.Status
+		t, err = h.Repo.UpdateStatus(t, status, email, reason)
+		details = fmt.Sprintf("manual update: %s -> %s", from, status)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrTransmutationNotFound):
+			h.HandleErr(w, http.StatusNotFound, r.URL.Path, errors.New("transmutation not found"))
+		case errors.Is(err, repository.ErrInvalidTransmutationState), errors.Is(err, repository.ErrRetryLimitReached),
+			errors.Is(err, repository.ErrTransmutationChanged):
+			h.HandleErr(w, http.StatusConflict, r.URL.Path, err)
+		case errors.Is(err, repository.ErrMaterialNotFound):
+			h.HandleErr(w, http.StatusBadRequest, r.URL.Path, errors.New("material not found"))
+		case errors.Is(err, repository.ErrLocationNotFound):
+			h.HandleErr(w, http.StatusBadRequest, r.URL.Path, err)
+		case errors.Is(err, repository.ErrInsufficientMaterial):
+			h.HandleErr(w, http.StatusBadRequest, r.URL.Path, errors.New("insufficient material quantity"))
+		case errors.Is(err, repository.ErrQuotaExceeded):
+			h.HandleErr(w, http.StatusTooManyRequests, r.URL.Path, err)
+		default:
+			h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
+		}
+		return
+	}
+	if h.Dispatcher != nil {
+		switch action {
+		case "transmutation_cancelled":
+			h.Dispatcher.CancelTransmutationProcessing(t.ID)
+		case "transmutation_retried":
+			if err := h.Dispatcher.EnqueueTransmutationProcessing(t.ID, email); err != nil {
+				h.ReportAsyncError(r.URL.Path, err)
+			}
+		case "transmutation_approved":
+			if err := h.enqueueProcessing(t, email); err != nil {
+				h.ReportAsyncError(r.URL.Path, err)
+			}
+		}
+		if err := h.Dispatcher.EnqueueAudit(action, "transmutation", t.ID, email, details); err != nil {
 			h.ReportAsyncError(r.URL.Path, err)
 		}
 	}
 
-	resp := &api.TransmutationResponseDto{
-		ID:         int(t.ID),
-		UserID:     t.UserID,
-		MaterialID: t.MaterialID,
-		Formula:    t.Formula,
-		Quantity:   t.Quantity,
-		Status:     t.Status,
-		Result:     t.Result,
-		CreatedAt:  t.CreatedAt.Format(time.RFC3339),
-		UpdatedAt:  t.UpdatedAt.Format(time.RFC3339),
-	}
+	resp := TransmutationToResponse(t)
 	h.emitTransmutationEvent(t)
+	h.advancePipeline(r, t, email)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusAccepted)
 	json.NewEncoder(w).Encode(map[string]interface{}{"data": resp})
 	h.Log(http.StatusAccepted, r.URL.Path, start)
 }
+
+// POST /transmutations/{id}/cancel
+func (h *TransmutationHandler) Cancel(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, err)
+		return
+	}
+	user := h.currentUser(r)
+	if user == nil {
+		h.HandleErr(w, http.StatusUnauthorized, r.URL.Path, errors.New("unauthorized"))
+		return
+	}
+
+	t, err := h.Repo.FindById(id)
+	if err != nil {
+		h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
+		return
+	}
+	if t == nil {
+		h.HandleErr(w, http.StatusNotFound, r.URL.Path, errors.New("transmutation not found"))
+		return
+	}
+	if user.Role != "supervisor" && t.UserID != user.ID {
+		h.HandleErr(w, http.StatusForbidden, r.URL.Path, errors.New("forbidden"))
+		return
+	}
+
+	// El cuerpo es opcional: uno vacío, aunque llegue chunked, cancela sin motivo.
+	var req api.TransmutationCancelRequestDto
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, err)
+		return
+	}
+
+	t, err = h.Repo.Cancel(t.ID, user.Email, strings.TrimSpace(req.Reason))
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrTransmutationNotFound):
+			h.HandleErr(w, http.StatusNotFound, r.URL.Path, errors.New("transmutation not found"))
+		case errors.Is(err, repository.ErrInvalidTransmutationState):
+			h.HandleErr(w, http.StatusConflict, r.URL.Path, errors.New("only PENDING, PROCESSING or AWAITING_APPROVAL transmutations can be cancelled"))
+		default:
+			h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
+		}
+		return
+	}
+
+	if h.Dispatcher != nil {
+		h.Dispatcher.CancelTransmutationProcessing(t.ID)
+		if err := h.Dispatcher.EnqueueAudit("transmutation_cancelled", "transmutation", t.ID, user.Email, t.Result+"; reserved material refunded"); err != nil {
+			h.ReportAsyncError(r.URL.Path, err)
+		}
+	}
+
+	h.emitTransmutationEvent(t)
+	h.advancePipeline(r, t, user.Email)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": TransmutationToResponse(t)})
+	h.Log(http.StatusOK, r.URL.Path, start)
+}
+
+// POST /transmutations/{id}/retry
+func (h *TransmutationHandler) Retry(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, err)
+		return
+	}
+	user := h.currentUser(r)
+	if user == nil {
+		h.HandleErr(w, http.StatusUnauthorized, r.URL.Path, errors.New("unauthorized"))
+		return
+	}
+
+	t, err := h.Repo.FindById(id)
+	if err != nil {
+		h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
+		return
+	}
+	if t == nil {
+		h.HandleErr(w, http.StatusNotFound, r.URL.Path, errors.New("transmutation not found"))
+		return
+	}
+	if user.Role != "supervisor" && t.UserID != user.ID {
+		h.HandleErr(w, http.StatusForbidden, r.URL.Path, errors.New("forbidden"))
+		return
+	}
+
+	t, err = h.Repo.Retry(t.ID, user.Email, h.Engine.MaxRetries())
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrTransmutationNotFound):
+			h.HandleErr(w, http.StatusNotFound, r.URL.Path, errors.New("transmutation not found"))
+		case errors.Is(err, repository.ErrInvalidTransmutationState):
+			h.HandleErr(w, http.StatusConflict, r.URL.Path, errors.New("only FAILED transmutations can be retried"))
+		case errors.Is(err, repository.ErrRetryLimitReached):
+			h.HandleErr(w, http.StatusConflict, r.URL.Path, fmt.Errorf("%w (max %d)", err, h.Engine.MaxRetries()))
+		case errors.Is(err, repository.ErrMaterialNotFound):
+			h.HandleErr(w, http.StatusBadRequest, r.URL.Path, errors.New("material not found"))
+		case errors.Is(err, repository.ErrLocationNotFound):
+			h.HandleErr(w, http.StatusBadRequest, r.URL.Path, err)
+		case errors.Is(err, repository.ErrInsufficientMaterial):
+			h.HandleErr(w, http.StatusBadRequest, r.URL.Path, errors.New("insufficient material quantity"))
+		case errors.Is(err, repository.ErrQuotaExceeded):
+			h.HandleErr(w, http.StatusTooManyRequests, r.URL.Path, err)
+		default:
+			h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
+		}
+		return
+	}
+
+	if h.Dispatcher != nil {
+		if err := h.Dispatcher.EnqueueTransmutationProcessing(t.ID, user.Email); err != nil {
+			h.ReportAsyncError(r.URL.Path, err)
+		}
+		if err := h.Dispatcher.EnqueueAudit("transmutation_retried", "transmutation", t.ID, user.Email, t.Result); err != nil {
+			h.ReportAsyncError(r.URL.Path, err)
+		}
+	}
+
+	h.emitTransmutationEvent(t)
+	// Un paso reintentado reabre su pipeline y los pasos que había omitido.
+	h.advancePipeline(r, t, user.Email)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": TransmutationToResponse(t)})
+	h.Log(http.StatusAccepted, r.URL.Path, start)
+}
+
+// PUT /transmutations/{id}/schedule
+func (h *TransmutationHandler) Reschedule(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, err)
+		return
+	}
+	user := h.currentUser(r)
+	if user == nil {
+		h.HandleErr(w, http.StatusUnauthorized, r.URL.Path, errors.New("unauthorized"))
+		return
+	}
+
+	t, err := h.Repo.FindById(id)
+	if err != nil {
+		h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
+		return
+	}
+	if t == nil {
+		h.HandleErr(w, http.StatusNotFound, r.URL.Path, errors.New("transmutation not found"))
+		return
+	}
+	if user.Role != "supervisor" && t.UserID != user.ID {
+		h.HandleErr(w, http.StatusForbidden, r.URL.Path, errors.New("forbidden"))
+		return
+	}
+
+	var req api.TransmutationScheduleRequestDto
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, err)
+		return
+	}
+	var at *time.Time
+	if req.ScheduledAt != nil && req.ScheduledAt.After(time.Now()) {
+		scheduledAt := req.ScheduledAt.UTC()
+		at = &scheduledAt
+	}
+
+	t, err = h.Repo.Reschedule(t.ID, at)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrTransmutationNotFound):
+			h.HandleErr(w, http.StatusNotFound, r.URL.Path, errors.New("transmutation not found"))
+		case errors.Is(err, repository.ErrNotScheduled):
+			h.HandleErr(w, http.StatusConflict, r.URL.Path, err)
+		default:
+			h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
+		}
+		return
+	}
+
+	if h.Dispatcher != nil {
+		details := "run now"
+		if at == nil {
+			// Sin hora: se descarta la ejecución diferida y se encola ya.
+			h.Dispatcher.CancelTransmutationProcessing(t.ID)
+		} else {
+			details = "scheduled at " + at.Format(time.RFC3339)
+		}
+		if err := h.enqueueProcessing(t, user.Email); err != nil {
+			h.ReportAsyncError(r.URL.Path, err)
+		}
+		if err := h.Dispatcher.EnqueueAudit("transmutation_rescheduled", "transmutation", t.ID, user.Email, details); err != nil {
+			h.ReportAsyncError(r.URL.Path, err)
+		}
+	}
+
+	h.emitTransmutationEvent(t)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": TransmutationToResponse(t)})
+	h.Log(http.StatusOK, r.URL.Path, start)
+}
+
+// GET /transmutations/approvals
+func (h *TransmutationHandler) PendingApprovals(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	transmutations, err := h.Repo.FindByStatus(models.TransmutationStatusAwaitingApproval)
+	if err != nil {
+		h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
+		return
+	}
+	resp := make([]*api.TransmutationResponseDto, 0, len(transmutations))
+	for _, t := range transmutations {
+		resp = append(resp, TransmutationToResponse(t))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": resp})
+	h.Log(http.StatusOK, r.URL.Path, start)
+}
+
+// POST /transmutations/{id}/approve
+func (h *TransmutationHandler) Approve(w http.ResponseWriter, r *http.Request) {
+	h.review(w, r, true)
+}
+
+// POST /transmutations/{id}/reject
+func (h *TransmutationHandler) Reject(w http.ResponseWriter, r *http.Request) {
+	h.review(w, r, false)
+}
+
+// review resuelve una transmutación retenida. Al rechazar, el comentario es
+// obligatorio y el material reservado vuelve al inventario.
+func (h *TransmutationHandler) review(w http.ResponseWriter, r *http.Request, approve bool) {
+	start := time.Now()
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, err)
+		return
+	}
+	user := h.currentUser(r)
+	if user == nil {
+		h.HandleErr(w, http.StatusUnauthorized, r.URL.Path, errors.New("unauthorized"))
+		return
+	}
+	// Un cuerpo vacío, aunque llegue chunked, es una revisión sin comentario.
+	var req api.TransmutationReviewRequestDto
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, err)
+		return
+	}
+	comment := strings.TrimSpace(req.Comment)
+	if !approve && comment == "" {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, errors.New("comment required"))
+		return
+	}
+
+	var (
+		t      *models.Transmutation
+		action = "transmutation_approved"
+	)
+	if approve {
+		t, err = h.Repo.Approve(uint(id), user.Email, comment)
+	} else {
+		t, err = h.Repo.Reject(uint(id), user.Email, comment)
+		action = "transmutation_rejected"
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrTransmutationNotFound):
+			h.HandleErr(w, http.StatusNotFound, r.URL.Path, errors.New("transmutation not found"))
+		case errors.Is(err, repository.ErrInvalidTransmutationState):
+			h.HandleErr(w, http.StatusConflict, r.URL.Path, errors.New("only AWAITING_APPROVAL transmutations can be reviewed"))
+		default:
+			h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
+		}
+		return
+	}
+
+	if h.Dispatcher != nil {
+		if approve {
+			if err := h.enqueueProcessing(t, user.Email); err != nil {
+				h.ReportAsyncError(r.URL.Path, err)
+			}
+		}
+		if err := h.Dispatcher.EnqueueAudit(action, "transmutation", t.ID, user.Email, repository.ReviewReason(strings.TrimPrefix(action, "transmutation_"), comment)); err != nil {
+			h.ReportAsyncError(r.URL.Path, err)
+		}
+	}
+
+	resp := TransmutationToResponse(t)
+	h.emitTransmutationEvent(t)
+	if h.Broadcast != nil {
+		h.Broadcast("transmutation.approval_resolved", resp)
+	}
+	h.advancePipeline(r, t, user.Email)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": resp})
+	h.Log(http.StatusOK, r.URL.Path, start)
+}
+
+// GET /transmutations/{id}/history
+func (h *TransmutationHandler) History(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, err)
+		return
+	}
+	user := h.currentUser(r)
+	if user == nil {
+		h.HandleErr(w, http.StatusUnauthorized, r.URL.Path, errors.New("unauthorized"))
+		return
+	}
+	t, err := h.Repo.FindById(id)
+	if err != nil {
+		h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
+		return
+	}
+	if t == nil {
+		h.HandleErr(w, http.StatusNotFound, r.URL.Path, errors.New("transmutation not found"))
+		return
+	}
+	if user.Role != "supervisor" && t.UserID != user.ID {
+		h.HandleErr(w, http.StatusForbidden, r.URL.Path, errors.New("forbidden"))
+		return
+	}
+
+	history, err := h.Repo.FindHistory(t.ID)
+	if err != nil {
+		h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
+		return
+	}
+	resp := make([]*api.TransmutationTransitionDto, 0, len(history))
+	for _, entry := range history {
+		resp = append(resp, &api.TransmutationTransitionDto{
+			ID:              entry.ID,
+			TransmutationID: entry.TransmutationID,
+			FromStatus:      entry.FromStatus,
+			ToStatus:        entry.ToStatus,
+			Actor:           entry.Actor,
+			Reason:          entry.Reason,
+			CreatedAt:       entry.CreatedAt.Format(time.RFC3339),
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": resp})
+	h.Log(http.StatusOK, r.URL.Path, start)
+}
+
+// GET /me/quotas
+func (h *TransmutationHandler) MyQuotas(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	user := h.currentUser(r)
+	if user == nil {
+		h.HandleErr(w, http.StatusUnauthorized, r.URL.Path, errors.New("unauthorized"))
+		return
+	}
+	rank, usages, err := h.Repo.QuotaUsage(user.ID)
+	if err != nil {
+		h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
+		return
+	}
+	resp := &api.QuotaSummaryDto{UserID: user.ID, Rank: rank, Quotas: []api.QuotaUsageDto{}}
+	for _, u := range usages {
+		dto := api.QuotaUsageDto{
+			Kind:       "active",
+			Scope:      u.Scope,
+			Material:   u.Quota.Material,
+			MaterialID: u.MaterialID,
+			Period:     u.Quota.Period,
+			Limit:      u.Limit,
+			Used:       u.Used,
+			Remaining:  u.Remaining,
+		}
+		if u.Quota.Material != "" {
+			dto.Kind = "material"
+		}
+		if u.ResetsAt != nil {
+			dto.ResetsAt = u.ResetsAt.Format(time.RFC3339)
+		}
+		resp.Quotas = append(resp.Quotas, dto)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": resp})
+	h.Log(http.StatusOK, r.URL.Path, start)
+}
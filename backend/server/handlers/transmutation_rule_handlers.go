@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"backend-avanzada/alchemy"
+	"backend-avanzada/api"
+	"backend-avanzada/models"
+	"backend-avanzada/repository"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+type TransmutationRuleHandler struct {
+	Repo             *repository.TransmutationRuleRepository
+	Dispatcher       AsyncDispatcher
+	CurrentUser      func(*http.Request) *api.AuthenticatedUser
+	ReportAsyncError func(string, error)
+	HandleErr        func(http.ResponseWriter, int, string, error)
+	Log              func(int, string, time.Time)
+}
+
+func NewTransmutationRuleHandler(
+	repo *repository.TransmutationRuleRepository,
+	dispatcher AsyncDispatcher,
+	currentUser func(*http.Request) *api.AuthenticatedUser,
+	reportAsyncError func(string, error),
+	handleErr func(http.ResponseWriter, int, string, error),
+	log func(int, string, time.Time),
+) *TransmutationRuleHandler {
+	return &TransmutationRuleHandler{
+		Repo:             repo,
+		Dispatcher:       dispatcher,
+		CurrentUser:      currentUser,
+		ReportAsyncError: reportAsyncError,
+		HandleErr:        handleErr,
+		Log:              log,
+	}
+}
+
+func (h *TransmutationRuleHandler) userEmail(r *http.Request) string {
+	if h.CurrentUser != nil {
+		if user := h.CurrentUser(r); user != nil {
+			return user.Email
+		}
+	}
+	return ""
+}
+
+// TransmutationRuleFromRequest construye la regla a partir de la petición o
+// de una entrada del fichero de reglas. Sin "enabled" la regla queda activa.
+func TransmutationRuleFromRequest(req api.TransmutationRuleRequestDto) (*models.TransmutationRule, error) {
+	rule := &models.TransmutationRule{
+		Name:           req.Name,
+		Description:    req.Description,
+		FormulaPattern: req.FormulaPattern,
+		Categories:     req.Categories,
+		Roles:          req.Roles,
+		MinQuantity:    req.MinQuantity,
+		MaxQuantity:    req.MaxQuantity,
+		Action:         req.Action,
+		Enabled:        req.Enabled == nil || *req.Enabled,
+	}
+	if err := alchemy.ValidateRule(rule); err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
+
+func transmutationRuleToResponse(rule *models.TransmutationRule) *api.TransmutationRuleResponseDto {
+	resp := &api.TransmutationRuleResponseDto{
+		ID:             rule.ID,
+		Name:           rule.Name,
+		Description:    rule.Description,
+		FormulaPattern: rule.FormulaPattern,
+		Categories:     rule.Categories,
+		Roles:          rule.Roles,
+		MinQuantity:    rule.MinQuantity,
+		MaxQuantity:    rule.MaxQuantity,
+		Action:         rule.Action,
+		Enabled:        rule.Enabled,
+		CreatedAt:      rule.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:      rule.UpdatedAt.Format(time.RFC3339),
+	}
+	if resp.Categories == nil {
+		resp.Categories = []string{}
+	}
+	if resp.Roles == nil {
+		resp.Roles = []string{}
+	}
+	return resp
+}
+
+// auditRuleHits registra una auditoría por cada regla que coincidió,
+// nombrándola. outcome indica qué pasó con la transmutación ("matched", "rejected"...).
+func auditRuleHits(dispatcher AsyncDispatcher, entity string, entityID uint, email, outcome string, hits []models.RuleHit) error {
+	for _, hit := range hits {
+		details := outcome + ": rule " + alchemy.DescribeRuleHit(hit)
+		if err := dispatcher.EnqueueAudit("transmutation_rule_hit", entity, entityID, email, details); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *TransmutationRuleHandler) GetAll(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	rules, err := h.Repo.FindAll()
+	if err != nil {
+		h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
+		return
+	}
+	resp := make([]*api.TransmutationRuleResponseDto, 0, len(rules))
+	for _, rule := range rules {
+		resp = append(resp, transmutationRuleToResponse(rule))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": resp})
+	h.Log(http.StatusOK, r.URL.Path, start)
+}
+
+func (h *TransmutationRuleHandler) GetByID(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, err)
+		return
+	}
+	rule, err := h.Repo.FindById(id)
+	if err != nil {
+		h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
+		return
+	}
+	if rule == nil {
+		h.HandleErr(w, http.StatusNotFound, r.URL.Path, errors.New("transmutation rule not found"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": transmutationRuleToResponse(rule)})
+	h.Log(http.StatusOK, r.URL.Path, start)
+}
+
+func (h *TransmutationRuleHandler) Create(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	var req api.TransmutationRuleRequestDto
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, err)
+		return
+	}
+	rule, err := TransmutationRuleFromRequest(req)
+	if err != nil {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, err)
+		return
+	}
+	rule, err = h.Repo.Save(rule)
+	if err != nil {
+		h.handleSaveErr(w, r, err)
+		return
+	}
+	if h.Dispatcher != nil {
+		if err := h.Dispatcher.EnqueueAudit("transmutation_rule_created", "transmutation_rule", rule.ID, h.userEmail(r), rule.Name+" ("+rule.Action+")"); err != nil {
+			h.ReportAsyncError(r.URL.Path, err)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": transmutationRuleToResponse(rule)})
+	h.Log(http.StatusCreated, r.URL.Path, start)
+}
+
+func (h *TransmutationRuleHandler) Edit(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, err)
+		return
+	}
+	current, err := h.Repo.FindById(id)
+	if err != nil {
+		h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
+		return
+	}
+	if current == nil {
+		h.HandleErr(w, http.StatusNotFound, r.URL.Path, errors.New("transmutation rule not found"))
+		return
+	}
+	var req api.TransmutationRuleRequestDto
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, err)
+		return
+	}
+	rule, err := TransmutationRuleFromRequest(req)
+	if err != nil {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, err)
+		return
+	}
+	rule.Model = current.Model
+	rule, err = h.Repo.Save(rule)
+	if err != nil {
+		h.handleSaveErr(w, r, err)
+		return
+	}
+	if h.Dispatcher != nil {
+		if err := h.Dispatcher.EnqueueAudit("transmutation_rule_updated", "transmutation_rule", rule.ID, h.userEmail(r), rule.Name+" ("+rule.Action+")"); err != nil {
+			h.ReportAsyncError(r.URL.Path, err)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": transmutationRuleToResponse(rule)})
+	h.Log(http.StatusAccepted, r.URL.Path, start)
+}
+
+func (h *TransmutationRuleHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		h.HandleErr(w, http.StatusBadRequest, r.URL.Path, err)
+		return
+	}
+	rule, err := h.Repo.FindById(id)
+	if err != nil {
+		h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
+		return
+	}
+	if rule == nil {
+		h.HandleErr(w, http.StatusNotFound, r.URL.Path, errors.New("transmutation rule not found"))
+		return
+	}
+	if err := h.Repo.Delete(rule); err != nil {
+		h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
+		return
+	}
+	if h.Dispatcher != nil {
+		if err := h.Dispatcher.EnqueueAudit("transmutation_rule_deleted", "transmutation_rule", rule.ID, h.userEmail(r), rule.Name); err != nil {
+			h.ReportAsyncError(r.URL.Path, err)
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *TransmutationRuleHandler) handleSaveErr(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, repository.ErrRuleNameTaken) {
+		h.HandleErr(w, http.StatusConflict, r.URL.Path, err)
+		return
+	}
+	h.HandleErr(w, http.StatusInternalServerError, r.URL.Path, err)
+}
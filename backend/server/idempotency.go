@@ -0,0 +1,160 @@
+package server
+
+import (
+	"backend-avanzada/models"
+	"backend-avanzada/repository"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	idempotencyHeader = "Idempotency-Key"
+	// DefaultIdempotencyTTL es cuánto se guarda una respuesta si la configuración no indica otro plazo.
+	DefaultIdempotencyTTL = 24 * time.Hour
+	// idempotencyLease es cuánto retiene una clave la petición que la está
+	// procesando. Si el proceso muere sin completarla, pasado este plazo un
+	// reintento puede tomarla en lugar de recibir 409 hasta que caduque.
+	idempotencyLease = 2 * time.Minute
+)
+
+// idempotencyRecorder copia la respuesta del handler mientras la escribe.
+type idempotencyRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *idempotencyRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *idempotencyRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
+
+// requestHash identifica la petición por método, ruta y cuerpo. Un cuerpo
+// JSON se normaliza para que el orden de las claves o los espacios no cuenten.
+func requestHash(r *http.Request, body []byte) string {
+	var decoded interface{}
+	if err := json.Unmarshal(body, &decoded); err == nil {
+		if normalized, err := json.Marshal(decoded); err == nil {
+			body = normalized
+		}
+	}
+	sum := sha256.New()
+	sum.Write([]byte(r.Method + " " + r.URL.Path + "\n"))
+	sum.Write(body)
+	return hex.EncodeToString(sum.Sum(nil))
+}
+
+// Idempotent hace que next respete la cabecera Idempotency-Key: la primera
+// respuesta se guarda y se repite ante reintentos con la misma clave dentro
+// del TTL. Reutilizar la clave con otra petición responde 422. Debe ir detrás
+// de AuthMiddleware, porque las claves son por usuario.
+func (s *Server) Idempotent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := strings.TrimSpace(r.Header.Get(idempotencyHeader))
+		if key == "" || s.IdempotencyRepository == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > 255 {
+			s.HandleError(w, http.StatusBadRequest, r.URL.Path, errors.New("idempotency key is too long"))
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			s.HandleError(w, http.StatusBadRequest, r.URL.Path, err)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		hash := requestHash(r, body)
+		scope := "anonymous"
+		if claims := GetAuthClaims(r); claims != nil {
+			scope = fmt.Sprintf("user:%d", claims.ID)
+		}
+		now := time.Now().UTC()
+		record, acquired, err := s.IdempotencyRepository.Begin(&models.IdempotencyRecord{
+			Scope:          scope,
+			IdempotencyKey: key,
+			Method:         r.Method,
+			Path:           r.URL.Path,
+			RequestHash:    hash,
+			ExpiresAt:      now.Add(s.idempotencyTTL),
+			LockedUntil:    now.Add(idempotencyLease),
+		}, now)
+		if err != nil {
+			s.HandleError(w, http.StatusInternalServerError, r.URL.Path, err)
+			return
+		}
+		if !acquired {
+			switch {
+			case record.RequestHash != hash:
+				s.HandleError(w, http.StatusUnprocessableEntity, r.URL.Path, errors.New("idempotency key was already used with a different request"))
+			case !record.Completed:
+				s.HandleError(w, http.StatusConflict, r.URL.Path, errors.New("a request with this idempotency key is still being processed"))
+			default:
+				if record.ContentType != "" {
+					w.Header().Set("Content-Type", record.ContentType)
+				}
+				w.Header().Set("Idempotent-Replayed", "true")
+				w.WriteHeader(record.StatusCode)
+				w.Write(record.Body)
+			}
+			return
+		}
+
+		rec := &idempotencyRecorder{ResponseWriter: w}
+		defer func() {
+			// Un error interno o un pánico no se guardan: el cliente puede reintentar.
+			if p := recover(); p != nil {
+				s.releaseIdempotencyKey(record, r.URL.Path)
+				panic(p)
+			}
+			if rec.status == 0 || rec.status >= http.StatusInternalServerError {
+				s.releaseIdempotencyKey(record, r.URL.Path)
+				return
+			}
+			record.StatusCode = rec.status
+			record.ContentType = rec.Header().Get("Content-Type")
+			record.Body = rec.body.Bytes()
+			if err := s.IdempotencyRepository.Complete(record); err != nil {
+				s.logIdempotencyError(record, r.URL.Path, err)
+			}
+		}()
+		next.ServeHTTP(rec, r)
+	})
+}
+
+func (s *Server) releaseIdempotencyKey(record *models.IdempotencyRecord, path string) {
+	if err := s.IdempotencyRepository.Release(record); err != nil {
+		s.logIdempotencyError(record, path, err)
+	}
+}
+
+// logIdempotencyError registra un fallo al cerrar la reserva. Perderla no es
+// un error del servidor: la petición tardó más que idempotencyLease y un
+// reintento ya se hizo cargo de la clave.
+func (s *Server) logIdempotencyError(record *models.IdempotencyRecord, path string, err error) {
+	if errors.Is(err, repository.ErrIdempotencyLeaseLost) {
+		s.logger.Printf("[idempotency] %s: la clave %q la tomó un reintento; no se guarda esta respuesta", path, record.IdempotencyKey)
+		return
+	}
+	s.logger.Error(http.StatusInternalServerError, path, err)
+}
@@ -16,6 +16,13 @@ import (
 // redisQueueKey define la lista predeterminada utilizada para poner en cola las tareas.
 const redisQueueKey = "alchemy:tasks"
 
+// redisDelayedKey es el sorted set de tareas diferidas (puntuación = instante Unix de ejecución)
+// y redisDelayedPayloadsKey el hash con el cuerpo de cada una.
+const (
+	redisDelayedKey         = "alchemy:tasks:delayed"
+	redisDelayedPayloadsKey = "alchemy:tasks:delayed:payloads"
+)
+
 type RedisClient struct {
 	addr        string
 	dialTimeout time.Duration
@@ -113,6 +120,47 @@ func (c *RedisClient) BRPOP(ctx context.Context, key string) ([]byte, error) {
 	return payload, nil
 }
 
+// do ejecuta un comando en una conexión nueva y devuelve la respuesta ya interpretada.
+func (c *RedisClient) do(ctx context.Context, args ...string) (interface{}, error) {
+	conn, reader, err := c.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err := writeCommand(conn, args...); err != nil {
+		return nil, err
+	}
+	return parseRESP(ctx, reader)
+}
+
+// ZRANGEBYSCORE devuelve hasta limit miembros con puntuación menor o igual que max.
+func (c *RedisClient) ZRANGEBYSCORE(ctx context.Context, key string, max float64, limit int) ([]string, error) {
+	resp, err := c.do(ctx, "ZRANGEBYSCORE", key, "-inf", strconv.FormatFloat(max, 'f', -1, 64), "LIMIT", "0", strconv.Itoa(limit))
+	if err != nil {
+		return nil, err
+	}
+	arr, ok := resp.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected ZRANGEBYSCORE response: %v", resp)
+	}
+	members := make([]string, 0, len(arr))
+	for _, item := range arr {
+		b, ok := item.([]byte)
+		if !ok {
+			return nil, fmt.Errorf("unexpected ZRANGEBYSCORE member: %v", item)
+		}
+		members = append(members, string(b))
+	}
+	return members, nil
+}
+
+// EVAL ejecuta un script Lua de forma atómica en el servidor.
+func (c *RedisClient) EVAL(ctx context.Context, script string, keys []string, args ...string) (interface{}, error) {
+	cmd := append([]string{"EVAL", script, strconv.Itoa(len(keys))}, keys...)
+	return c.do(ctx, append(cmd, args...)...)
+}
+
 func writeCommand(conn net.Conn, args ...string) error {
 	var buf bytes.Buffer
 	fmt.Fprintf(&buf, "*%d\r\n", len(args))
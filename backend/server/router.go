@@ -52,7 +52,7 @@ func (s *Server) router() http.Handler {
 		// Mutaciones protegidas
 		router.Handle(
 			"/alchemists",
-			s.AuthMiddleware("supervisor")(http.HandlerFunc(alchHandler.Create)),
+			s.AuthMiddleware("supervisor")(s.Idempotent(http.HandlerFunc(alchHandler.Create))),
 		).Methods(http.MethodPost)
 		router.Handle(
 			"/alchemists/{id}",
@@ -82,7 +82,7 @@ func (s *Server) router() http.Handler {
 				s.AuthMiddleware("alchemist", "supervisor")(http.HandlerFunc(mh.GetByID)),
 			).Methods(http.MethodGet)
 			router.Handle("/missions",
-				s.AuthMiddleware("supervisor")(http.HandlerFunc(mh.Create)),
+				s.AuthMiddleware("supervisor")(s.Idempotent(http.HandlerFunc(mh.Create))),
 			).Methods(http.MethodPost)
 			router.Handle("/missions/{id}",
 				s.AuthMiddleware("supervisor")(http.HandlerFunc(mh.Edit)),
@@ -99,6 +99,7 @@ func (s *Server) router() http.Handler {
 		if s.TransmutationRepository != nil {
 			transHandler := handlers.NewTransmutationHandler(
 				s.TransmutationRepository,
+				s.TransmutationEngine,
 				dispatcher,
 				currentUser,
 				asyncReporter,
@@ -111,6 +112,11 @@ func (s *Server) router() http.Handler {
 				"/transmutations",
 				s.AuthMiddleware("alchemist", "supervisor")(http.HandlerFunc(transHandler.GetAll)),
 			).Methods(http.MethodGet)
+			// mux usa la primera ruta que coincide: las rutas fijas van antes que {id}.
+			router.Handle(
+				"/transmutations/approvals",
+				s.AuthMiddleware("supervisor")(http.HandlerFunc(transHandler.PendingApprovals)),
+			).Methods(http.MethodGet)
 			router.Handle(
 				"/transmutations/{id}",
 				s.AuthMiddleware("alchemist", "supervisor")(http.HandlerFunc(transHandler.GetByID)),
@@ -118,7 +124,57 @@ func (s *Server) router() http.Handler {
 
 			router.Handle(
 				"/transmutations",
-				s.AuthMiddleware("alchemist", "supervisor")(http.HandlerFunc(transHandler.Create)),
+				s.AuthMiddleware("alchemist", "supervisor")(s.Idempotent(http.HandlerFunc(transHandler.Create))),
+			).Methods(http.MethodPost)
+
+			router.Handle(
+				"/transmutations/{id}/history",
+				s.AuthMiddleware("alchemist", "supervisor")(http.HandlerFunc(transHandler.History)),
+			).Methods(http.MethodGet)
+
+			router.Handle(
+				"/transmutations/batch",
+				s.AuthMiddleware("alchemist", "supervisor")(s.Idempotent(http.HandlerFunc(transHandler.CreateBatch))),
+			).Methods(http.MethodPost)
+
+			router.Handle(
+				"/transmutations/batches/{id}",
+				s.AuthMiddleware("alchemist", "supervisor")(http.HandlerFunc(transHandler.GetBatch)),
+			).Methods(http.MethodGet)
+
+			router.Handle(
+				"/me/quotas",
+				s.AuthMiddleware("alchemist", "supervisor")(http.HandlerFunc(transHandler.MyQuotas)),
+			).Methods(http.MethodGet)
+
+			router.Handle(
+				"/transmutations/{id}/approve",
+				s.AuthMiddleware("supervisor")(http.HandlerFunc(transHandler.Approve)),
+			).Methods(http.MethodPost)
+
+			router.Handle(
+				"/transmutations/{id}/reject",
+				s.AuthMiddleware("supervisor")(http.HandlerFunc(transHandler.Reject)),
+			).Methods(http.MethodPost)
+
+			router.Handle(
+				"/transmutations/estimate",
+				s.AuthMiddleware("alchemist", "supervisor")(http.HandlerFunc(transHandler.Estimate)),
+			).Methods(http.MethodPost)
+
+			router.Handle(
+				"/transmutations/{id}/schedule",
+				s.AuthMiddleware("alchemist", "supervisor")(http.HandlerFunc(transHandler.Reschedule)),
+			).Methods(http.MethodPut)
+
+			router.Handle(
+				"/transmutations/{id}/retry",
+				s.AuthMiddleware("alchemist", "supervisor")(http.HandlerFunc(transHandler.Retry)),
+			).Methods(http.MethodPost)
+
+			router.Handle(
+				"/transmutations/{id}/cancel",
+				s.AuthMiddleware("alchemist", "supervisor")(http.HandlerFunc(transHandler.Cancel)),
 			).Methods(http.MethodPost)
 
 			router.Handle(
@@ -132,6 +188,115 @@ func (s *Server) router() http.Handler {
 			).Methods(http.MethodDelete)
 		}
 
+		// * PIPELINES
+		if s.PipelineRepository != nil {
+			pipelineHandler := handlers.NewPipelineHandler(
+				s.PipelineRepository,
+				s.TransmutationEngine,
+				dispatcher,
+				currentUser,
+				asyncReporter,
+				s.eventHub.Broadcast,
+				s.HandleError,
+				s.logger.Info,
+			)
+			router.Handle(
+				"/pipelines",
+				s.AuthMiddleware("alchemist", "supervisor")(http.HandlerFunc(pipelineHandler.GetAll)),
+			).Methods(http.MethodGet)
+			router.Handle(
+				"/pipelines/{id}",
+				s.AuthMiddleware("alchemist", "supervisor")(http.HandlerFunc(pipelineHandler.GetByID)),
+			).Methods(http.MethodGet)
+			router.Handle(
+				"/pipelines",
+				s.AuthMiddleware("alchemist", "supervisor")(http.HandlerFunc(pipelineHandler.Create)),
+			).Methods(http.MethodPost)
+		}
+
+		// * RECIPES
+		if s.RecipeRepository != nil {
+			recipeHandler := handlers.NewRecipeHandler(
+				s.RecipeRepository,
+				dispatcher,
+				currentUser,
+				asyncReporter,
+				s.HandleError,
+				s.logger.Info,
+			)
+			router.Handle(
+				"/recipes",
+				s.AuthMiddleware("alchemist", "supervisor")(http.HandlerFunc(recipeHandler.GetAll)),
+			).Methods(http.MethodGet)
+			router.Handle(
+				"/recipes/{id}",
+				s.AuthMiddleware("alchemist", "supervisor")(http.HandlerFunc(recipeHandler.GetByID)),
+			).Methods(http.MethodGet)
+			router.Handle("/recipes",
+				s.AuthMiddleware("supervisor")(http.HandlerFunc(recipeHandler.Create)),
+			).Methods(http.MethodPost)
+			router.Handle("/recipes/{id}",
+				s.AuthMiddleware("supervisor")(http.HandlerFunc(recipeHandler.Edit)),
+			).Methods(http.MethodPut)
+			router.Handle("/recipes/{id}",
+				s.AuthMiddleware("supervisor")(http.HandlerFunc(recipeHandler.Delete)),
+			).Methods(http.MethodDelete)
+		}
+
+		// * FORMULAS
+		if s.FormulaRepository != nil {
+			formulaHandler := handlers.NewFormulaHandler(
+				s.FormulaRepository,
+				dispatcher,
+				currentUser,
+				asyncReporter,
+				s.HandleError,
+				s.logger.Info,
+			)
+			router.Handle("/formulas",
+				s.AuthMiddleware("alchemist", "supervisor")(http.HandlerFunc(formulaHandler.GetAll)),
+			).Methods(http.MethodGet)
+			router.Handle("/formulas/{id}",
+				s.AuthMiddleware("alchemist", "supervisor")(http.HandlerFunc(formulaHandler.GetByID)),
+			).Methods(http.MethodGet)
+			router.Handle("/formulas/{id}/versions/{version}",
+				s.AuthMiddleware("alchemist", "supervisor")(http.HandlerFunc(formulaHandler.GetVersion)),
+			).Methods(http.MethodGet)
+			router.Handle("/formulas",
+				s.AuthMiddleware("alchemist", "supervisor")(http.HandlerFunc(formulaHandler.Create)),
+			).Methods(http.MethodPost)
+			router.Handle("/formulas/{id}",
+				s.AuthMiddleware("alchemist", "supervisor")(http.HandlerFunc(formulaHandler.Edit)),
+			).Methods(http.MethodPut)
+		}
+
+		// * TRANSMUTATION RULES
+		if s.TransmutationRuleRepository != nil {
+			ruleHandler := handlers.NewTransmutationRuleHandler(
+				s.TransmutationRuleRepository,
+				dispatcher,
+				currentUser,
+				asyncReporter,
+				s.HandleError,
+				s.logger.Info,
+			)
+			router.Handle("/transmutation-rules",
+				s.AuthMiddleware("supervisor")(http.HandlerFunc(ruleHandler.GetAll)),
+			).Methods(http.MethodGet)
+			router.Handle("/transmutation-rules/{id}",
+				s.AuthMiddleware("supervisor")(http.HandlerFunc(ruleHandler.GetByID)),
+			).Methods(http.MethodGet)
+			router.Handle("/transmutation-rules",
+				s.AuthMiddleware("supervisor")(http.HandlerFunc(ruleHandler.Create)),
+			).Methods(http.MethodPost)
+			router.Handle("/transmutation-rules/{id}",
+				s.AuthMiddleware("supervisor")(http.HandlerFunc(ruleHandler.Edit)),
+			).Methods(http.MethodPut)
+			router.Handle("/transmutation-rules/{id}",
+				s.AuthMiddleware("supervisor")(http.HandlerFunc(ruleHandler.Delete)),
+			).Methods(http.MethodDelete)
+		}
+
 		// * MATERIALS
 		if s.MaterialRepository != nil {
 			matHandler := handlers.NewMaterialHandler(
@@ -150,8 +315,32 @@ func (s *Server) router() http.Handler {
 				"/materials/{id}",
 				s.AuthMiddleware("alchemist", "supervisor")(http.HandlerFunc(matHandler.GetByID)),
 			).Methods(http.MethodGet)
+			router.Handle(
+				"/materials/{id}/movements",
+				s.AuthMiddleware("alchemist", "supervisor")(http.HandlerFunc(matHandler.Movements)),
+			).Methods(http.MethodGet)
+			router.Handle(
+				"/materials/{id}/lots",
+				s.AuthMiddleware("alchemist", "supervisor")(http.HandlerFunc(matHandler.Lots)),
+			).Methods(http.MethodGet)
+			router.Handle(
+				"/materials/{id}/stock",
+				s.AuthMiddleware("alchemist", "supervisor")(http.HandlerFunc(matHandler.Stock)),
+			).Methods(http.MethodGet)
+			router.Handle(
+				"/materials/{id}/lots",
+				s.AuthMiddleware("supervisor")(s.Idempotent(http.HandlerFunc(matHandler.ReceiveLot))),
+			).Methods(http.MethodPost)
+			router.Handle(
+				"/materials/{id}/lots/{lotId}",
+				s.AuthMiddleware("supervisor")(http.HandlerFunc(matHandler.AdjustLot)),
+			).Methods(http.MethodPut)
+			router.Handle(
+				"/units",
+				s.AuthMiddleware("alchemist", "supervisor")(http.HandlerFunc(matHandler.Units)),
+			).Methods(http.MethodGet)
 			router.Handle("/materials",
-				s.AuthMiddleware("supervisor")(http.HandlerFunc(matHandler.Create)),
+				s.AuthMiddleware("supervisor")(s.Idempotent(http.HandlerFunc(matHandler.Create))),
 			).Methods(http.MethodPost)
 			router.Handle("/materials/{id}",
 				s.AuthMiddleware("supervisor")(http.HandlerFunc(matHandler.Edit)),
@@ -161,6 +350,147 @@ func (s *Server) router() http.Handler {
 			).Methods(http.MethodDelete)
 		}
 
+		// * LOCATIONS
+		if s.LocationRepository != nil {
+			locationHandler := handlers.NewLocationHandler(
+				s.LocationRepository,
+				s.TransmutationEngine,
+				dispatcher,
+				currentUser,
+				asyncReporter,
+				s.HandleError,
+				s.logger.Info,
+			)
+			router.Handle(
+				"/locations",
+				s.AuthMiddleware("alchemist", "supervisor")(http.HandlerFunc(locationHandler.GetAll)),
+			).Methods(http.MethodGet)
+			router.Handle(
+				"/locations/{id}",
+				s.AuthMiddleware("alchemist", "supervisor")(http.HandlerFunc(locationHandler.GetByID)),
+			).Methods(http.MethodGet)
+			router.Handle(
+				"/locations/{id}/stock",
+				s.AuthMiddleware("alchemist", "supervisor")(http.HandlerFunc(locationHandler.Stock)),
+			).Methods(http.MethodGet)
+			router.Handle("/locations",
+				s.AuthMiddleware("supervisor")(s.Idempotent(http.HandlerFunc(locationHandler.Create))),
+			).Methods(http.MethodPost)
+			router.Handle("/locations/{id}",
+				s.AuthMiddleware("supervisor")(http.HandlerFunc(locationHandler.Edit)),
+			).Methods(http.MethodPut)
+			router.Handle("/locations/{id}",
+				s.AuthMiddleware("supervisor")(http.HandlerFunc(locationHandler.Delete)),
+			).Methods(http.MethodDelete)
+			router.Handle(
+				"/transfers",
+				s.AuthMiddleware("supervisor")(http.HandlerFunc(locationHandler.Transfers)),
+			).Methods(http.MethodGet)
+			router.Handle("/transfers",
+				s.AuthMiddleware("supervisor")(s.Idempotent(http.HandlerFunc(locationHandler.Transfer))),
+			).Methods(http.MethodPost)
+		}
+
+		// * RESTOCK REQUESTS
+		if s.RestockRepository != nil {
+			restockHandler := handlers.NewRestockHandler(
+				s.RestockRepository,
+				dispatcher,
+				currentUser,
+				asyncReporter,
+				s.HandleError,
+				s.logger.Info,
+			)
+			router.Handle(
+				"/restock-requests",
+				s.AuthMiddleware("supervisor")(http.HandlerFunc(restockHandler.GetAll)),
+			).Methods(http.MethodGet)
+			router.Handle(
+				"/restock-requests/{id}",
+				s.AuthMiddleware("supervisor")(http.HandlerFunc(restockHandler.GetByID)),
+			).Methods(http.MethodGet)
+			router.Handle(
+				"/restock-requests/{id}/approve",
+				s.AuthMiddleware("supervisor")(http.HandlerFunc(restockHandler.Approve)),
+			).Methods(http.MethodPost)
+			router.Handle(
+				"/restock-requests/{id}/receive",
+				s.AuthMiddleware("supervisor")(http.HandlerFunc(restockHandler.Receive)),
+			).Methods(http.MethodPost)
+			router.Handle(
+				"/restock-requests/{id}/dismiss",
+				s.AuthMiddleware("supervisor")(http.HandlerFunc(restockHandler.Dismiss)),
+			).Methods(http.MethodPost)
+		}
+
+		// * SUPPLIERS
+		if s.SupplierRepository != nil {
+			supplierHandler := handlers.NewSupplierHandler(
+				s.SupplierRepository,
+				dispatcher,
+				currentUser,
+				asyncReporter,
+				s.HandleError,
+				s.logger.Info,
+			)
+			router.Handle(
+				"/suppliers",
+				s.AuthMiddleware("supervisor")(http.HandlerFunc(supplierHandler.GetAll)),
+			).Methods(http.MethodGet)
+			router.Handle(
+				"/suppliers/{id}",
+				s.AuthMiddleware("supervisor")(http.HandlerFunc(supplierHandler.GetByID)),
+			).Methods(http.MethodGet)
+			router.Handle("/suppliers",
+				s.AuthMiddleware("supervisor")(s.Idempotent(http.HandlerFunc(supplierHandler.Create))),
+			).Methods(http.MethodPost)
+			router.Handle("/suppliers/{id}",
+				s.AuthMiddleware("supervisor")(http.HandlerFunc(supplierHandler.Edit)),
+			).Methods(http.MethodPut)
+			router.Handle("/suppliers/{id}",
+				s.AuthMiddleware("supervisor")(http.HandlerFunc(supplierHandler.Delete)),
+			).Methods(http.MethodDelete)
+		}
+
+		// * PURCHASE ORDERS
+		if s.PurchaseOrderRepository != nil {
+			orderHandler := handlers.NewPurchaseOrderHandler(
+				s.PurchaseOrderRepository,
+				s.TransmutationEngine,
+				dispatcher,
+				currentUser,
+				asyncReporter,
+				s.HandleError,
+				s.logger.Info,
+			)
+			router.Handle(
+				"/purchase-orders",
+				s.AuthMiddleware("supervisor")(http.HandlerFunc(orderHandler.GetAll)),
+			).Methods(http.MethodGet)
+			router.Handle(
+				"/purchase-orders/{id}",
+				s.AuthMiddleware("supervisor")(http.HandlerFunc(orderHandler.GetByID)),
+			).Methods(http.MethodGet)
+			router.Handle("/purchase-orders",
+				s.AuthMiddleware("supervisor")(s.Idempotent(http.HandlerFunc(orderHandler.Create))),
+			).Methods(http.MethodPost)
+			router.Handle("/purchase-orders/{id}",
+				s.AuthMiddleware("supervisor")(http.HandlerFunc(orderHandler.Edit)),
+			).Methods(http.MethodPut)
+			router.Handle(
+				"/purchase-orders/{id}/send",
+				s.AuthMiddleware("supervisor")(http.HandlerFunc(orderHandler.Send)),
+			).Methods(http.MethodPost)
+			router.Handle(
+				"/purchase-orders/{id}/receive",
+				s.AuthMiddleware("supervisor")(http.HandlerFunc(orderHandler.Receive)),
+			).Methods(http.MethodPost)
+			router.Handle(
+				"/purchase-orders/{id}/cancel",
+				s.AuthMiddleware("supervisor")(http.HandlerFunc(orderHandler.Cancel)),
+			).Methods(http.MethodPost)
+		}
+
 		// * AUDITS
 		if s.AuditRepository != nil {
 			auditHandler := handlers.NewAuditHandler(
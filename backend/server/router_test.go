@@ -0,0 +1,126 @@
+package server
+
+import (
+	"backend-avanzada/alchemy"
+	"backend-avanzada/logger"
+	"backend-avanzada/models"
+	"backend-avanzada/repository"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// newTestServer arma un servidor con las transmutaciones y el inventario sobre
+// una base en memoria, sin Redis ni worker.
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: gormlogger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Cada conexión a :memory: es una base distinta.
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	err = db.AutoMigrate(
+		&models.User{},
+		&models.Alchemist{},
+		&models.Material{},
+		&models.TransmutationBatch{},
+		&models.Transmutation{},
+		&models.TransmutationInput{},
+		&models.TransmutationOutput{},
+		&models.TransmutationTransition{},
+		&models.Recipe{},
+		&models.RecipeInput{},
+		&models.RecipeOutput{},
+		&models.Pipeline{},
+		&models.PipelineStep{},
+		&models.IdempotencyRecord{},
+		&models.StockMovement{},
+		&models.MaterialLot{},
+		&models.TransmutationLotDraw{},
+		&models.StockReservation{},
+		&models.Location{},
+		&models.MaterialStock{},
+		&models.Audit{},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{
+		DB:        db,
+		jwtSecret: "test-secret",
+		logger:    logger.NewLogger(),
+		eventHub:  NewEventHub(),
+	}
+	// Las demás rutas cuelgan del bloque de alquimistas.
+	s.AlchemistRepository = repository.NewAlchemistRepository(db)
+	s.MaterialRepository = repository.NewMaterialRepository(db)
+	s.LocationRepository = repository.NewLocationRepository(db)
+	if _, err := s.LocationRepository.OpenLocations(); err != nil {
+		t.Fatal(err)
+	}
+	s.TransmutationRepository = repository.NewTransmutationRepository(db)
+	s.TransmutationEngine = alchemy.NewEngine(s.MaterialRepository, nil)
+	return s
+}
+
+func bearer(t *testing.T, s *Server, role string) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, &AuthClaims{ID: 1, Email: role + "@example.com", Role: role}).
+		SignedString([]byte(s.jwtSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return "Bearer " + token
+}
+
+func TestRouterServesApprovalQueue(t *testing.T) {
+	s := newTestServer(t)
+	awaiting := &models.Transmutation{UserID: 2, Formula: "Lead -> Gold", Quantity: 1, Status: models.TransmutationStatusAwaitingApproval}
+	pending := &models.Transmutation{UserID: 2, Formula: "Lead -> Gold", Quantity: 1, Status: models.TransmutationStatusPending}
+	for _, tm := range []*models.Transmutation{awaiting, pending} {
+		if err := s.DB.Create(tm).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	router := s.router()
+
+	req := httptest.NewRequest(http.MethodGet, "/transmutations/approvals", nil)
+	req.Header.Set("Authorization", bearer(t, s, "supervisor"))
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /transmutations/approvals = %d: %s", rec.Code, rec.Body.String())
+	}
+	var body struct {
+		Data []struct {
+			ID     uint   `json:"id"`
+			Status string `json:"status"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Data) != 1 || body.Data[0].ID != awaiting.ID {
+		t.Errorf("approval queue = %+v, want only transmutation %d", body.Data, awaiting.ID)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/transmutations/approvals", nil)
+	req.Header.Set("Authorization", bearer(t, s, "alchemist"))
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("GET /transmutations/approvals as alchemist = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+}
@@ -1,10 +1,13 @@
 package server
 
 import (
+	"backend-avanzada/alchemy"
+	"backend-avanzada/api"
 	"backend-avanzada/config"
 	"backend-avanzada/logger"
 	"backend-avanzada/models"
 	"backend-avanzada/repository"
+	"backend-avanzada/server/handlers"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -13,7 +16,7 @@ import (
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
-	"github.com/gorilla/handlers"
+	gorillahandlers "github.com/gorilla/handlers"
 	"gorm.io/driver/postgres"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
@@ -21,19 +24,30 @@ import (
 
 // Server representa el servidor principal de la aplicación.
 type Server struct {
-	DB                      *gorm.DB
-	Config                  *config.Config
-	Handler                 http.Handler
-	UserRepository          repository.UserRepository
-	AlchemistRepository     *repository.AlchemistRepository
-	MissionRepository       *repository.MissionRepository
-	MaterialRepository      *repository.MaterialRepository
-	TransmutationRepository *repository.TransmutationRepository
-	AuditRepository         *repository.AuditRepository
-	jwtSecret               string
-	logger                  *logger.Logger
-	taskQueue               *TaskQueue
-	eventHub                *EventHub
+	DB                          *gorm.DB
+	Config                      *config.Config
+	Handler                     http.Handler
+	UserRepository              repository.UserRepository
+	AlchemistRepository         *repository.AlchemistRepository
+	MissionRepository           *repository.MissionRepository
+	MaterialRepository          *repository.MaterialRepository
+	LocationRepository          *repository.LocationRepository
+	TransmutationRepository     *repository.TransmutationRepository
+	RecipeRepository            *repository.RecipeRepository
+	PipelineRepository          *repository.PipelineRepository
+	RestockRepository           *repository.RestockRepository
+	SupplierRepository          *repository.SupplierRepository
+	PurchaseOrderRepository     *repository.PurchaseOrderRepository
+	TransmutationRuleRepository *repository.TransmutationRuleRepository
+	FormulaRepository           *repository.FormulaRepository
+	IdempotencyRepository       *repository.IdempotencyRepository
+	AuditRepository             *repository.AuditRepository
+	TransmutationEngine         *alchemy.Engine
+	jwtSecret                   string
+	idempotencyTTL              time.Duration
+	logger                      *logger.Logger
+	taskQueue                   *TaskQueue
+	eventHub                    *EventHub
 }
 
 type welcomePayload struct {
@@ -83,10 +97,11 @@ func (s *Server) StartServer() {
 	}
 
 	fmt.Println("Configurando CORS...")
-	corsObj := handlers.CORS(
-		handlers.AllowedOrigins([]string{"*"}),
-		handlers.AllowedMethods([]string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}),
-		handlers.AllowedHeaders([]string{"X-Requested-With", "Content-Type", "Authorization"}),
+	corsObj := gorillahandlers.CORS(
+		gorillahandlers.AllowedOrigins([]string{"*"}),
+		gorillahandlers.AllowedMethods([]string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}),
+		gorillahandlers.AllowedHeaders([]string{"X-Requested-With", "Content-Type", "Authorization", idempotencyHeader}),
+		gorillahandlers.ExposedHeaders([]string{"Idempotent-Replayed"}),
 	)
 
 	fmt.Println("Inicializando mux...")
@@ -133,7 +148,31 @@ func (s *Server) initDB() {
 		&models.Alchemist{},
 		&models.Mission{},
 		&models.Material{},
+		&models.TransmutationBatch{},
 		&models.Transmutation{},
+		&models.TransmutationInput{},
+		&models.TransmutationOutput{},
+		&models.TransmutationTransition{},
+		&models.Recipe{},
+		&models.RecipeInput{},
+		&models.RecipeOutput{},
+		&models.Pipeline{},
+		&models.PipelineStep{},
+		&models.TransmutationRule{},
+		&models.Formula{},
+		&models.FormulaVersion{},
+		&models.IdempotencyRecord{},
+		&models.StockMovement{},
+		&models.MaterialLot{},
+		&models.TransmutationLotDraw{},
+		&models.StockReservation{},
+		&models.Location{},
+		&models.MaterialStock{},
+		&models.StockTransfer{},
+		&models.RestockRequest{},
+		&models.Supplier{},
+		&models.PurchaseOrder{},
+		&models.PurchaseOrderLine{},
 		&models.Audit{},
 	)
 	if err != nil {
@@ -149,8 +188,130 @@ func (s *Server) initDB() {
 	s.AlchemistRepository = repository.NewAlchemistRepository(s.DB)
 	s.MissionRepository = repository.NewMissionRepository(s.DB)
 	s.MaterialRepository = repository.NewMaterialRepository(s.DB)
+	s.LocationRepository = repository.NewLocationRepository(s.DB)
 	s.TransmutationRepository = repository.NewTransmutationRepository(s.DB)
+	s.RecipeRepository = repository.NewRecipeRepository(s.DB)
+	s.PipelineRepository = repository.NewPipelineRepository(s.DB)
+	s.RestockRepository = repository.NewRestockRepository(s.DB)
+	s.SupplierRepository = repository.NewSupplierRepository(s.DB)
+	s.PurchaseOrderRepository = repository.NewPurchaseOrderRepository(s.DB)
+	s.TransmutationRuleRepository = repository.NewTransmutationRuleRepository(s.DB)
+	s.FormulaRepository = repository.NewFormulaRepository(s.DB)
+	s.IdempotencyRepository = repository.NewIdempotencyRepository(s.DB)
+	s.idempotencyTTL = DefaultIdempotencyTTL
+	if s.Config.IdempotencyTTLHours > 0 {
+		s.idempotencyTTL = time.Duration(s.Config.IdempotencyTTLHours) * time.Hour
+	}
 	s.AuditRepository = repository.NewAuditRepository(s.DB)
+
+	quotas := make([]repository.Quota, 0, len(s.Config.TransmutationQuotas))
+	for _, q := range s.Config.TransmutationQuotas {
+		quotas = append(quotas, repository.Quota(q))
+	}
+	quotaPolicy, err := repository.NewQuotaPolicy(quotas)
+	if err != nil {
+		s.logger.Fatal(err)
+	}
+	s.TransmutationRepository.WithQuotas(quotaPolicy)
+	s.PipelineRepository.WithQuotas(quotaPolicy)
+
+	s.TransmutationEngine = alchemy.NewEngine(s.MaterialRepository, s.RecipeRepository)
+	s.TransmutationEngine.WithExchangePolicy(alchemy.ExchangePolicy{
+		Tolerance: s.Config.EquivalentExchangeTolerance,
+		Mode:      s.Config.EquivalentExchangeMode,
+	})
+	approval, err := alchemy.NewApprovalPolicy(s.Config.ApprovalCategoryThresholds, s.Config.ApprovalRestrictedFormulas)
+	if err != nil {
+		s.logger.Fatal(err)
+	}
+	s.TransmutationEngine.WithApprovalPolicy(approval)
+	s.seedTransmutationRules()
+	s.openStockLedger()
+	s.openLocations()
+	if err := s.MaterialRepository.EnsureUniqueNames(); err != nil {
+		s.logger.Printf("unable to enforce unique material names (rename the duplicates): %v", err)
+	}
+	s.linkAlchemists()
+	s.TransmutationEngine.WithRules(s.TransmutationRuleRepository)
+	s.TransmutationEngine.WithFormulas(s.FormulaRepository)
+	if retries := s.Config.MaxTransmutationRetries; retries != nil {
+		if *retries < 0 {
+			s.logger.Fatalf("max_transmutation_retries must not be negative, got %d", *retries)
+		}
+		s.TransmutationEngine.WithMaxRetries(*retries)
+	}
+}
+
+// seedTransmutationRules carga las reglas del fichero configurado que aún no
+// existen. A partir de ahí se gestionan desde /transmutation-rules.
+func (s *Server) seedTransmutationRules() {
+	path := s.Config.TransmutationRulesFile
+	if path == "" {
+		return
+	}
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		s.logger.Printf("unable to read transmutation rules from %s: %v", path, err)
+		return
+	}
+	var entries []api.TransmutationRuleRequestDto
+	if err := json.Unmarshal(contents, &entries); err != nil {
+		s.logger.Fatal(fmt.Errorf("invalid transmutation rules file %s: %w", path, err))
+	}
+	rules := make([]*models.TransmutationRule, 0, len(entries))
+	for i, entry := range entries {
+		rule, err := handlers.TransmutationRuleFromRequest(entry)
+		if err != nil {
+			s.logger.Fatal(fmt.Errorf("transmutation rule %d in %s: %w", i, path, err))
+		}
+		rules = append(rules, rule)
+	}
+	inserted, err := s.TransmutationRuleRepository.SeedMissing(rules)
+	if err != nil {
+		s.logger.Fatal(err)
+	}
+	if inserted > 0 {
+		s.logger.Printf("%d transmutation rules loaded from %s", inserted, path)
+	}
+}
+
+// openStockLedger abre el libro de movimientos de los materiales que tienen
+// existencias pero ningún apunte, para que la existencia cuadre con el libro.
+func (s *Server) openStockLedger() {
+	opened, err := s.MaterialRepository.OpenMissingBalances("system")
+	if err != nil {
+		s.logger.Printf("unable to open stock ledger: %v", err)
+		return
+	}
+	if opened > 0 {
+		s.logger.Printf("opening balance recorded for %d materials", opened)
+	}
+}
+
+// linkAlchemists enlaza por nombre los alquimistas sin usuario, para que las
+// cuotas por rango sigan aplicándose a los datos anteriores a user_id.
+func (s *Server) linkAlchemists() {
+	linked, err := s.AlchemistRepository.LinkUsersByName()
+	if err != nil {
+		s.logger.Printf("unable to link alchemists to users: %v", err)
+		return
+	}
+	if linked > 0 {
+		s.logger.Printf("%d alchemists linked to their users by name", linked)
+	}
+}
+
+// openLocations crea la ubicación predeterminada si no existe y lleva a ella
+// las existencias anteriores a las ubicaciones. Sin ella no se puede reservar
+// ni recibir material, así que un fallo detiene el arranque.
+func (s *Server) openLocations() {
+	opened, err := s.LocationRepository.OpenLocations()
+	if err != nil {
+		s.logger.Fatal(fmt.Errorf("unable to open storage locations: %w", err))
+	}
+	if opened > 0 {
+		s.logger.Printf("stock of %d materials assigned to the default location", opened)
+	}
 }
 
 func (s *Server) loadSeedData() {
@@ -201,6 +362,10 @@ func (s *Server) initAsyncInfrastructure() error {
 		s.MissionRepository,
 		s.MaterialRepository,
 	)
+	s.taskQueue.WithPipelineRepository(s.PipelineRepository)
+	s.taskQueue.WithRestockRepository(s.RestockRepository)
+	s.taskQueue.WithIdempotencyRepository(s.IdempotencyRepository)
+	s.taskQueue.WithEngine(s.TransmutationEngine)
 	s.taskQueue.WithBroadcaster(s.eventHub)
 
 	verificationInterval := time.Duration(s.Config.VerificationIntervalMinutes) * time.Minute
@@ -208,6 +373,13 @@ func (s *Server) initAsyncInfrastructure() error {
 	lowStock := s.Config.MaterialLowStockThreshold
 
 	s.taskQueue.ConfigureThresholds(verificationInterval, pendingHours, lowStock)
+	s.taskQueue.ConfigureLotExpiryWindow(time.Duration(s.Config.LotExpiryWarningDays) * 24 * time.Hour)
+	if err := s.taskQueue.ConfigureTimeouts(
+		time.Duration(s.Config.KillDuration)*time.Second,
+		time.Duration(s.Config.ReaperStuckAfterSeconds)*time.Second,
+	); err != nil {
+		return err
+	}
 	if err := s.taskQueue.Start(); err != nil {
 		return err
 	}
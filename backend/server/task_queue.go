@@ -6,19 +6,24 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"backend-avanzada/alchemy"
 	"backend-avanzada/api"
 	"backend-avanzada/logger"
 	"backend-avanzada/models"
 	"backend-avanzada/repository"
+	"backend-avanzada/server/handlers"
 )
 
 const (
 	taskTypeProcessTransmutation = "process_transmutation"
 	taskTypeRegisterAudit        = "register_audit"
 	taskTypeDailyVerification    = "daily_verification"
+	taskTypeAdvancePipeline      = "advance_pipeline"
 )
 
 type queueTask struct {
@@ -39,6 +44,11 @@ type registerAuditPayload struct {
 	Details   string `json:"details"`
 }
 
+type advancePipelinePayload struct {
+	PipelineID  uint   `json:"pipeline_id"`
+	RequestedBy string `json:"requested_by"`
+}
+
 type dailyVerificationPayload struct {
 	ExecutedAt time.Time `json:"executed_at"`
 }
@@ -57,12 +67,24 @@ type TaskQueue struct {
 	auditRepo          *repository.AuditRepository
 	missionRepo        *repository.MissionRepository
 	materialRepo       *repository.MaterialRepository
+	pipelineRepo       *repository.PipelineRepository
+	restockRepo        *repository.RestockRepository
+	idempotencyRepo    *repository.IdempotencyRepository
+	engine             *alchemy.Engine
 	broadcaster        EventBroadcaster
+	running            map[uint]context.CancelFunc
+	runningMu          sync.Mutex
 	verificationTicker *time.Ticker
 	verificationEvery  time.Duration
 	pendingThreshold   time.Duration
+	promoteEvery       time.Duration
+	jobDeadline        time.Duration
+	stuckAfter         time.Duration
 	lowStockThreshold  float64
 	started            bool
+	// lotExpiryWindow es la antelación con la que la verificación diaria avisa
+	// de los lotes que van a caducar.
+	lotExpiryWindow time.Duration
 }
 
 func NewTaskQueue(redisAddr string, log *logger.Logger) *TaskQueue {
@@ -73,9 +95,12 @@ func NewTaskQueue(redisAddr string, log *logger.Logger) *TaskQueue {
 		ctx:               ctx,
 		cancel:            cancel,
 		started:           false,
+		running:           make(map[uint]context.CancelFunc),
 		lowStockThreshold: 5,
 		verificationEvery: 24 * time.Hour,
 		pendingThreshold:  24 * time.Hour,
+		promoteEvery:      time.Second,
+		lotExpiryWindow:   DefaultLotExpiryWindow,
 	}
 }
 
@@ -91,6 +116,22 @@ func (q *TaskQueue) WithRepositories(
 	q.materialRepo = materialRepo
 }
 
+func (q *TaskQueue) WithPipelineRepository(repo *repository.PipelineRepository) {
+	q.pipelineRepo = repo
+}
+
+func (q *TaskQueue) WithRestockRepository(repo *repository.RestockRepository) {
+	q.restockRepo = repo
+}
+
+func (q *TaskQueue) WithIdempotencyRepository(repo *repository.IdempotencyRepository) {
+	q.idempotencyRepo = repo
+}
+
+func (q *TaskQueue) WithEngine(engine *alchemy.Engine) {
+	q.engine = engine
+}
+
 func (q *TaskQueue) WithBroadcaster(b EventBroadcaster) {
 	q.broadcaster = b
 }
@@ -107,6 +148,32 @@ func (q *TaskQueue) ConfigureThresholds(verificationEvery, pendingThreshold time
 	}
 }
 
+// DefaultLotExpiryWindow es la antelación del aviso de caducidad si la configuración no indica otra.
+const DefaultLotExpiryWindow = 7 * 24 * time.Hour
+
+// ConfigureLotExpiryWindow fija con cuánta antelación se avisa de que un lote caduca.
+func (q *TaskQueue) ConfigureLotExpiryWindow(window time.Duration) {
+	if window > 0 {
+		q.lotExpiryWindow = window
+	}
+}
+
+// ConfigureTimeouts fija el plazo de ejecución de cada transmutación y a partir
+// de cuánto tiempo sin cambios el reaper da por atascada una en PROCESSING.
+// Cero desactiva cada mecanismo. El reaper no debe adelantarse a un worker que
+// aún está en plazo, así que stuckAfter ha de superar a jobDeadline.
+func (q *TaskQueue) ConfigureTimeouts(jobDeadline, stuckAfter time.Duration) error {
+	if jobDeadline < 0 || stuckAfter < 0 {
+		return errors.New("kill_duration and reaper_stuck_after_seconds must not be negative")
+	}
+	if stuckAfter > 0 && jobDeadline > 0 && stuckAfter <= jobDeadline {
+		return fmt.Errorf("reaper_stuck_after_seconds (%s) must be greater than kill_duration (%s)", stuckAfter, jobDeadline)
+	}
+	q.jobDeadline = jobDeadline
+	q.stuckAfter = stuckAfter
+	return nil
+}
+
 func (q *TaskQueue) broadcast(eventType string, payload interface{}) {
 	if q.broadcaster != nil {
 		q.broadcaster.Broadcast(eventType, payload)
@@ -123,6 +190,13 @@ func (q *TaskQueue) Start() error {
 	}
 	q.started = true
 	go q.worker()
+	go q.promoteDelayed()
+	if q.stuckAfter > 0 {
+		go q.reapStuck()
+	}
+	if q.idempotencyRepo != nil {
+		go q.purgeIdempotencyRecords()
+	}
 	return nil
 }
 
@@ -165,6 +239,55 @@ func (q *TaskQueue) EnqueueTransmutationProcessing(transmutationID uint, request
 	return q.enqueue(taskTypeProcessTransmutation, payload)
 }
 
+// ScheduleTransmutationProcessing difiere el procesamiento hasta at. Si ya
+// estaba programada, la nueva hora reemplaza a la anterior.
+func (q *TaskQueue) ScheduleTransmutationProcessing(transmutationID uint, requestedBy string, at time.Time) error {
+	payload := processTransmutationPayload{TransmutationID: transmutationID, RequestedBy: requestedBy}
+	return q.enqueueAt(delayedTransmutationKey(transmutationID), at, taskTypeProcessTransmutation, payload)
+}
+
+// EnqueuePipelineAdvance pide al worker que revise un pipeline tras un cambio
+// de estado hecho fuera de él (p. ej. una cancelación desde la API).
+func (q *TaskQueue) EnqueuePipelineAdvance(pipelineID uint, requestedBy string) error {
+	payload := advancePipelinePayload{PipelineID: pipelineID, RequestedBy: requestedBy}
+	return q.enqueue(taskTypeAdvancePipeline, payload)
+}
+
+// CancelTransmutationProcessing detiene el procesamiento en curso de la
+// transmutación y descarta su ejecución programada, si la hay.
+func (q *TaskQueue) CancelTransmutationProcessing(transmutationID uint) {
+	q.runningMu.Lock()
+	cancel, ok := q.running[transmutationID]
+	q.runningMu.Unlock()
+	if ok {
+		cancel()
+	}
+	if q.started {
+		if err := q.dequeueDelayed(delayedTransmutationKey(transmutationID)); err != nil {
+			q.logger.Printf("[async] no se pudo descartar la ejecución programada de %d: %v", transmutationID, err)
+		}
+	}
+}
+
+func delayedTransmutationKey(transmutationID uint) string {
+	return fmt.Sprintf("%s:%d", taskTypeProcessTransmutation, transmutationID)
+}
+
+func (q *TaskQueue) trackRunning(transmutationID uint, cancel context.CancelFunc) {
+	q.runningMu.Lock()
+	q.running[transmutationID] = cancel
+	q.runningMu.Unlock()
+}
+
+func (q *TaskQueue) untrackRunning(transmutationID uint) {
+	q.runningMu.Lock()
+	if cancel, ok := q.running[transmutationID]; ok {
+		cancel()
+		delete(q.running, transmutationID)
+	}
+	q.runningMu.Unlock()
+}
+
 // EnqueueAudit registra una auditoría de forma asíncrona para que los handlers no se bloqueen en escrituras a la base de datos.
 func (q *TaskQueue) EnqueueAudit(action, entity string, entityID uint, userEmail, details string) error {
 	payload := registerAuditPayload{
@@ -198,6 +321,97 @@ func (q *TaskQueue) enqueue(taskType string, payload interface{}) error {
 	return q.redis.LPUSH(q.ctx, redisQueueKey, raw)
 }
 
+// enqueueAt guarda la tarea en el sorted set de diferidas bajo key; el
+// promotor la moverá a la cola principal cuando llegue at.
+func (q *TaskQueue) enqueueAt(key string, at time.Time, taskType string, payload interface{}) error {
+	if !q.started {
+		return errors.New("async queue has not been started")
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	raw, err := json.Marshal(queueTask{Type: taskType, Payload: data})
+	if err != nil {
+		return err
+	}
+	_, err = q.redis.EVAL(q.ctx, scheduleDelayedScript,
+		[]string{redisDelayedKey, redisDelayedPayloadsKey},
+		key, strconv.FormatInt(at.Unix(), 10), string(raw))
+	return err
+}
+
+func (q *TaskQueue) dequeueDelayed(key string) error {
+	_, err := q.redis.EVAL(q.ctx, dequeueDelayedScript, []string{redisDelayedKey, redisDelayedPayloadsKey}, key)
+	return err
+}
+
+// Las tareas diferidas viven en un sorted set (la hora) y un hash (el cuerpo).
+// Cada operación que toca ambos va en un script Lua para que sea atómica:
+// así un promotor no puede leer el cuerpo de una reprogramación a medias ni
+// adelantar una tarea que se acaba de mover a más tarde.
+const (
+	// KEYS: sorted set, hash. ARGV: clave, hora Unix, cuerpo.
+	scheduleDelayedScript = `
+redis.call('HSET', KEYS[2], ARGV[1], ARGV[3])
+redis.call('ZADD', KEYS[1], ARGV[2], ARGV[1])
+return 1`
+	// KEYS: sorted set, hash. ARGV: clave.
+	dequeueDelayedScript = `
+redis.call('ZREM', KEYS[1], ARGV[1])
+redis.call('HDEL', KEYS[2], ARGV[1])
+return 1`
+	// KEYS: sorted set, hash, cola. ARGV: clave, hora Unix actual. Devuelve 1
+	// si la tarea seguía vencida y se pasó a la cola.
+	promoteDelayedScript = `
+local score = redis.call('ZSCORE', KEYS[1], ARGV[1])
+if not score or tonumber(score) > tonumber(ARGV[2]) then
+	return 0
+end
+redis.call('ZREM', KEYS[1], ARGV[1])
+local raw = redis.call('HGET', KEYS[2], ARGV[1])
+redis.call('HDEL', KEYS[2], ARGV[1])
+if raw then
+	redis.call('LPUSH', KEYS[3], raw)
+end
+return 1`
+)
+
+// promoteDelayed revisa periódicamente las tareas diferidas vencidas y las
+// pasa a la cola principal. El script de promoción reclama, lee y encola en
+// un solo paso, así que con varias instancias cada tarea se promueve una vez.
+func (q *TaskQueue) promoteDelayed() {
+	ticker := time.NewTicker(q.promoteEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-q.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		due, err := q.redis.ZRANGEBYSCORE(q.ctx, redisDelayedKey, float64(time.Now().Unix()), 100)
+		if err != nil {
+			if !errors.Is(err, context.Canceled) {
+				q.logger.Printf("[async] error leyendo tareas programadas: %v", err)
+			}
+			continue
+		}
+		now := time.Now().Unix()
+		for _, key := range due {
+			if err := q.promote(key, now); err != nil {
+				q.logger.Printf("[async] no se pudo promover la tarea %s: %v", key, err)
+			}
+		}
+	}
+}
+
+func (q *TaskQueue) promote(key string, now int64) error {
+	_, err := q.redis.EVAL(q.ctx, promoteDelayedScript,
+		[]string{redisDelayedKey, redisDelayedPayloadsKey, redisQueueKey},
+		key, strconv.FormatInt(now, 10))
+	return err
+}
+
 func (q *TaskQueue) worker() {
 	for {
 		select {
@@ -242,6 +456,12 @@ func (q *TaskQueue) dispatch(task queueTask) error {
 		return q.handleAudit(payload)
 	case taskTypeDailyVerification:
 		return q.handleDailyVerification()
+	case taskTypeAdvancePipeline:
+		var payload advancePipelinePayload
+		if err := json.Unmarshal(task.Payload, &payload); err != nil {
+			return err
+		}
+		return q.advancePipeline(payload.PipelineID, payload.RequestedBy)
 	default:
 		return fmt.Errorf("tipo de tarea desconocido: %s", task.Type)
 	}
@@ -258,36 +478,108 @@ func (q *TaskQueue) handleTransmutation(payload processTransmutationPayload) err
 	if transmutation == nil {
 		return fmt.Errorf("transmutación %d no encontrada", payload.TransmutationID)
 	}
-	if strings.EqualFold(transmutation.Status, models.TransmutationStatusCompleted) {
+	if transmutation.Status != models.TransmutationStatusPending {
+		// Ya procesada, cancelada o en curso en otro worker.
 		return nil
 	}
+	if transmutation.ScheduledAt != nil && transmutation.ScheduledAt.After(time.Now()) {
+		// Se reprogramó después de promoverse: la ejecución nueva ya está en el sorted set.
+		return nil
+	}
+	if q.engine == nil {
+		return errors.New("transmutation engine is not configured")
+	}
+
+	var (
+		jobCtx context.Context
+		cancel context.CancelFunc
+	)
+	if q.jobDeadline > 0 {
+		jobCtx, cancel = context.WithTimeout(q.ctx, q.jobDeadline)
+	} else {
+		jobCtx, cancel = context.WithCancel(q.ctx)
+	}
+	q.trackRunning(transmutation.ID, cancel)
+	defer q.untrackRunning(transmutation.ID)
 
 	startedAt := time.Now().UTC()
-	transmutation.Status = models.TransmutationStatusProcessing
 	transmutation.Result = fmt.Sprintf("Processing started at %s", startedAt.Format(time.RFC3339))
-	if _, err := q.transRepo.Save(transmutation); err != nil {
+	setProgress(transmutation, models.ProgressStageStarted, 0, "Processing started")
+	if _, err := q.transRepo.StartProcessing(transmutation, workerActor); err != nil {
+		if errors.Is(err, repository.ErrInvalidTransmutationState) {
+			return nil
+		}
 		return err
 	}
 	q.broadcast("transmutation.updated", transmutationToResponse(transmutation))
+	q.broadcast("transmutation.progress", handlers.TransmutationProgressToResponse(transmutation))
 
-	// Simula un trabajo costoso.
-	time.Sleep(3 * time.Second)
-
-	transmutation.Status = models.TransmutationStatusCompleted
-	transmutation.Result = fmt.Sprintf("Completed at %s", time.Now().UTC().Format(time.RFC3339))
-	if _, err := q.transRepo.Save(transmutation); err != nil {
-		transmutation.Status = models.TransmutationStatusFailed
-		transmutation.Result = fmt.Sprintf("Failed to persist completion: %v", err)
-		if _, saveErr := q.transRepo.Save(transmutation); saveErr != nil {
-			q.logger.Printf("[async] error marcando transmutación %d como fallida: %v", transmutation.ID, saveErr)
+	message := "Evaluating formula"
+	if transmutation.RecipeID != nil {
+		message = "Evaluating recipe"
+	}
+	if !q.reportProgress(transmutation, models.ProgressStageEvaluating, 25, message) {
+		return nil
+	}
+	outcome, err := q.evaluateWithin(jobCtx, transmutation)
+	if stop, stopErr := q.interrupted(jobCtx, transmutation, payload.RequestedBy); stop {
+		return stopErr
+	}
+	if err != nil {
+		return q.failTransmutation(transmutation, payload.RequestedBy, err)
+	}
+	if !q.reportProgress(transmutation, models.ProgressStageExchange, 50, "Checking equivalent exchange") {
+		return nil
+	}
+	if outcome.Exchange != nil && outcome.Exchange.Violated {
+		if err := q.recordExchangeViolation(transmutation.ID, payload.RequestedBy, outcome.Exchange); err != nil {
+			q.logger.Printf("[async] no se pudo auditar violación de intercambio equivalente: %v", err)
+		}
+		if err := q.engine.CheckExchange(outcome); err != nil {
+			return q.failTransmutation(transmutation, payload.RequestedBy, err)
 		}
-		q.broadcast("transmutation.updated", transmutationToResponse(transmutation))
+	}
+	if stop, err := q.interrupted(jobCtx, transmutation, payload.RequestedBy); stop {
 		return err
 	}
+	if !q.reportProgress(transmutation, models.ProgressStageCrediting, 75, "Crediting products to inventory") {
+		return nil
+	}
+
+	transmutation.Outcome = outcome
+	transmutation.Result = outcome.Summary()
+	setProgress(transmutation, models.ProgressStageCompleted, 100, "Completed")
+	if _, err := q.transRepo.Complete(transmutation, workerActor); err != nil {
+		if errors.Is(err, repository.ErrInvalidTransmutationState) {
+			return nil
+		}
+		return q.failTransmutation(transmutation, payload.RequestedBy, fmt.Errorf("failed to persist completion: %w", err))
+	}
 
 	q.broadcast("transmutation.updated", transmutationToResponse(transmutation))
+	q.broadcast("transmutation.progress", handlers.TransmutationProgressToResponse(transmutation))
+	if transmutation.PipelineID != nil {
+		if err := q.advancePipeline(*transmutation.PipelineID, payload.RequestedBy); err != nil {
+			q.logger.Printf("[async] no se pudo avanzar el pipeline %d: %v", *transmutation.PipelineID, err)
+		}
+	}
 
 	if q.auditRepo != nil {
+		for _, out := range transmutation.Outcome.Outputs {
+			if !out.Created {
+				continue
+			}
+			audit := registerAuditPayload{
+				Action:    "material_created",
+				Entity:    "material",
+				EntityID:  out.MaterialID,
+				UserEmail: payload.RequestedBy,
+				Details:   fmt.Sprintf("Material created by transmutation %d", transmutation.ID),
+			}
+			if err := q.handleAudit(audit); err != nil {
+				return err
+			}
+		}
 		audit := registerAuditPayload{
 			Action:    "transmutation_processed",
 			Entity:    "transmutation",
@@ -302,6 +594,231 @@ func (q *TaskQueue) handleTransmutation(payload processTransmutationPayload) err
 	return nil
 }
 
+// evaluateWithin evalúa la transmutación sin esperar más allá del plazo del
+// trabajo. La evaluación trabaja sobre una copia porque puede seguir en curso
+// cuando se abandona.
+func (q *TaskQueue) evaluateWithin(ctx context.Context, t *models.Transmutation) (*models.TransmutationOutcome, error) {
+	type result struct {
+		outcome *models.TransmutationOutcome
+		err     error
+	}
+	done := make(chan result, 1)
+	snapshot := *t
+	go func() {
+		outcome, err := q.engine.Evaluate(&snapshot, time.Now().UTC())
+		done <- result{outcome, err}
+	}()
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case r := <-done:
+		return r.outcome, r.err
+	}
+}
+
+// interrupted indica si el trabajo debe parar. Si se canceló desde la API el
+// handler ya devolvió el material; si venció el plazo se marca como FAILED por timeout.
+func (q *TaskQueue) interrupted(ctx context.Context, t *models.Transmutation, requestedBy string) (bool, error) {
+	switch ctx.Err() {
+	case nil:
+		return false, nil
+	case context.DeadlineExceeded:
+		reason := fmt.Sprintf("processing exceeded the %s deadline", q.jobDeadline)
+		return true, q.timeOutTransmutation(t.ID, workerActor, requestedBy, reason, time.Time{})
+	default:
+		return true, nil
+	}
+}
+
+// reaperActor identifica al reaper en el historial de estados.
+const reaperActor = "reaper"
+
+// reapStuck revisa periódicamente las transmutaciones que siguen en PROCESSING
+// más allá del plazo (p. ej. porque el worker que las tenía se cayó).
+func (q *TaskQueue) reapStuck() {
+	every := q.stuckAfter / 2
+	if every < time.Second {
+		every = time.Second
+	}
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-q.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := q.reap(); err != nil {
+			q.logger.Printf("[async] error revisando transmutaciones atascadas: %v", err)
+		}
+	}
+}
+
+func (q *TaskQueue) reap() error {
+	if q.transRepo == nil {
+		return errors.New("transmutation repository is not configured")
+	}
+	cutoff := time.Now().Add(-q.stuckAfter)
+	stuck, err := q.transRepo.FindStuckProcessing(cutoff)
+	if err != nil {
+		return err
+	}
+	reason := fmt.Sprintf("stuck in PROCESSING for more than %s", q.stuckAfter)
+	for _, t := range stuck {
+		if err := q.timeOutTransmutation(t.ID, reaperActor, "system", reason, cutoff); err != nil {
+			q.logger.Printf("[async] no se pudo cerrar la transmutación atascada %d: %v", t.ID, err)
+		}
+	}
+	return nil
+}
+
+// idempotencyPurgeEvery es cada cuánto se borran las claves de idempotencia caducadas.
+const idempotencyPurgeEvery = time.Hour
+
+func (q *TaskQueue) purgeIdempotencyRecords() {
+	ticker := time.NewTicker(idempotencyPurgeEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-q.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		purged, err := q.idempotencyRepo.PurgeExpired(time.Now().UTC())
+		if err != nil {
+			q.logger.Printf("[async] error borrando claves de idempotencia caducadas: %v", err)
+			continue
+		}
+		if purged > 0 {
+			q.logger.Printf("[async] %d claves de idempotencia caducadas borradas", purged)
+		}
+	}
+}
+
+// timeOutTransmutation marca la transmutación como fallida por timeout,
+// devuelve su material, lo audita y avisa a los clientes.
+func (q *TaskQueue) timeOutTransmutation(id uint, actor, requestedBy, reason string, stuckBefore time.Time) error {
+	t, err := q.transRepo.TimeOut(id, actor, reason, stuckBefore)
+	if err != nil {
+		if errors.Is(err, repository.ErrInvalidTransmutationState) || errors.Is(err, repository.ErrNotStuck) {
+			return nil
+		}
+		return err
+	}
+	// Si el trabajo sigue vivo en este worker, se detiene.
+	q.CancelTransmutationProcessing(id)
+	q.broadcast("transmutation.updated", transmutationToResponse(t))
+	q.broadcast("transmutation.progress", handlers.TransmutationProgressToResponse(t))
+	if t.PipelineID != nil {
+		if err := q.advancePipeline(*t.PipelineID, requestedBy); err != nil {
+			q.logger.Printf("[async] no se pudo avanzar el pipeline %d: %v", *t.PipelineID, err)
+		}
+	}
+	if q.auditRepo == nil {
+		return nil
+	}
+	return q.handleAudit(registerAuditPayload{
+		Action:    "transmutation_timed_out",
+		Entity:    "transmutation",
+		EntityID:  t.ID,
+		UserEmail: requestedBy,
+		Details:   reason + "; reserved material refunded",
+	})
+}
+
+func setProgress(t *models.Transmutation, stage string, percent int, message string) {
+	now := time.Now().UTC()
+	t.Progress = models.TransmutationProgress{Stage: stage, Percent: percent, Message: message, ReportedAt: &now}
+}
+
+// reportProgress guarda y emite una etapa intermedia del procesamiento.
+// Devuelve false si la transmutación dejó de estar en curso y hay que parar.
+func (q *TaskQueue) reportProgress(t *models.Transmutation, stage string, percent int, message string) bool {
+	setProgress(t, stage, percent, message)
+	running, err := q.transRepo.UpdateProgress(t)
+	if err != nil {
+		// El avance es informativo: un fallo al guardarlo no detiene el trabajo.
+		q.logger.Printf("[async] no se pudo guardar el avance de la transmutación %d: %v", t.ID, err)
+		running = true
+	}
+	if !running {
+		return false
+	}
+	q.broadcast("transmutation.progress", handlers.TransmutationProgressToResponse(t))
+	return true
+}
+
+// workerActor identifica al worker en el historial de estados.
+const workerActor = "worker"
+
+// failTransmutation marca la transmutación como fallida y deja constancia en auditoría.
+func (q *TaskQueue) failTransmutation(t *models.Transmutation, requestedBy string, cause error) error {
+	t.Outcome = nil
+	t.Result = fmt.Sprintf("Failed: %v", cause)
+	setProgress(t, models.ProgressStageFailed, t.Progress.Percent, cause.Error())
+	if _, err := q.transRepo.Fail(t, workerActor, cause.Error()); err != nil {
+		if errors.Is(err, repository.ErrInvalidTransmutationState) {
+			return nil
+		}
+		return err
+	}
+	q.broadcast("transmutation.updated", transmutationToResponse(t))
+	q.broadcast("transmutation.progress", handlers.TransmutationProgressToResponse(t))
+	if t.PipelineID != nil {
+		if err := q.advancePipeline(*t.PipelineID, requestedBy); err != nil {
+			q.logger.Printf("[async] no se pudo avanzar el pipeline %d: %v", *t.PipelineID, err)
+		}
+	}
+	if q.auditRepo == nil {
+		return nil
+	}
+	return q.handleAudit(registerAuditPayload{
+		Action:    "transmutation_failed",
+		Entity:    "transmutation",
+		EntityID:  t.ID,
+		UserEmail: requestedBy,
+		Details:   cause.Error(),
+	})
+}
+
+// advancePipeline lanza los pasos del pipeline cuyas dependencias ya
+// terminaron, omite los que dependen de un paso fallido y emite su estado.
+func (q *TaskQueue) advancePipeline(pipelineID uint, requestedBy string) error {
+	if q.pipelineRepo == nil {
+		return errors.New("pipeline repository is not configured")
+	}
+	pipeline, created, err := q.pipelineRepo.Advance(pipelineID, workerActor)
+	if err != nil {
+		return err
+	}
+	for _, t := range created {
+		q.broadcast("transmutation.updated", transmutationToResponse(t))
+		if t.Status == models.TransmutationStatusAwaitingApproval {
+			q.broadcast("transmutation.approval_requested", transmutationToResponse(t))
+			continue
+		}
+		if err := q.EnqueueTransmutationProcessing(t.ID, requestedBy); err != nil {
+			return err
+		}
+	}
+	q.broadcast("pipeline.updated", handlers.PipelineToResponse(pipeline))
+	return nil
+}
+
+// recordExchangeViolation deja en auditoría el desequilibrio calculado para revisión de supervisores.
+func (q *TaskQueue) recordExchangeViolation(transmutationID uint, requestedBy string, balance *models.ExchangeBalance) error {
+	if q.auditRepo == nil {
+		return nil
+	}
+	return q.handleAudit(registerAuditPayload{
+		Action:    "equivalent_exchange_violation",
+		Entity:    "transmutation",
+		EntityID:  transmutationID,
+		UserEmail: requestedBy,
+		Details:   alchemy.DescribeBalance(balance),
+	})
+}
+
 func (q *TaskQueue) handleAudit(payload registerAuditPayload) error {
 	if q.auditRepo == nil {
 		return errors.New("audit repository is not configured")
@@ -355,7 +872,48 @@ func (q *TaskQueue) handleDailyVerification() error {
 			return err
 		}
 		if len(scarce) > 0 {
-			details = append(details, fmt.Sprintf("%d materiales con stock crítico", len(scarce)))
+			// FindScarce viene ordenado por ubicación: se agrupa en ese orden.
+			var byLocation []string
+			for i := 0; i < len(scarce); {
+				j := i
+				for j < len(scarce) && scarce[j].LocationID == scarce[i].LocationID {
+					j++
+				}
+				name := fmt.Sprintf("#%d", scarce[i].LocationID)
+				if scarce[i].Location != nil {
+					name = scarce[i].Location.Name
+				}
+				byLocation = append(byLocation, fmt.Sprintf("%s: %d", name, j-i))
+				i = j
+			}
+			details = append(details, fmt.Sprintf("%d existencias con stock crítico (por ubicación: %s)", len(scarce), strings.Join(byLocation, ", ")))
+		}
+		unreconciled, err := q.materialRepo.FindUnreconciled()
+		if err != nil {
+			return err
+		}
+		if len(unreconciled) > 0 {
+			details = append(details, fmt.Sprintf("%d materiales con descuadre en el libro de movimientos", len(unreconciled)))
+		}
+		expired, expiring, err := q.auditExpiringLots()
+		if err != nil {
+			return err
+		}
+		if expired > 0 {
+			details = append(details, fmt.Sprintf("%d lotes caducados", expired))
+		}
+		if expiring > 0 {
+			details = append(details, fmt.Sprintf("%d lotes caducan en los próximos %d días", expiring, int(q.lotExpiryWindow.Hours()/24)))
+		}
+	}
+
+	if q.restockRepo != nil {
+		pending, err := q.restockRepo.CountPending()
+		if err != nil {
+			return err
+		}
+		if pending > 0 {
+			details = append(details, fmt.Sprintf("%d solicitudes de reposición pendientes", pending))
 		}
 	}
 
@@ -377,21 +935,47 @@ func (q *TaskQueue) handleDailyVerification() error {
 	return nil
 }
 
+// auditExpiringLots audita cada lote con existencias ya caducado o que caduca
+// dentro de lotExpiryWindow y devuelve cuántos hay de cada tipo.
+func (q *TaskQueue) auditExpiringLots() (int, int, error) {
+	now := time.Now()
+	lots, err := q.materialRepo.FindExpiringLots(now.Add(q.lotExpiryWindow))
+	if err != nil {
+		return 0, 0, err
+	}
+	expired, expiring := 0, 0
+	for _, lot := range lots {
+		action := "lot_expiring"
+		if lot.Expired(now) {
+			action = "lot_expired"
+			expired++
+		} else {
+			expiring++
+		}
+		material := fmt.Sprintf("material #%d", lot.MaterialID)
+		if lot.Material != nil {
+			material = lot.Material.Name
+		}
+		audit := registerAuditPayload{
+			Action:    action,
+			Entity:    "material",
+			EntityID:  lot.MaterialID,
+			UserEmail: "system",
+			Details: fmt.Sprintf("lot %s of %s: %s left, expires %s", lot.LotNumber, material,
+				strconv.FormatFloat(lot.Quantity, 'f', -1, 64), lot.ExpiresAt.Format(time.RFC3339)),
+		}
+		if err := q.handleAudit(audit); err != nil {
+			return 0, 0, err
+		}
+	}
+	return expired, expiring, nil
+}
+
 func transmutationToResponse(t *models.Transmutation) *api.TransmutationResponseDto {
 	if t == nil {
 		return nil
 	}
-	return &api.TransmutationResponseDto{
-		ID:         int(t.ID),
-		UserID:     t.UserID,
-		MaterialID: t.MaterialID,
-		Formula:    t.Formula,
-		Quantity:   t.Quantity,
-		Status:     t.Status,
-		Result:     t.Result,
-		CreatedAt:  t.CreatedAt.Format(time.RFC3339),
-		UpdatedAt:  t.UpdatedAt.Format(time.RFC3339),
-	}
+	return handlers.TransmutationToResponse(t)
 }
 
 func auditToResponse(a *models.Audit) *api.AuditResponseDto {
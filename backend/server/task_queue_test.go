@@ -0,0 +1,71 @@
+package server
+
+import (
+	"backend-avanzada/models"
+	"backend-avanzada/repository"
+	"context"
+	"testing"
+)
+
+// newTestQueue arma una cola sobre los repositorios de s para ejecutar los
+// trabajos directamente, sin Redis.
+func newTestQueue(s *Server) *TaskQueue {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &TaskQueue{
+		logger:    s.logger,
+		ctx:       ctx,
+		cancel:    cancel,
+		running:   make(map[uint]context.CancelFunc),
+		transRepo: s.TransmutationRepository,
+		auditRepo: repository.NewAuditRepository(s.DB),
+		engine:    s.TransmutationEngine,
+	}
+}
+
+func TestWorkerCreatesUnregisteredProduct(t *testing.T) {
+	s := newTestServer(t)
+	q := newTestQueue(s)
+	defer q.cancel()
+	mercury, err := s.MaterialRepository.Create(&models.Material{Name: "Mercury", Category: "metal", Unit: "kg", Quantity: 10, EnergyValue: 2}, 0, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tm, err := s.TransmutationRepository.Create(&models.Transmutation{
+		UserID:     1,
+		MaterialID: mercury.ID,
+		Formula:    "Mercury -> 2 Silver",
+		Quantity:   3,
+	}, "test")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	if err := q.handleTransmutation(processTransmutationPayload{TransmutationID: tm.ID, RequestedBy: "ed@example.com"}); err != nil {
+		t.Fatalf("handleTransmutation: %v", err)
+	}
+	done, err := s.TransmutationRepository.FindById(int(tm.ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if done.Status != models.TransmutationStatusCompleted {
+		t.Fatalf("status %s (%s), want COMPLETED", done.Status, done.Result)
+	}
+	silver, err := s.MaterialRepository.FindByName("Silver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if silver == nil {
+		t.Fatal("Silver was not created")
+	}
+	if silver.Quantity != 6 || silver.EnergyValue != 1 || silver.Category != "metal" || silver.Unit != "kg" {
+		t.Errorf("Silver = quantity %v energy value %v %s/%s, want 6 worth 1 in metal/kg", silver.Quantity, silver.EnergyValue, silver.Category, silver.Unit)
+	}
+
+	var audits []models.Audit
+	if err := s.DB.Where("action = ? AND entity_id = ?", "material_created", silver.ID).Find(&audits).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(audits) != 1 || audits[0].Entity != "material" || audits[0].UserEmail != "ed@example.com" {
+		t.Errorf("material_created audits = %+v, want one for Silver by ed@example.com", audits)
+	}
+}
@@ -0,0 +1,104 @@
+package units
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Dimension agrupa las unidades que pueden convertirse entre sí sin más datos.
+type Dimension string
+
+const (
+	Mass   Dimension = "mass"
+	Volume Dimension = "volume"
+	Count  Dimension = "count"
+)
+
+var (
+	ErrUnknownUnit      = errors.New("unknown unit")
+	ErrIncompatibleUnit = errors.New("incompatible units")
+	// ErrNoBaseUnit indica que el destino no tiene unidad declarada, así que
+	// solo admite cantidades sin unidad.
+	ErrNoBaseUnit = errors.New("no base unit declared")
+)
+
+// Unit es una unidad de medida y su factor respecto a la unidad de referencia
+// de su dimensión: gramos, mililitros o unidades.
+type Unit struct {
+	Symbol    string
+	Dimension Dimension
+	Factor    float64
+}
+
+var table = map[string]Unit{
+	"mg":   {Symbol: "mg", Dimension: Mass, Factor: 0.001},
+	"g":    {Symbol: "g", Dimension: Mass, Factor: 1},
+	"kg":   {Symbol: "kg", Dimension: Mass, Factor: 1000},
+	"ml":   {Symbol: "ml", Dimension: Volume, Factor: 1},
+	"l":    {Symbol: "l", Dimension: Volume, Factor: 1000},
+	"unit": {Symbol: "unit", Dimension: Count, Factor: 1},
+}
+
+// Normalize devuelve el símbolo tal y como se guarda (sin espacios y en minúsculas).
+func Normalize(symbol string) string {
+	return strings.ToLower(strings.TrimSpace(symbol))
+}
+
+// Lookup busca una unidad por su símbolo.
+func Lookup(symbol string) (Unit, error) {
+	u, ok := table[Normalize(symbol)]
+	if !ok {
+		return Unit{}, fmt.Errorf("%w %q", ErrUnknownUnit, symbol)
+	}
+	return u, nil
+}
+
+// All devuelve la tabla de conversión ordenada por dimensión y factor.
+func All() []Unit {
+	all := make([]Unit, 0, len(table))
+	for _, u := range table {
+		all = append(all, u)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].Dimension != all[j].Dimension {
+			return all[i].Dimension < all[j].Dimension
+		}
+		return all[i].Factor < all[j].Factor
+	})
+	return all
+}
+
+// Convert expresa quantity, medida en from, en la unidad to. Masa y volumen
+// solo se convierten entre sí con la densidad del material (g/ml) mayor que 0.
+func Convert(quantity float64, from, to string, density float64) (float64, error) {
+	if Normalize(to) == "" {
+		return 0, ErrNoBaseUnit
+	}
+	src, err := Lookup(from)
+	if err != nil {
+		return 0, err
+	}
+	dst, err := Lookup(to)
+	if err != nil {
+		return 0, err
+	}
+	base := quantity * src.Factor
+	switch {
+	case src.Dimension == dst.Dimension:
+	case src.Dimension == Volume && dst.Dimension == Mass && density > 0:
+		base *= density
+	case src.Dimension == Mass && dst.Dimension == Volume && density > 0:
+		base /= density
+	case density <= 0 && isMassVolume(src.Dimension, dst.Dimension):
+		return 0, fmt.Errorf("%w: %s to %s requires the material density", ErrIncompatibleUnit, src.Symbol, dst.Symbol)
+	default:
+		return 0, fmt.Errorf("%w: %s (%s) to %s (%s)", ErrIncompatibleUnit, src.Symbol, src.Dimension, dst.Symbol, dst.Dimension)
+	}
+	return base / dst.Factor, nil
+}
+
+func isMassVolume(a, b Dimension) bool {
+	return (a == Mass && b == Volume) || (a == Volume && b == Mass)
+}
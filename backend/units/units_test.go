@@ -0,0 +1,76 @@
+package units
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		name     string
+		quantity float64
+		from, to string
+		density  float64
+		want     float64
+	}{
+		{name: "same unit", quantity: 3, from: "g", to: "g", want: 3},
+		{name: "kg to g", quantity: 1.5, from: "kg", to: "g", want: 1500},
+		{name: "mg to kg", quantity: 2500, from: "mg", to: "kg", want: 0.0025},
+		{name: "l to ml", quantity: 0.25, from: "l", to: "ml", want: 250},
+		{name: "symbols are normalized", quantity: 2, from: " KG ", to: "G", want: 2000},
+		{name: "volume to mass with density", quantity: 2, from: "l", to: "kg", density: 13.5, want: 27},
+		{name: "mass to volume with density", quantity: 27, from: "g", to: "ml", density: 13.5, want: 2},
+		{name: "count", quantity: 4, from: "unit", to: "unit", want: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Convert(tt.quantity, tt.from, tt.to, tt.density)
+			if err != nil {
+				t.Fatalf("Convert(%v, %q, %q, %v): %v", tt.quantity, tt.from, tt.to, tt.density, err)
+			}
+			if math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("Convert(%v, %q, %q, %v) = %v, want %v", tt.quantity, tt.from, tt.to, tt.density, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConvertErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to string
+		density  float64
+		wantErr  error
+	}{
+		{name: "unknown source", from: "oz", to: "g", wantErr: ErrUnknownUnit},
+		{name: "unknown target", from: "g", to: "lb", wantErr: ErrUnknownUnit},
+		{name: "no base unit", from: "g", to: " ", wantErr: ErrNoBaseUnit},
+		{name: "mass to volume without density", from: "g", to: "ml", wantErr: ErrIncompatibleUnit},
+		{name: "volume to mass without density", from: "l", to: "kg", wantErr: ErrIncompatibleUnit},
+		{name: "count to mass", from: "unit", to: "g", density: 1, wantErr: ErrIncompatibleUnit},
+		{name: "volume to count", from: "ml", to: "unit", wantErr: ErrIncompatibleUnit},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Convert(1, tt.from, tt.to, tt.density); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Convert(1, %q, %q, %v) error = %v, want %v", tt.from, tt.to, tt.density, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLookup(t *testing.T) {
+	for _, u := range All() {
+		got, err := Lookup(u.Symbol)
+		if err != nil {
+			t.Fatalf("Lookup(%q): %v", u.Symbol, err)
+		}
+		if got != u {
+			t.Errorf("Lookup(%q) = %+v, want %+v", u.Symbol, got, u)
+		}
+	}
+	if _, err := Lookup("stone"); !errors.Is(err, ErrUnknownUnit) {
+		t.Errorf("Lookup(%q) error = %v, want %v", "stone", err, ErrUnknownUnit)
+	}
+}
@@ -222,6 +222,8 @@ export default function Dashboard() {
         switch (payload.type) {
           case "transmutation.updated":
           case "transmutation.deleted":
+          case "transmutation.approval_requested":
+          case "transmutation.approval_resolved":
             loadTransmutations();
             break;
           case "audit.created":
@@ -286,6 +288,12 @@ export default function Dashboard() {
     [materials]
   );
 
+  const pendingApprovals = useMemo(
+    () =>
+      transmutations.filter((t) => t.status === "AWAITING_APPROVAL").length,
+    [transmutations]
+  );
+
   const cards = useMemo(() => {
     const base = [
       {
@@ -321,12 +329,19 @@ export default function Dashboard() {
         value: audits.length,
         color: "bg-red-500",
       });
+      base.push({
+        title: "Aprobaciones pendientes",
+        path: "/transmutations",
+        value: pendingApprovals,
+        color: "bg-orange-500",
+      });
     }
     return base;
   }, [
     missions.length,
     materials.length,
     transmutations.length,
+    pendingApprovals,
     audits.length,
     alchemists.length,
     user?.role,
@@ -14,8 +14,11 @@ export default function Materials() {
     name: "",
     category: "",
     quantity: 0,
+    unit: "",
   });
   const [editingId, setEditingId] = useState<number | null>(null);
+  // La unidad solo se elige al registrar o si el material aún no la tiene.
+  const [unitLocked, setUnitLocked] = useState(false);
 
   const loadData = async () => {
     if (!token) return;
@@ -33,8 +36,9 @@ export default function Materials() {
   }, [token]);
 
   const resetForm = () => {
-    setForm({ name: "", category: "", quantity: 0 });
+    setForm({ name: "", category: "", quantity: 0, unit: "" });
     setEditingId(null);
+    setUnitLocked(false);
   };
 
   const handleSubmit = async (e: React.FormEvent) => {
@@ -45,6 +49,7 @@ export default function Materials() {
       name: form.name,
       category: form.category,
       quantity: Number(form.quantity),
+      ...(form.unit ? { unit: form.unit } : {}),
     };
 
     if (editingId) {
@@ -60,10 +65,12 @@ export default function Materials() {
   const handleEdit = (item: Material) => {
     if (!isSupervisor) return;
     setEditingId(item.id!);
+    setUnitLocked(Boolean(item.unit));
     setForm({
       name: item.name,
       category: item.category,
       quantity: item.quantity,
+      unit: item.unit ?? "",
     });
   };
 
@@ -122,6 +129,20 @@ export default function Materials() {
               }
               required
             />
+            <select
+              className="border p-2 rounded"
+              value={form.unit}
+              onChange={(e) => setForm({ ...form, unit: e.target.value })}
+              disabled={unitLocked}
+            >
+              <option value="">Sin unidad</option>
+              <option value="mg">mg</option>
+              <option value="g">g</option>
+              <option value="kg">kg</option>
+              <option value="ml">ml</option>
+              <option value="l">l</option>
+              <option value="unit">unidades</option>
+            </select>
 
             <div className="flex items-center gap-3">
               <button
@@ -145,10 +166,12 @@ export default function Materials() {
 
         <div className="bg-white p-4 rounded shadow">
           <TableList
-            columns={["id", "name", "category", "quantity"]}
+            columns={["id", "name", "category", "quantity", "reserved", "available", "unit"]}
             data={materials.map((item) => ({
               ...item,
               quantity: Number(item.quantity.toFixed(2)),
+              reserved: Number((item.reserved ?? 0).toFixed(2)),
+              available: Number((item.available ?? item.quantity).toFixed(2)),
             }))}
             onEdit={isSupervisor ? handleEdit : undefined}
             onDelete={isSupervisor ? handleDelete : undefined}
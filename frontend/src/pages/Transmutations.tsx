@@ -1,8 +1,13 @@
-import { useEffect, useMemo, useState } from "react";
+import { useEffect, useMemo, useRef, useState } from "react";
 import Navbar from "../components/Navbar";
 import { apiFetch } from "../services/api";
 import { useAuth } from "../context/AuthContext";
-import { Transmutation, Material } from "../types/models";
+import {
+  Transmutation,
+  TransmutationProgress,
+  Material,
+  Formula,
+} from "../types/models";
 import Footer from "../components/Footer";
 import { API_URL } from "../config";
 
@@ -11,20 +16,31 @@ const STATUS_LABELS: Record<string, string> = {
   PROCESSING: "Procesando",
   COMPLETED: "Completada",
   FAILED: "Fallida",
+  CANCELLED: "Cancelada",
+  AWAITING_APPROVAL: "En aprobación",
+  REJECTED: "Rechazada",
 };
 
 export default function Transmutations() {
   const { token, user } = useAuth();
   const [transmutations, setTransmutations] = useState<Transmutation[]>([]);
   const [materials, setMaterials] = useState<Material[]>([]);
+  const [formulas, setFormulas] = useState<Formula[]>([]);
   const [form, setForm] = useState({
     material_id: "",
     quantity: "",
     formula: "",
+    formula_id: "",
     user_id: "",
   });
   const [loading, setLoading] = useState(false);
   const [error, setError] = useState<string | null>(null);
+  // Se reutiliza al reenviar el mismo formulario para no duplicar la transmutación.
+  const submitKey = useRef<string | null>(null);
+
+  useEffect(() => {
+    submitKey.current = null;
+  }, [form]);
 
   const loadTransmutations = async () => {
     if (!token) return;
@@ -56,9 +72,25 @@ export default function Transmutations() {
     }
   };
 
+  const loadFormulas = async () => {
+    if (!token) return;
+    try {
+      const data = await apiFetch<Formula[]>(
+        "/formulas",
+        "GET",
+        undefined,
+        token
+      );
+      setFormulas((data ?? []).filter((f) => !f.deprecated));
+    } catch (err) {
+      console.error("Error cargando fórmulas", err);
+    }
+  };
+
   useEffect(() => {
     loadTransmutations();
     loadMaterials();
+    loadFormulas();
   }, [token, user?.role]);
 
   useEffect(() => {
@@ -75,6 +107,15 @@ export default function Transmutations() {
           payload.type === "transmutation.deleted"
         ) {
           loadTransmutations();
+        } else if (payload.type === "transmutation.progress") {
+          const progress = payload.payload as TransmutationProgress;
+          setTransmutations((prev) =>
+            prev.map((t) =>
+              t.id === progress.transmutation_id
+                ? { ...t, status: progress.status, progress }
+                : t
+            )
+          );
         }
       } catch (err) {
         console.error("Error procesando evento SSE", err);
@@ -98,14 +139,30 @@ export default function Transmutations() {
         material_id: Number(form.material_id),
         quantity: Number(form.quantity),
       };
-      if (form.formula.trim()) {
+      if (form.formula_id) {
+        payload.formula_id = Number(form.formula_id);
+      } else if (form.formula.trim()) {
         payload.formula = form.formula.trim();
       }
       if (user?.role === "supervisor" && form.user_id) {
         payload.user_id = Number(form.user_id);
       }
-      await apiFetch("/transmutations", "POST", payload, token);
-      setForm({ material_id: "", quantity: "", formula: "", user_id: "" });
+      submitKey.current ??= crypto.randomUUID();
+      await apiFetch(
+        "/transmutations",
+        "POST",
+        payload,
+        token,
+        submitKey.current
+      );
+      submitKey.current = null;
+      setForm({
+        material_id: "",
+        quantity: "",
+        formula: "",
+        formula_id: "",
+        user_id: "",
+      });
       await loadTransmutations();
     } catch (err) {
       const message = err instanceof Error ? err.message : "No se pudo crear";
@@ -184,11 +241,25 @@ export default function Transmutations() {
               required
             />
 
+            <select
+              className="border p-2 rounded"
+              value={form.formula_id}
+              onChange={(e) => setForm({ ...form, formula_id: e.target.value })}
+            >
+              <option value="">Fórmula libre</option>
+              {formulas.map((f) => (
+                <option key={f.id} value={String(f.id)}>
+                  {f.name} (v{f.latest_version})
+                </option>
+              ))}
+            </select>
+
             <input
               type="text"
               placeholder="Fórmula alquímica (opcional)"
-              className="border p-2 rounded md:col-span-2"
+              className="border p-2 rounded"
               value={form.formula}
+              disabled={!!form.formula_id}
               onChange={(e) => setForm({ ...form, formula: e.target.value })}
             />
 
@@ -249,14 +320,31 @@ export default function Transmutations() {
                     <tr key={t.id} className="border-b hover:bg-gray-50">
                       <td className="p-3">{t.id}</td>
                       <td className="p-3">{material?.name ?? t.material_id}</td>
-                      <td className="p-3">{t.quantity}</td>
+                      <td className="p-3">
+                        {t.quantity} {t.unit}
+                      </td>
                       <td className="p-3">
                         <span className="px-2 py-1 rounded-full bg-blue-100 text-blue-700 text-xs font-semibold">
                           {statusLabel}
                         </span>
                       </td>
                       <td className="p-3 text-gray-700">
-                        {t.result || "En espera"}
+                        {t.status === "PROCESSING" && t.progress ? (
+                          <div>
+                            <div className="w-full bg-gray-200 rounded h-2">
+                              <div
+                                className="bg-blue-500 h-2 rounded"
+                                style={{ width: `${t.progress.percent}%` }}
+                              />
+                            </div>
+                            <span className="text-xs text-gray-500">
+                              {t.progress.percent}% ·{" "}
+                              {t.progress.message || t.progress.stage}
+                            </span>
+                          </div>
+                        ) : (
+                          t.result || "En espera"
+                        )}
                       </td>
                       <td className="p-3 text-gray-500">
                         {t.updated_at
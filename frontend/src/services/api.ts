@@ -4,13 +4,15 @@ export async function apiFetch<TResponse = unknown, TBody = unknown>(
   path: string,
   method = "GET",
   body?: TBody,
-  token?: string
+  token?: string,
+  idempotencyKey?: string
 ): Promise<TResponse | null> {
   const res = await fetch(`${API_URL}${path}`, {
     method,
     headers: {
       "Content-Type": "application/json",
       ...(token ? { Authorization: `Bearer ${token}` } : {}),
+      ...(idempotencyKey ? { "Idempotency-Key": idempotencyKey } : {}),
     },
     body: body ? JSON.stringify(body) : undefined,
   });
@@ -38,6 +38,112 @@ export interface Material {
   name: string;
   category: string;
   quantity: number;
+  unit?: string;
+  density?: number;
+  on_hand?: number;
+  reserved?: number;
+  available?: number;
+  reorder_level?: number;
+  reorder_quantity?: number;
+  created_at?: string;
+}
+
+export interface MaterialLot {
+  id?: number;
+  material_id: number;
+  lot_number: string;
+  received_at?: string;
+  expires_at?: string;
+  quantity: number;
+  location_id?: number;
+  expired?: boolean;
+}
+
+export interface Location {
+  id?: number;
+  name: string;
+  description?: string;
+  is_default?: boolean;
+  created_at?: string;
+}
+
+export interface MaterialStock {
+  material_id: number;
+  material?: string;
+  location_id: number;
+  location?: string;
+  unit?: string;
+  quantity: number;
+  reserved: number;
+  available: number;
+}
+
+export interface StockTransfer {
+  id?: number;
+  material_id: number;
+  material?: string;
+  from_location_id: number;
+  from_location?: string;
+  to_location_id: number;
+  to_location?: string;
+  lot_id?: number;
+  quantity: number;
+  actor?: string;
+  reason?: string;
+  created_at?: string;
+}
+
+export interface RestockRequest {
+  id: number;
+  material_id: number;
+  material?: string;
+  unit?: string;
+  quantity: number;
+  status: "OPEN" | "APPROVED" | "RECEIVED" | "DISMISSED";
+  available: number;
+  trigger?: string;
+  reviewed_by?: string;
+  note?: string;
+  received_by?: string;
+  received_quantity?: number;
+  closed_at?: string;
+  created_at: string;
+}
+
+export interface Supplier {
+  id?: number;
+  name: string;
+  email?: string;
+  phone?: string;
+  address?: string;
+  notes?: string;
+  created_at?: string;
+}
+
+export interface PurchaseOrderLine {
+  id?: number;
+  material_id: number;
+  material?: string;
+  unit?: string;
+  quantity: number;
+  received_quantity?: number;
+  pending?: number;
+  unit_price?: number;
+}
+
+export interface PurchaseOrder {
+  id?: number;
+  supplier_id: number;
+  supplier?: string;
+  reference?: string;
+  status?: "DRAFT" | "SENT" | "PARTIALLY_RECEIVED" | "RECEIVED" | "CANCELLED";
+  notes?: string;
+  created_by?: string;
+  location_id?: number;
+  total?: number;
+  lines: PurchaseOrderLine[];
+  sent_at?: string;
+  closed_at?: string;
   created_at?: string;
 }
 
@@ -48,13 +154,59 @@ export interface Transmutation {
   user_id: number;
   material_id: number;
   quantity: number;
+  unit?: string;
+  location_id?: number;
   formula?: string;
-  status?: "PENDING" | "PROCESSING" | "COMPLETED" | "FAILED" | string;
+  formula_id?: number;
+  formula_version?: number;
+  status?:
+    | "PENDING"
+    | "PROCESSING"
+    | "COMPLETED"
+    | "FAILED"
+    | "CANCELLED"
+    | "AWAITING_APPROVAL"
+    | "REJECTED"
+    | string;
   result?: string;
+  progress?: TransmutationProgress;
   created_at?: string;
   updated_at?: string;
 }
 
+export interface TransmutationProgress {
+  transmutation_id: number;
+  status: string;
+  stage: string;
+  percent: number;
+  message?: string;
+  updated_at?: string;
+}
+
+// * Formulas
+export interface FormulaVersion {
+  formula_id: number;
+  version: number;
+  body: string;
+  author: string;
+  notes?: string;
+  created_at: string;
+}
+
+export interface Formula {
+  id: number;
+  name: string;
+  description: string;
+  author: string;
+  latest_version: number;
+  body: string;
+  deprecated: boolean;
+  deprecation_reason?: string;
+  versions?: FormulaVersion[];
+  created_at: string;
+  updated_at: string;
+}
+
 // * Audit
 export interface Audit {
   id?: number;
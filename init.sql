@@ -186,6 +186,7 @@ INSERT INTO
         name,
         category,
         quantity,
+        energy_value,
         created_at,
         updated_at
     )
@@ -194,6 +195,7 @@ VALUES (
         'Mercurio Purificado',
         'Metales',
         120.5,
+        200.6,
         NOW(),
         NOW()
     ),
@@ -202,6 +204,7 @@ VALUES (
         'Polvo de Azufre Solar',
         'Catalizadores',
         65.0,
+        32.1,
         NOW(),
         NOW()
     ),
@@ -210,6 +213,7 @@ VALUES (
         'Raíz de Mandrágora',
         'Orgánicos',
         240.75,
+        12.0,
         NOW(),
         NOW()
     ),
@@ -218,6 +222,7 @@ VALUES (
         'Agua Lustral',
         'Disolventes',
         500.0,
+        18.0,
         NOW(),
         NOW()
     ) ON CONFLICT (id) DO NOTHING;